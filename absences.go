@@ -0,0 +1,223 @@
+// Personal absences, such as vacation and sick days, and public holidays
+// from the holiday calendars. Workdays on holidays or absences are days
+// off, not expected to have any hours on the calendar. An absence can log
+// work on a project in the Absent category for each of its workdays.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of absence
+var absenceKinds = []string{"Vacation", "Sick", "Personal", "Other"}
+
+// Holidays and absences on each date, by date, with names to show
+type DaysOff map[string][]string
+
+// Get the holidays and absences between two dates, inclusive
+func getDaysOff(start, end time.Time) DaysOff {
+	off := DaysOff{}
+	for _, h := range getHolidaysBetween(start.Format("2006-01-02"), end.Format("2006-01-02")) {
+		off[h.HolidayDate] = append(off[h.HolidayDate], h.Name)
+	}
+	for _, a := range getAbsences(start.Format("2006-01-02"), end.Format("2006-01-02")) {
+		name := a.Kind
+		if a.MemberName != "" {
+			name += " (" + a.MemberName + ")"
+		}
+		from, err1 := time.ParseInLocation("2006-01-02", a.StartDate, time.Local)
+		to, err2 := time.ParseInLocation("2006-01-02", a.EndDate, time.Local)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			if !d.Before(start) && !d.After(end) {
+				ds := d.Format("2006-01-02")
+				off[ds] = append(off[ds], name)
+			}
+		}
+	}
+	return off
+}
+
+// Work entries to log for an absence: the daily target hours on each
+// workday that isn't a holiday, or none if it has no project
+func absenceWork(a Absence) []Work {
+	entries := []Work{}
+	from, err1 := time.ParseInLocation("2006-01-02", a.StartDate, time.Local)
+	to, err2 := time.ParseInLocation("2006-01-02", a.EndDate, time.Local)
+	if a.ProjectId == 0 || err1 != nil || err2 != nil || to.After(from.AddDate(1, 0, 0)) {
+		return entries
+	}
+	holidays := map[string]bool{}
+	for _, h := range getHolidaysBetween(a.StartDate, a.EndDate) {
+		holidays[h.HolidayDate] = true
+	}
+	description := a.Kind
+	if a.Note != "" {
+		description += ": " + a.Note
+	}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		ds := d.Format("2006-01-02")
+		if isWorkday(d) && !holidays[ds] {
+			entries = append(entries, Work{
+				ProjectId:   a.ProjectId,
+				WorkDate:    ds,
+				Hours:       weeklyTarget() / 5,
+				Description: description,
+				MemberId:    a.MemberId,
+			})
+		}
+	}
+	return entries
+}
+
+// Check whether the work entries generated for an absence can be replaced
+// or deleted, returning an error message if not, or a blank string
+func absenceWorkMessage(absenceId int) string {
+	if absenceId == 0 {
+		return ""
+	}
+	for _, w := range getAbsenceWork(absenceId) {
+		if w.InvoiceId > 0 {
+			return "Work entries for this absence have been billed, and cannot be changed"
+		}
+		if workStatusMessage(w) != "" {
+			return "Work entries for this absence have been " + w.Status + ", and cannot be changed"
+		}
+		if workLockedMessage(w) != "" {
+			return "Work entries for this absence are in a locked period, reopen it first to change them"
+		}
+	}
+	return ""
+}
+
+// Projects that absences can log work on
+func absenceProjects() []Project {
+	list := []Project{}
+	for _, p := range getActiveProjects() {
+		if p.Category == "Absent" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// Page showing all absences, newest first
+func showAbsences(c *gin.Context) {
+	c.HTML(http.StatusOK, "absences.html", gin.H{
+		"absences": getAbsences("", ""),
+		"current":  "calendar",
+	})
+}
+
+// Page with form to add or edit an absence
+func editAbsence(c *gin.Context) {
+
+	// Get absence ID from URL, 0 means new absence
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid absence ID")
+		return
+	}
+	today := time.Now().Format("2006-01-02")
+	a := Absence{Kind: absenceKinds[0], StartDate: today, EndDate: today}
+	if id > 0 {
+		var found bool
+		a, found = findAbsence(id)
+		if !found {
+			c.String(http.StatusNotFound, "Absence not found")
+			return
+		}
+	} else if projects := absenceProjects(); len(projects) == 1 {
+		a.ProjectId = projects[0].Id
+	}
+	showAbsenceForm(c, a, ValidationErrors{})
+}
+
+// Show the absence form, with error messages if any
+func showAbsenceForm(c *gin.Context, a Absence, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "edit_absence.html", gin.H{
+		"a":          a,
+		"kinds":      absenceKinds,
+		"projects":   absenceProjects(),
+		"dailyHours": weeklyTarget() / 5,
+		"errors":     errs,
+		"current":    "calendar",
+	})
+}
+
+// Handle save of an absence, generating its work entries
+func saveAbsenceForm(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.PostForm("id"))
+	projectId, _ := strconv.Atoi(c.PostForm("project_id"))
+	a := Absence{
+		Id:        id,
+		Kind:      c.PostForm("kind"),
+		StartDate: c.PostForm("start_date"),
+		EndDate:   c.PostForm("end_date"),
+		Note:      strings.TrimSpace(c.PostForm("note")),
+		ProjectId: projectId,
+	}
+
+	// New absences are for the current team member, if any
+	if id > 0 {
+		old, found := findAbsence(id)
+		if !found {
+			c.String(http.StatusNotFound, "Absence not found")
+			return
+		}
+		a.MemberId = old.MemberId
+	} else if me, found := currentMember(c); found {
+		a.MemberId = me.Id
+	}
+
+	// Validate, and show the form again if there are any errors
+	entries := absenceWork(a)
+	errs := validateAbsence(a, entries)
+	if len(errs) > 0 {
+		showAbsenceForm(c, a, errs)
+		return
+	}
+
+	saveAbsence(a, entries)
+	c.Redirect(http.StatusSeeOther, "/absences")
+}
+
+// Handle deletion of an absence and its work entries
+func deleteAbsenceHandler(c *gin.Context) {
+
+	// Get absence ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid absence ID")
+		return
+	}
+	if msg := absenceWorkMessage(id); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	deleteAbsence(id)
+	c.Redirect(http.StatusSeeOther, "/absences")
+}
+
+// Describe the hours an absence logs, for the list of absences
+func (a Absence) WorkText() string {
+	if a.ProjectId == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f hours on %s (%d entries)", a.Hours, a.ProjectName, a.Entries)
+}
@@ -0,0 +1,173 @@
+// Project budgets: how much of the hours and/or fee budget has been used,
+// alerts when configurable thresholds are crossed, and a burn-down chart of
+// the remaining budget. Also the dashboard page that shows projects in
+// trouble.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default budget alert thresholds, in percent
+const defaultBudgetThresholds = "80,100"
+
+// Budget alert thresholds from settings, as percentages in increasing order
+func budgetThresholds() []float64 {
+	tt := []float64{}
+	for _, s := range strings.Split(getSetting("budget_thresholds", defaultBudgetThresholds), ",") {
+		t, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err == nil && t > 0 {
+			tt = append(tt, t)
+		}
+	}
+	sort.Float64s(tt)
+	return tt
+}
+
+// Percent of a project's budget used, the greater of hours used and fees
+// used (revenue must already be set). Zero if the project has no budget.
+func budgetUsed(p Project) float64 {
+	used := 0.0
+	if p.BudgetHours > 0 {
+		used = p.Hours / p.BudgetHours * 100
+	}
+	if p.Fees > 0 {
+		used = max(used, p.Revenue/p.Fees*100)
+	}
+	return used
+}
+
+// Highest threshold crossed for a percentage of budget used, 0 if none
+func budgetAlert(used float64, thresholds []float64) float64 {
+	alert := 0.0
+	for _, t := range thresholds {
+		if used >= t {
+			alert = t
+		}
+	}
+	return alert
+}
+
+// Fill in budget used and alerts for a list of projects (after rates),
+// crossing the highest threshold means the project is over budget
+func setProjectBudgets(pp []Project) {
+	thresholds := budgetThresholds()
+	for i := range pp {
+		pp[i].BudgetUsed = budgetUsed(pp[i])
+		pp[i].BudgetAlert = budgetAlert(pp[i].BudgetUsed, thresholds)
+		pp[i].BudgetOver = len(thresholds) > 0 && pp[i].BudgetAlert == thresholds[len(thresholds)-1]
+	}
+}
+
+// Burn-down chart of remaining budget over time, drawn as SVG
+type BurnDownChart struct {
+	Width, Height int
+	Unit          string  // "hours" or "fees"
+	Budget        float64 // starting budget
+	Remaining     float64 // budget left after last entry
+	Points        string  // SVG polyline points for remaining budget
+	ZeroY         int     // y coordinate of the zero line
+	Start, End    string  // first and last date shown
+}
+
+// Build a burn-down chart from a project's work entries (sorted by date,
+// with revenue set), using the hours budget if there is one, otherwise the
+// fee budget. Returns nil if there is no budget or no work yet.
+func burnDownChart(p Project, entries []Work) *BurnDownChart {
+
+	// Which budget to use
+	ch := BurnDownChart{Width: 600, Height: 200, Unit: "hours", Budget: p.BudgetHours}
+	if ch.Budget <= 0 {
+		ch.Unit, ch.Budget = "fees", p.Fees
+	}
+	if ch.Budget <= 0 || len(entries) == 0 {
+		return nil
+	}
+
+	// Remaining budget at the end of each date
+	dates := []time.Time{}
+	remaining := []float64{}
+	left := ch.Budget
+	for _, w := range entries {
+		d, err := time.Parse("2006-01-02", w.WorkDate)
+		if err != nil {
+			continue
+		}
+		if ch.Unit == "hours" {
+			left -= w.Hours
+		} else {
+			left -= w.Revenue
+		}
+		if len(dates) > 0 && d.Equal(dates[len(dates)-1]) {
+			remaining[len(remaining)-1] = left
+		} else {
+			dates = append(dates, d)
+			remaining = append(remaining, left)
+		}
+	}
+	if len(dates) == 0 {
+		return nil
+	}
+	ch.Remaining = left
+	ch.Start = dates[0].Format("2006-01-02")
+	ch.End = dates[len(dates)-1].Format("2006-01-02")
+
+	// Scale: x over the date range, y from lowest remaining (or zero) to budget
+	days := dates[len(dates)-1].Sub(dates[0]).Hours() / 24
+	if days < 1 {
+		days = 1
+	}
+	lowest := min(0, left)
+	x := func(d time.Time) int {
+		return int(d.Sub(dates[0]).Hours() / 24 / days * float64(ch.Width))
+	}
+	y := func(v float64) int {
+		return int((ch.Budget - v) / (ch.Budget - lowest) * float64(ch.Height))
+	}
+	ch.ZeroY = y(0)
+
+	// Step line, starting with the full budget before the first entry
+	pts := []string{fmt.Sprintf("0,%d", y(ch.Budget))}
+	prev := ch.Budget
+	for i, d := range dates {
+		pts = append(pts, fmt.Sprintf("%d,%d", x(d), y(prev)), fmt.Sprintf("%d,%d", x(d), y(remaining[i])))
+		prev = remaining[i]
+	}
+	ch.Points = strings.Join(pts, " ")
+	return &ch
+}
+
+// Dashboard page, showing active projects that have crossed a budget
+// threshold, and all other active projects with budgets
+func showDashboard(c *gin.Context) {
+
+	// Active projects with budgets, most used first
+	projects := getActiveProjects()
+	setProjectRates(projects)
+	setProjectBudgets(projects)
+	alerts, budgets := []Project{}, []Project{}
+	for _, p := range projects {
+		if p.BudgetAlert > 0 {
+			alerts = append(alerts, p)
+		} else if p.BudgetHours > 0 || p.Fees > 0 {
+			budgets = append(budgets, p)
+		}
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].BudgetUsed > alerts[j].BudgetUsed })
+	sort.SliceStable(budgets, func(i, j int) bool { return budgets[i].BudgetUsed > budgets[j].BudgetUsed })
+
+	c.HTML(http.StatusOK, "dashboard.html", gin.H{
+		"alerts":     alerts,
+		"budgets":    budgets,
+		"thresholds": getSetting("budget_thresholds", defaultBudgetThresholds),
+		"current":    "dashboard",
+	})
+}
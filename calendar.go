@@ -0,0 +1,422 @@
+// Page handlers for the calendar of work entries, by month, week or day.
+// The week and day views show entries with start and end times on a
+// time-of-day layout, and other entries above it.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalendarDay represents one day and its work entries
+type CalendarDay struct {
+	Date        string
+	Day         int
+	Entries     []Work
+	Hours       float64  // total hours
+	DaysOff     []string // holidays and absences on the day
+	Workday     bool     // Monday to Friday, without holidays or absences
+	BelowTarget bool     // a past workday with fewer hours than the daily target
+	// For the week and day views
+	Label   string       // e.g. "Mon 14"
+	Untimed []Work       // entries without start and end times
+	Timed   []TimedEntry // entries with start and end times
+}
+
+// CalendarWeek is one row of the month calendar, with the total hours of
+// the whole week, including days in the months before and after
+type CalendarWeek struct {
+	Days        []*CalendarDay // nil for days not in the month
+	Hours       float64
+	Target      float64 // weekly target, less the days off
+	BelowTarget bool    // a past week with fewer hours than its target
+}
+
+// Work entry placed on the time-of-day layout of the week and day views
+type TimedEntry struct {
+	Work
+	Top, Height int // pixels from the top of the day, and height
+	Left, Width int // percent of the day's width, for overlapping entries
+}
+
+// Height of one hour in the time-of-day layout, in pixels
+const calendarHourHeight = 48
+
+// Hours shown in the time-of-day layout, unless entries are outside them
+const calendarDayStart, calendarDayEnd = 8, 18
+
+// Weekly target of hours worked, if not changed in the settings
+const defaultWeeklyTarget = 40
+
+// Target hours worked in a week, zero for no target
+func weeklyTarget() float64 {
+	return settingFloat("weekly_target", defaultWeeklyTarget)
+}
+
+// Whether a date is a workday, Monday to Friday
+func isWorkday(d time.Time) bool {
+	return d.Weekday() != time.Saturday && d.Weekday() != time.Sunday
+}
+
+// Note whether the day is a workday, and whether it's below the daily
+// target (the weekly target spread over five workdays). Only days before
+// today are checked against the target, since today isn't over yet.
+func (day *CalendarDay) checkTarget(d, today time.Time, dailyTarget float64) {
+	day.Workday = isWorkday(d) && len(day.DaysOff) == 0
+	day.BelowTarget = day.Workday && dailyTarget > 0 && d.Before(today) && day.Hours < dailyTarget-0.005
+}
+
+// Target hours for the week starting on a date, less the workdays off
+func weekTarget(start time.Time, weekly float64, off DaysOff) float64 {
+	target := weekly
+	for i := 0; i < 7; i++ {
+		d := start.AddDate(0, 0, i)
+		if isWorkday(d) && len(off[d.Format("2006-01-02")]) > 0 {
+			target -= weekly / 5
+		}
+	}
+	if target < 0.005 {
+		return 0
+	}
+	return target
+}
+
+// Minutes since midnight of a time of day "HH:MM", false if not valid
+func clockMinutes(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// Tag color for each project with entries (stable palette)
+func projectColors(entries []Work) map[int]string {
+	palette := []string{
+		"is-primary", "is-link", "is-info", "is-success", "is-warning", "is-danger",
+		"is-dark", "is-black", "is-primary is-light", "is-link is-light", "is-info is-light",
+		"is-success is-light", "is-warning is-light", "is-danger is-light",
+	}
+	colors := map[int]string{}
+	for _, w := range entries {
+		if _, ok := colors[w.ProjectId]; !ok {
+			idx := w.ProjectId % len(palette)
+			if idx < 0 {
+				idx = -idx
+			}
+			colors[w.ProjectId] = palette[idx]
+		}
+	}
+	return colors
+}
+
+// Page: calendar of work entries, by month (default), week or day
+func showCalendar(c *gin.Context) {
+	switch c.Query("view") {
+	case "week":
+		showCalendarDays(c, 7)
+	case "day":
+		showCalendarDays(c, 1)
+	default:
+		showMonthCalendar(c)
+	}
+}
+
+// Monthly calendar of work entries
+func showMonthCalendar(c *gin.Context) {
+	// Parse year and month from query; default to current
+	now := time.Now()
+	year, _ := strconv.Atoi(c.DefaultQuery("year", fmt.Sprintf("%04d", now.Year())))
+	monthInt, _ := strconv.Atoi(c.DefaultQuery("month", fmt.Sprintf("%02d", int(now.Month()))))
+	if monthInt < 1 || monthInt > 12 {
+		monthInt = int(now.Month())
+	}
+	month := time.Month(monthInt)
+
+	locale := currentLocale()
+	firstOfMonth := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	// Compute last day
+	firstNextMonth := firstOfMonth.AddDate(0, 1, 0)
+	lastOfMonth := firstNextMonth.AddDate(0, 0, -1)
+	daysInMonth := lastOfMonth.Day()
+
+	// Entries for the whole weeks shown, for the weekly totals
+	first := firstDayOfWeek()
+	gridStart := weekStartOn(firstOfMonth, first)
+	gridEnd := weekStartOn(lastOfMonth, first).AddDate(0, 0, 6)
+	entries := getWorkEntriesBetween(gridStart.Format("2006-01-02"), gridEnd.Format("2006-01-02"))
+
+	// Bucket entries by date
+	dayMap := map[string][]Work{}
+	for _, w := range entries {
+		dayMap[w.WorkDate] = append(dayMap[w.WorkDate], w)
+	}
+	off := getDaysOff(gridStart, gridEnd)
+
+	// Days of the month with their totals, and totals for the month
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	weekly := weeklyTarget()
+	var total, billable, target float64
+	workdays, missing := 0, 0
+	days := make([]CalendarDay, 0, daysInMonth)
+	for d := 1; d <= daysInMonth; d++ {
+		cur := time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+		ds := cur.Format("2006-01-02")
+		day := CalendarDay{
+			Date:    ds,
+			Day:     d,
+			Entries: dayMap[ds],
+			DaysOff: off[ds],
+		}
+		for _, w := range day.Entries {
+			day.Hours += w.Hours
+			if w.Billable {
+				billable += w.Hours
+			}
+		}
+		day.checkTarget(cur, today, weekly/5)
+		if day.Workday {
+			workdays++
+			if cur.Before(today) && len(day.Entries) == 0 {
+				missing++
+			}
+		}
+		total += day.Hours
+		days = append(days, day)
+	}
+	target = weekly / 5 * float64(workdays)
+	billableShare := 0.0
+	if total > 0 {
+		billableShare = billable / total * 100
+	}
+
+	// Column of the first of the month, 0 for the first day of the week
+	startWeekday := (int(firstOfMonth.Weekday()) - int(first) + 7) % 7
+
+	// Next/prev month routing
+	prev := firstOfMonth.AddDate(0, -1, 0)
+	next := firstOfMonth.AddDate(0, 1, 0)
+
+	// Build grid of weeks with optional days, each with its total hours
+	weeks := []CalendarWeek{}
+	for ws := gridStart; !ws.After(gridEnd); ws = ws.AddDate(0, 0, 7) {
+		week := CalendarWeek{Days: make([]*CalendarDay, 7)}
+		for i := 0; i < 7; i++ {
+			cur := ws.AddDate(0, 0, i)
+			for _, w := range dayMap[cur.Format("2006-01-02")] {
+				week.Hours += w.Hours
+			}
+			if cur.Month() == month {
+				week.Days[i] = &days[cur.Day()-1]
+			}
+		}
+		week.Target = weekTarget(ws, weekly, off)
+		week.BelowTarget = week.Target > 0 && !ws.AddDate(0, 0, 7).After(today) && week.Hours < week.Target-0.005
+		weeks = append(weeks, week)
+	}
+
+	// Week and day views open on today if it's in this month, otherwise on
+	// the first
+	focus := firstOfMonth
+	if now.Year() == year && now.Month() == month {
+		focus = now
+	}
+
+	c.HTML(http.StatusOK, "calendar.html", gin.H{
+		"year":          year,
+		"month":         int(month),
+		"monthName":     locale.MonthYear(firstOfMonth),
+		"weekDays":      locale.WeekDays(first),
+		"daysInMonth":   daysInMonth,
+		"startWeekday":  startWeekday,
+		"days":          days,
+		"weeks":         weeks,
+		"total":         total,
+		"billable":      billable,
+		"billableShare": billableShare,
+		"target":        target,
+		"workdays":      workdays,
+		"missing":       missing,
+		"view":          "month",
+		"prevLink":      fmt.Sprintf("/calendar?year=%d&month=%d", prev.Year(), int(prev.Month())),
+		"nextLink":      fmt.Sprintf("/calendar?year=%d&month=%d", next.Year(), int(next.Month())),
+		"prevTitle":     "Previous month",
+		"nextTitle":     "Next month",
+		"focusDate":     focus.Format("2006-01-02"),
+		"colors":        projectColors(entries),
+		"current":       "calendar",
+	})
+}
+
+// Week (n = 7) or day (n = 1) view of work entries, for the week or day
+// containing the date in the query string (default today)
+func showCalendarDays(c *gin.Context, n int) {
+
+	// First day shown
+	locale := currentLocale()
+	now := time.Now()
+	date := now
+	if s := c.Query("date"); s != "" {
+		var err error
+		date, err = time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			c.String(http.StatusBadRequest, "Invalid date")
+			return
+		}
+	}
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	if n == 7 {
+		start = weekStart(start)
+	}
+	end := start.AddDate(0, 0, n-1)
+
+	// Entries by date
+	entries := getWorkEntriesBetween(start.Format("2006-01-02"), end.Format("2006-01-02"))
+	dayMap := map[string][]Work{}
+	for _, w := range entries {
+		dayMap[w.WorkDate] = append(dayMap[w.WorkDate], w)
+	}
+
+	// Hours shown on the time-of-day layout, widened to fit all entries
+	firstHour, lastHour := calendarDayStart, calendarDayEnd
+	for _, w := range entries {
+		from, ok1 := clockMinutes(w.StartTime)
+		to, ok2 := clockMinutes(w.EndTime)
+		if ok1 && ok2 && to > from {
+			if from/60 < firstHour {
+				firstHour = from / 60
+			}
+			if (to+59)/60 > lastHour {
+				lastHour = (to + 59) / 60
+			}
+		}
+	}
+
+	// Days with totals, entries without times, and entries placed by time
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	weekly := weeklyTarget()
+	off := getDaysOff(start, end)
+	days := []CalendarDay{}
+	var total float64
+	anyTimed := false
+	for i := 0; i < n; i++ {
+		cur := start.AddDate(0, 0, i)
+		ds := cur.Format("2006-01-02")
+		day := CalendarDay{Date: ds, Day: cur.Day(), Entries: dayMap[ds], DaysOff: off[ds], Label: locale.DayLabel(cur)}
+		for _, w := range dayMap[ds] {
+			day.Hours += w.Hours
+			from, ok1 := clockMinutes(w.StartTime)
+			to, ok2 := clockMinutes(w.EndTime)
+			if !ok1 || !ok2 || to <= from {
+				day.Untimed = append(day.Untimed, w)
+				continue
+			}
+			height := (to - from) * calendarHourHeight / 60
+			if height < 18 {
+				height = 18
+			}
+			day.Timed = append(day.Timed, TimedEntry{Work: w,
+				Top: (from - firstHour*60) * calendarHourHeight / 60, Height: height})
+		}
+		layoutTimedEntries(day.Timed)
+		day.checkTarget(cur, today, weekly/5)
+		anyTimed = anyTimed || len(day.Timed) > 0
+		total += day.Hours
+		days = append(days, day)
+	}
+
+	target := weekTarget(start, weekly, off)
+
+	// Hour labels down the side of the time-of-day layout
+	type hourLabel struct {
+		Label string
+		Top   int
+	}
+	hours := []hourLabel{}
+	for h := firstHour; h < lastHour; h++ {
+		hours = append(hours, hourLabel{fmt.Sprintf("%02d:00", h), (h - firstHour) * calendarHourHeight})
+	}
+
+	// Title and links to the previous and next week or day, and to the other
+	// views, on today if it's shown
+	title := "Week of " + locale.Date(start)
+	prevTitle, nextTitle := "Previous week", "Next week"
+	if n == 1 {
+		title = locale.LongDate(start)
+		prevTitle, nextTitle = "Previous day", "Next day"
+	}
+	focus := start
+	if !now.Before(start) && now.Before(end.AddDate(0, 0, 1)) {
+		focus = now
+	}
+	view := map[int]string{1: "day", 7: "week"}[n]
+
+	c.HTML(http.StatusOK, "calendar_days.html", gin.H{
+		"title":       title,
+		"days":        days,
+		"total":       total,
+		"weekTarget":  target,
+		"belowTarget": n == 7 && target > 0 && end.Before(today) && total < target-0.005,
+		"anyTimed":    anyTimed,
+		"hours":       hours,
+		"gridHeight":  (lastHour - firstHour) * calendarHourHeight,
+		"view":        view,
+		"prevLink":    "/calendar?view=" + view + "&date=" + start.AddDate(0, 0, -n).Format("2006-01-02"),
+		"nextLink":    "/calendar?view=" + view + "&date=" + start.AddDate(0, 0, n).Format("2006-01-02"),
+		"prevTitle":   prevTitle,
+		"nextTitle":   nextTitle,
+		"year":        focus.Year(),
+		"month":       int(focus.Month()),
+		"focusDate":   focus.Format("2006-01-02"),
+		"colors":      projectColors(entries),
+		"current":     "calendar",
+	})
+}
+
+// Place overlapping timed entries of one day side by side, each in the
+// first column that is free at its start time, sharing the width with the
+// entries it overlaps
+func layoutTimedEntries(entries []TimedEntry) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Top < entries[j].Top })
+
+	// Split widths of the entries in a group that overlap each other
+	setWidths := func(group []TimedEntry, columns int) {
+		for i := range group {
+			group[i].Width = 100 / columns
+			group[i].Left = group[i].Left * group[i].Width
+		}
+	}
+
+	// Go through groups of overlapping entries, using Left for the column
+	// number until the group is complete
+	groupStart, groupEnd := 0, 0
+	columnEnds := []int{} // bottom of the last entry in each column
+	for i := range entries {
+		e := &entries[i]
+		if i > groupStart && e.Top >= groupEnd {
+			setWidths(entries[groupStart:i], len(columnEnds))
+			groupStart, columnEnds = i, nil
+		}
+		col := 0
+		for col < len(columnEnds) && columnEnds[col] > e.Top {
+			col++
+		}
+		if col == len(columnEnds) {
+			columnEnds = append(columnEnds, 0)
+		}
+		columnEnds[col] = e.Top + e.Height
+		e.Left = col
+		if i == groupStart || e.Top+e.Height > groupEnd {
+			groupEnd = e.Top + e.Height
+		}
+	}
+	if len(entries) > 0 {
+		setWidths(entries[groupStart:], len(columnEnds))
+	}
+}
@@ -0,0 +1,333 @@
+// Page handlers for clients, each with its billing details, default rate
+// and currency, contacts, projects and invoices.
+//
+// Before there was a client table, the client was typed in on each project,
+// so the same client could appear under several spellings. The client
+// migration page groups those old names, suggests which belong together, and
+// moves them to clients once reviewed.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Words dropped from the end of client names when suggesting merges
+var companySuffixes = []string{"inc", "incorporated", "corp", "corporation", "co", "company",
+	"ltd", "limited", "llc", "llp", "plc", "gmbh", "ag", "sa", "bv", "pty"}
+
+// Make a key for grouping client names that probably belong to the same
+// client, ignoring case, punctuation and company suffixes, e.g. "ACME",
+// "Acme Corp." and "acme" all give "acme"
+func clientKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	})
+	for len(words) > 1 {
+		last := words[len(words)-1]
+		suffix := false
+		for _, s := range companySuffixes {
+			if last == s {
+				suffix = true
+			}
+		}
+		if !suffix {
+			break
+		}
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, "")
+}
+
+// Page showing list of all clients
+func showClients(c *gin.Context) {
+	c.HTML(http.StatusOK, "clients.html", gin.H{
+		"clients": getClients(),
+		"legacy":  len(getLegacyClients()),
+		"current": "clients",
+	})
+}
+
+// Page showing one client, with its projects, invoices and contacts
+func showClient(c *gin.Context) {
+
+	// Get client ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+	cl, found := findClient(id)
+	if !found {
+		c.String(http.StatusNotFound, "Client not found")
+		return
+	}
+
+	// The client's projects with hours and revenue, and totals
+	projects := []Project{}
+	for _, p := range getProjects() {
+		if p.ClientId == id {
+			projects = append(projects, p)
+		}
+	}
+	setProjectRates(projects)
+	var hours, billableHours float64
+	for _, p := range projects {
+		hours += p.Hours
+		billableHours += p.BillableHours
+	}
+
+	// Contacts linked, and others that could be
+	contacts := getContactsForClient(id)
+	newContacts := []Contact{}
+	for _, ct := range getContacts() {
+		already := false
+		for _, linked := range contacts {
+			if ct.Id == linked.Id {
+				already = true
+			}
+		}
+		if ct.Active && !already {
+			newContacts = append(newContacts, ct)
+		}
+	}
+
+	c.HTML(http.StatusOK, "client.html", gin.H{
+		"cl":            cl,
+		"currency":      clientCurrency(cl.Name),
+		"defaultRate":   settingFloat("default_rate", 0),
+		"projects":      projects,
+		"hours":         hours,
+		"billableHours": billableHours,
+		"invoices":      getInvoices(cl.Name),
+		"contacts":      contacts,
+		"newContacts":   newContacts,
+		"current":       "clients",
+	})
+}
+
+// Page to create/edit a client
+func editClient(c *gin.Context) {
+
+	// Get client ID from URL, 0 means new client
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+	cl := Client{Active: true}
+	if id > 0 {
+		var found bool
+		cl, found = findClient(id)
+		if !found {
+			c.String(http.StatusNotFound, "Client not found")
+			return
+		}
+	}
+	showClientForm(c, cl, ValidationErrors{})
+}
+
+// Show the client form, with error messages if any
+func showClientForm(c *gin.Context, cl Client, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "edit_client.html", gin.H{
+		"cl":      cl,
+		"errors":  errs,
+		"current": "clients",
+	})
+}
+
+// Handle save of a client
+func saveClientForm(c *gin.Context) {
+
+	// Parse fields, collecting errors for any that can't be parsed
+	errs := ValidationErrors{}
+	id, _ := strconv.Atoi(c.PostForm("id"))
+	rate, err := parseAmount(c.PostForm("rate"))
+	if err != nil {
+		errs["rate"] = "Please enter the rate as a number, or leave blank"
+	}
+	cl := Client{
+		Id:       id,
+		Name:     strings.TrimSpace(c.PostForm("name")),
+		Address:  strings.TrimSpace(c.PostForm("address")),
+		Rate:     rate,
+		Currency: strings.ToUpper(strings.TrimSpace(c.PostForm("currency"))),
+		Notes:    strings.TrimSpace(c.PostForm("notes")),
+		Active:   c.PostForm("active") == "on",
+	}
+
+	// Validate the rest, and show the form again if there are any errors
+	for field, msg := range validateClient(cl) {
+		if errs[field] == "" {
+			errs[field] = msg
+		}
+	}
+	if len(errs) > 0 {
+		showClientForm(c, cl, errs)
+		return
+	}
+
+	savedId := saveClient(cl)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/client/%d", savedId))
+}
+
+// Handle deletion of a client, only if nothing refers to it
+func deleteClientHandler(c *gin.Context) {
+
+	// Get client ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+	if clientInUse(id) {
+		c.String(http.StatusBadRequest, "Client has projects, invoices or period locks, cannot delete it")
+		return
+	}
+
+	deleteClient(id)
+	c.Redirect(http.StatusSeeOther, "/clients")
+}
+
+// Handle linking a contact to a client
+func addClientContactLink(c *gin.Context) {
+
+	// Get client ID from URL, and contact ID from form
+	clientId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+	contactId, err := strconv.Atoi(c.PostForm("contact_id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid contact ID")
+		return
+	}
+
+	addClientContact(clientId, contactId)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/client/%d", clientId))
+}
+
+// Handle removing a contact from a client
+func deleteClientContactLink(c *gin.Context) {
+
+	// Get client ID and contact ID from URL query string
+	clientId, err := strconv.Atoi(c.Query("client"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+	contactId, err := strconv.Atoi(c.Query("contact"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid contact ID")
+		return
+	}
+
+	deleteClientContact(clientId, contactId)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/client/%d", clientId))
+}
+
+// Page to review the client names typed before there was a client table,
+// grouped by the client they probably belong to, with the suggested client
+// name for each group (an existing client if one matches, otherwise the
+// name used on the most projects)
+func showClientMigration(c *gin.Context) {
+
+	// Existing clients by key
+	existing := map[string]string{}
+	for _, cl := range getClients() {
+		existing[clientKey(cl.Name)] = cl.Name
+	}
+
+	// Group old names by key, numbering the names for the form fields
+	type name struct {
+		LegacyClient
+		N int
+	}
+	type group struct {
+		Key    string
+		Target string
+		Names  []name
+	}
+	groups := map[string]*group{}
+	for _, lc := range getLegacyClients() {
+		key := clientKey(lc.Name)
+		if groups[key] == nil {
+			groups[key] = &group{Key: key}
+		}
+		groups[key].Names = append(groups[key].Names, name{LegacyClient: lc})
+	}
+
+	// Suggested client name for each group
+	list := []group{}
+	for key, g := range groups {
+		if name, found := existing[key]; found {
+			g.Target = name
+		} else {
+			best := g.Names[0]
+			for _, n := range g.Names {
+				if n.Projects+n.Invoices > best.Projects+best.Invoices {
+					best = n
+				}
+			}
+			g.Target = best.Name
+		}
+		list = append(list, *g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	count := 0
+	for _, g := range list {
+		for i := range g.Names {
+			g.Names[i].N = count
+			count++
+		}
+	}
+
+	c.HTML(http.StatusOK, "migrate_clients.html", gin.H{
+		"groups":  list,
+		"count":   count,
+		"current": "clients",
+	})
+}
+
+// Handle the reviewed client migration. Each old name is posted in a field
+// "name_<n>", with the client it belongs to in "target_<n>".
+func migrateClientsForm(c *gin.Context) {
+
+	// Collect old name to client name, checking all are filled in
+	targets := map[string]string{}
+	for _, lc := range getLegacyClients() {
+		targets[lc.Name] = ""
+	}
+	count, _ := strconv.Atoi(c.PostForm("count"))
+	for i := 0; i < count; i++ {
+		name := c.PostForm(fmt.Sprintf("name_%d", i))
+		target := strings.TrimSpace(c.PostForm(fmt.Sprintf("target_%d", i)))
+		if _, found := targets[name]; !found {
+			continue
+		}
+		if target == "" || len(target) > 32 {
+			c.String(http.StatusBadRequest, "Please give a client name of up to 32 characters for \""+name+"\"")
+			return
+		}
+		targets[name] = target
+	}
+	for name, target := range targets {
+		if target == "" {
+			delete(targets, name)
+		}
+	}
+
+	migrateClients(targets)
+	c.Redirect(http.StatusSeeOther, "/clients")
+}
@@ -98,7 +98,7 @@ func editContact(c *gin.Context) {
 	// Show the edit page
 	c.HTML(http.StatusOK,
 		"edit_contact.html",
-		gin.H{"c": cont, "current": "contacts"})
+		gin.H{"c": cont, "errors": ValidationErrors{}, "current": "contacts"})
 }
 
 // Handle form submission to save a contact
@@ -127,6 +127,14 @@ func saveContactForm(c *gin.Context) {
 		Active:    c.PostForm("active") == "on" || c.PostForm("active") == "true",
 	}
 
+	// Check the contact, show form again if there are errors
+	if errs := validateContact(cont); len(errs) > 0 {
+		c.HTML(http.StatusUnprocessableEntity,
+			"edit_contact.html",
+			gin.H{"c": cont, "errors": errs, "current": "contacts"})
+		return
+	}
+
 	// Save the contact (TODO: is ID assigned for new contacts?)
 	savedId := saveContact(cont)
 
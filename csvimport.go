@@ -0,0 +1,469 @@
+// Import of work entries from CSV files, e.g. exported from other time
+// trackers or a spreadsheet. The columns of the file are mapped to the
+// fields of work entries, guessed from the column names at first, and a
+// dry run shows each row as it would be imported, with any errors. The
+// import adds all rows in one transaction, or none if any row has an error.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest CSV file that can be imported
+const maxCSVSize = 2 << 20
+
+// A field of work entries that a column can be mapped to, with the names
+// other apps give the column, lower case, in order of preference
+type CSVField struct {
+	Name    string
+	Label   string
+	Headers []string
+}
+
+// Fields that columns can be mapped to
+var csvFields = []CSVField{
+	{"date", "Date", []string{"date", "start date", "spent date", "work date", "day"}},
+	{"start_time", "Start time", []string{"start time", "start", "from"}},
+	{"end_time", "End time", []string{"end time", "end", "to"}},
+	{"hours", "Hours", []string{"hours", "duration (decimal)", "duration", "duration (h)", "time"}},
+	{"client", "Client", []string{"client", "customer", "client name"}},
+	{"project", "Project", []string{"project", "project name"}},
+	{"description", "Description", []string{"description", "notes", "note", "comment", "task"}},
+	{"billable", "Billable", []string{"billable", "billable?"}},
+	{"tags", "Tags", []string{"tags", "tag"}},
+}
+
+// Formats of dates in CSV files, as layouts for time.Parse
+var csvDateFormats = []struct{ Layout, Label string }{
+	{"2006-01-02", "YYYY-MM-DD"},
+	{"1/2/2006", "MM/DD/YYYY"},
+	{"2/1/2006", "DD/MM/YYYY"},
+	{"2.1.2006", "DD.MM.YYYY"},
+}
+
+// How the columns of a CSV file map to the fields of work entries
+type CSVMapping struct {
+	Columns        map[string]int // column of each field, -1 if not mapped
+	DateLayout     string
+	CreateProjects bool   // add projects and clients not found, or show errors
+	Category       string // category of projects added, which decides if their entries are billable
+}
+
+// One row of a CSV file, as the work entry it would be imported as
+type CSVRow struct {
+	Line       int  // line in the file, counting the column names as 1
+	Work       Work // with project and client names
+	NewProject bool // project to add
+	Error      string
+}
+
+// Read the rows of a CSV file, separated by commas, semicolons or tabs,
+// whichever the first line has most of
+func readCSV(data string) ([][]string, error) {
+	data = strings.TrimPrefix(data, "\ufeff")
+	first, _, _ := strings.Cut(data, "\n")
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comma = ','
+	for _, sep := range []rune{';', '\t'} {
+		if strings.Count(first, string(sep)) > strings.Count(first, string(r.Comma)) {
+			r.Comma = sep
+		}
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, errors.New("expected a line of column names, then a line for each work entry")
+	}
+	return records, nil
+}
+
+// Guess the mapping of columns from their names, and the date format from
+// the first format that all dates are in
+func guessCSVMapping(records [][]string) CSVMapping {
+	m := CSVMapping{Columns: map[string]int{}, DateLayout: csvDateFormats[0].Layout, Category: "Billable"}
+	for _, f := range csvFields {
+		m.Columns[f.Name] = -1
+		for _, name := range f.Headers {
+			for i, h := range records[0] {
+				if m.Columns[f.Name] == -1 && strings.ToLower(strings.TrimSpace(h)) == name {
+					m.Columns[f.Name] = i
+				}
+			}
+		}
+	}
+	col := m.Columns["date"]
+	for _, df := range csvDateFormats {
+		valid := col >= 0
+		for _, record := range records[1:] {
+			if col < len(record) && strings.TrimSpace(record[col]) != "" {
+				_, err := csvDate(record[col], df.Layout)
+				valid = valid && err == nil
+			}
+		}
+		if valid {
+			m.DateLayout = df.Layout
+			break
+		}
+	}
+	return m
+}
+
+// Read the mapping of columns from the form
+func parseCSVMapping(c *gin.Context, columns int) CSVMapping {
+	m := CSVMapping{
+		Columns:        map[string]int{},
+		DateLayout:     csvDateFormats[0].Layout,
+		CreateProjects: c.PostForm("create_projects") == "on",
+		Category:       "Billable",
+	}
+	for _, f := range csvFields {
+		i, err := strconv.Atoi(c.PostForm("col_" + f.Name))
+		if err != nil || i < 0 || i >= columns {
+			i = -1
+		}
+		m.Columns[f.Name] = i
+	}
+	for _, df := range csvDateFormats {
+		if c.PostForm("date_format") == df.Layout {
+			m.DateLayout = df.Layout
+		}
+	}
+	for _, cat := range projectCategories {
+		if cat != "" && c.PostForm("category") == cat {
+			m.Category = cat
+		}
+	}
+	return m
+}
+
+// Parse a date, ignoring any time after it
+func csvDate(s, layout string) (string, error) {
+	s = strings.TrimSpace(s)
+	if before, _, found := strings.Cut(s, " "); found {
+		s = before
+	}
+	if before, _, found := strings.Cut(s, "T"); found {
+		s = before
+	}
+	d, err := time.Parse(layout, s)
+	if err != nil {
+		return "", err
+	}
+	return d.Format("2006-01-02"), nil
+}
+
+// Parse a time of day, e.g. "14:30", "14:30:00" or "2:30 PM", or the time
+// of a date and time, as "HH:MM"
+func csvTime(s string) (string, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	layouts := []string{"15:04", "15:04:05", "3:04 PM", "3:04:05 PM", "3:04PM"}
+	for _, v := range []string{s, s[strings.IndexAny(s, " T")+1:]} {
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.Format("15:04"), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Invalid time \"%s\"", s)
+}
+
+// Parse hours, e.g. "1.5", "1,5", "1:30", "01:30:00" or "90m"
+func csvHours(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if parts := strings.Split(s, ":"); len(parts) == 3 {
+		h, err1 := strconv.Atoi(parts[0])
+		m, err2 := strconv.Atoi(parts[1])
+		sec, err3 := strconv.Atoi(parts[2])
+		if err1 != nil || err2 != nil || err3 != nil || m >= 60 || sec >= 60 {
+			return 0, fmt.Errorf("Invalid hours \"%s\"", s)
+		}
+		return float64(h) + float64(m)/60 + float64(sec)/3600, nil
+	}
+	if !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	h, err := parseHours(s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid hours \"%s\"", s)
+	}
+	return h, nil
+}
+
+// Parse a billable flag, e.g. "yes" or "no", blank for no
+func csvBillable(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "y", "true", "1", "x", "billable":
+		return true, nil
+	case "no", "n", "false", "0", "", "non-billable", "not billable":
+		return false, nil
+	}
+	return false, fmt.Errorf("Invalid billable \"%s\", expected yes or no", s)
+}
+
+// Make the rows of a CSV file into work entries for a team member, with
+// the new clients and projects they're on if the mapping creates them. New
+// clients and projects have negative IDs until they're added.
+func csvRows(records [][]string, m CSVMapping, memberId int) ([]CSVRow, []Client, []Project) {
+
+	// Existing clients and projects by name, lower case
+	clients := map[string]int{}
+	for _, cl := range getClients() {
+		clients[strings.ToLower(strings.TrimSpace(cl.Name))] = cl.Id
+	}
+	projects := map[string][]Project{}
+	for _, p := range getProjects() {
+		name := strings.ToLower(strings.TrimSpace(p.Name))
+		projects[name] = append(projects[name], p)
+	}
+	newClients, newProjects := []Client{}, []Project{}
+
+	rows := []CSVRow{}
+	for i, record := range records[1:] {
+		cell := func(field string) string {
+			col := m.Columns[field]
+			if col < 0 || col >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[col])
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		row := CSVRow{Line: i + 2}
+		w := Work{
+			Description: cell("description"),
+			MemberId:    memberId,
+			Tags:        parseTags(cell("tags")),
+			ProjectName: cell("project"),
+			Client:      cell("client"),
+		}
+		fail := func(msg string) { // keeping the first error found
+			if row.Error == "" {
+				row.Error = msg
+			}
+		}
+
+		// Date, and times if both given
+		date, err := csvDate(cell("date"), m.DateLayout)
+		if err != nil {
+			fail(fmt.Sprintf("Invalid date \"%s\"", cell("date")))
+		}
+		w.WorkDate = date
+		if cell("start_time") != "" && cell("end_time") != "" {
+			w.StartTime, err = csvTime(cell("start_time"))
+			if err == nil {
+				w.EndTime, err = csvTime(cell("end_time"))
+			}
+			if err != nil {
+				fail(err.Error())
+			}
+		}
+
+		// Hours, or the time between start and end
+		if cell("hours") != "" {
+			w.Hours, err = csvHours(cell("hours"))
+			if err != nil {
+				fail(err.Error())
+			}
+		} else if from, ok := clockMinutes(w.StartTime); ok {
+			to, _ := clockMinutes(w.EndTime)
+			w.Hours = float64(to-from) / 60
+		}
+
+		// Project by name, and client name if given, or a new one
+		var found []Project
+		for _, p := range projects[strings.ToLower(w.ProjectName)] {
+			if w.Client == "" || strings.EqualFold(strings.TrimSpace(p.Client), w.Client) {
+				found = append(found, p)
+			}
+		}
+		switch {
+		case w.ProjectName == "":
+			fail("No project")
+		case len(found) == 1:
+			w.ProjectId = found[0].Id
+			w.Billable = found[0].IsBillable()
+		case len(found) > 1:
+			fail(fmt.Sprintf("There are %d projects named \"%s\", map the client column", len(found), w.ProjectName))
+		case !m.CreateProjects:
+			if w.Client != "" {
+				fail(fmt.Sprintf("No project \"%s\" of client \"%s\", choose to add missing projects", w.ProjectName, w.Client))
+			} else {
+				fail(fmt.Sprintf("No project \"%s\", choose to add missing projects", w.ProjectName))
+			}
+		case len(w.ProjectName) > 32 || len(w.Client) > 32:
+			fail("Project and client names cannot be longer than 32 characters")
+		default:
+			p := Project{Id: -len(newProjects) - 1, Name: w.ProjectName, Client: w.Client, Category: m.Category, Active: true}
+			if w.Client != "" {
+				p.ClientId = clients[strings.ToLower(w.Client)]
+				if p.ClientId == 0 {
+					p.ClientId = -len(newClients) - 1
+					clients[strings.ToLower(w.Client)] = p.ClientId
+					newClients = append(newClients, Client{Id: p.ClientId, Name: w.Client, Active: true})
+				}
+			}
+			newProjects = append(newProjects, p)
+			projects[strings.ToLower(p.Name)] = append(projects[strings.ToLower(p.Name)], p)
+			w.ProjectId = p.Id
+		}
+		if w.ProjectId < 0 {
+			row.NewProject = true
+			w.Billable = m.Category == "Billable"
+		}
+
+		// Billable flag if mapped, otherwise from the project; always from the
+		// category for new projects, so entries match their project
+		if m.Columns["billable"] >= 0 && !row.NewProject {
+			w.Billable, err = csvBillable(cell("billable"))
+			if err != nil {
+				fail(err.Error())
+			}
+		}
+
+		row.Work = w
+		rows = append(rows, row)
+	}
+	return rows, newClients, newProjects
+}
+
+// Page with the form to upload a CSV file
+func showCSVImport(c *gin.Context) {
+	c.HTML(http.StatusOK, "import_csv.html", gin.H{
+		"imported": c.Query("imported"),
+		"projects": c.Query("projects"),
+		"errors":   ValidationErrors{},
+		"current":  "log",
+	})
+}
+
+// Handle the CSV import form: read an uploaded file, or the one uploaded
+// before, map its columns, and show a dry run of the import, or import it
+// if there are no errors
+func importCSVForm(c *gin.Context) {
+
+	// File uploaded, or its contents from the form after upload
+	data, filename := c.PostForm("data"), c.PostForm("filename")
+	uploaded := false
+	if file, err := c.FormFile("csv"); err == nil {
+		if file.Size > maxCSVSize {
+			showCSVUploadError(c, fmt.Sprintf("File cannot be larger than %d MB", maxCSVSize>>20))
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			panic("importCSVForm open: " + err.Error())
+		}
+		defer f.Close()
+		var b bytes.Buffer
+		_, err = io.Copy(&b, f)
+		if err != nil {
+			panic("importCSVForm read: " + err.Error())
+		}
+		data, filename, uploaded = b.String(), file.Filename, true
+	}
+	if data == "" {
+		showCSVUploadError(c, "Please choose a CSV file")
+		return
+	}
+	records, err := readCSV(data)
+	if err != nil {
+		showCSVUploadError(c, "Could not read "+filename+": "+err.Error())
+		return
+	}
+
+	// Mapping guessed from the column names for a new file, otherwise from
+	// the form, and the rows as they would be imported
+	headers := records[0]
+	m := guessCSVMapping(records)
+	if !uploaded {
+		m = parseCSVMapping(c, len(headers))
+	}
+	memberId := 0
+	if me, found := currentMember(c); found {
+		memberId = me.Id
+	}
+	rows, newClients, newProjects := csvRows(records, m, memberId)
+	errorCount := validateCSVRows(rows)
+
+	// Import if asked and there are no errors, otherwise show the dry run
+	if c.PostForm("action") == "import" && errorCount == 0 && len(rows) > 0 {
+		entries := []Work{}
+		for _, row := range rows {
+			entries = append(entries, row.Work)
+		}
+		importWork(newClients, newProjects, entries)
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/import_csv?imported=%d&projects=%d", len(entries), len(newProjects)))
+		return
+	}
+
+	// Columns to choose from, with the value in the first row
+	type column struct {
+		Index int
+		Label string
+	}
+	columns := []column{}
+	for i, h := range headers {
+		label := h
+		if sample := records[1]; i < len(sample) && sample[i] != "" {
+			label += " (" + sample[i] + ")"
+		}
+		columns = append(columns, column{i, label})
+	}
+	type field struct {
+		CSVField
+		Column int
+	}
+	fields := []field{}
+	for _, f := range csvFields {
+		fields = append(fields, field{f, m.Columns[f.Name]})
+	}
+	var hours float64
+	for _, row := range rows {
+		hours += row.Work.Hours
+	}
+
+	status := http.StatusOK
+	if c.PostForm("action") == "import" {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "import_csv.html", gin.H{
+		"data":        data,
+		"filename":    filename,
+		"columns":     columns,
+		"fields":      fields,
+		"dateFormats": csvDateFormats,
+		"categories":  projectCategories,
+		"mapping":     m,
+		"rows":        rows,
+		"errorCount":  errorCount,
+		"newProjects": newProjects,
+		"hours":       hours,
+		"errors":      ValidationErrors{},
+		"current":     "log",
+	})
+}
+
+// Show the upload form again, with an error about the file
+func showCSVUploadError(c *gin.Context, msg string) {
+	c.HTML(http.StatusUnprocessableEntity, "import_csv.html", gin.H{
+		"errors":  ValidationErrors{"csv": msg},
+		"current": "log",
+	})
+}
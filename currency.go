@@ -0,0 +1,179 @@
+// Currencies. Each project's rate, fees and revenue are in the project's
+// currency if set, otherwise its client's currency, otherwise the base
+// currency from settings. Amounts are converted to the base currency for
+// reports using exchange rates maintained on the exchange rates page: each
+// rate applies from its date until the next rate for the same currency.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Base currency if not set
+const defaultBaseCurrency = "USD"
+
+// Base currency from settings
+func baseCurrency() string {
+	return getSetting("base_currency", defaultBaseCurrency)
+}
+
+// Check that a currency code is three capital letters
+func validCurrency(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Currency for a project, given client currencies and base currency
+func projectCurrency(p Project, clientCurrencies map[string]string, base string) string {
+	if p.Currency != "" {
+		return p.Currency
+	}
+	if cur := clientCurrencies[p.Client]; cur != "" {
+		return cur
+	}
+	return base
+}
+
+// Currency for one project, looking up client and base currencies
+func getProjectCurrency(p Project) string {
+	return projectCurrency(p, getClientCurrencies(), baseCurrency())
+}
+
+// Currency for a client, or the base currency if none set
+func clientCurrency(client string) string {
+	if cur := getClientCurrencies()[client]; cur != "" {
+		return cur
+	}
+	return baseCurrency()
+}
+
+// Converts amounts between currencies, using exchange rates loaded once
+type Converter struct {
+	Base  string
+	rates map[string][]ExchangeRate // for each currency, sorted by date
+}
+
+// Make a converter with all exchange rates from the database
+func newConverter() *Converter {
+	cv := Converter{Base: baseCurrency(), rates: map[string][]ExchangeRate{}}
+	for _, r := range getExchangeRates() {
+		cv.rates[r.Currency] = append(cv.rates[r.Currency], r)
+	}
+	return &cv
+}
+
+// Value of one unit of a currency in the base currency on a date: the most
+// recent rate on or before the date, or the earliest rate if the date is
+// before all of them. Returns false if there is no rate for the currency.
+func (cv *Converter) rate(currency, date string) (float64, bool) {
+	if currency == cv.Base || currency == "" {
+		return 1, true
+	}
+	rr := cv.rates[currency]
+	if len(rr) == 0 {
+		return 0, false
+	}
+	i := sort.Search(len(rr), func(i int) bool { return rr[i].RateDate > date })
+	if i == 0 {
+		return rr[0].Rate, true
+	}
+	return rr[i-1].Rate, true
+}
+
+// Convert an amount from one currency to another at the rates on a date.
+// Returns false if either currency has no exchange rate.
+func (cv *Converter) Convert(amount float64, from, to, date string) (float64, bool) {
+	if from == to {
+		return amount, true
+	}
+	fromRate, ok1 := cv.rate(from, date)
+	toRate, ok2 := cv.rate(to, date)
+	if !ok1 || !ok2 || toRate == 0 {
+		return 0, false
+	}
+	return amount * fromRate / toRate, true
+}
+
+// Convert an amount to the base currency at the rate on a date
+func (cv *Converter) ToBase(amount float64, from, date string) (float64, bool) {
+	return cv.Convert(amount, from, cv.Base, date)
+}
+
+// Page showing exchange rates, with a form to add one
+func showExchangeRates(c *gin.Context) {
+	showExchangeRatesPage(c, ExchangeRate{RateDate: time.Now().Format("2006-01-02")}, ValidationErrors{})
+}
+
+// Show the exchange rates page, with the form filled in and any errors
+func showExchangeRatesPage(c *gin.Context, r ExchangeRate, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "exchange_rates.html", gin.H{
+		"rates":   getExchangeRates(),
+		"base":    baseCurrency(),
+		"r":       r,
+		"errors":  errs,
+		"current": "settings",
+	})
+}
+
+// Handle form submission to add an exchange rate
+func saveExchangeRateForm(c *gin.Context) {
+
+	errs := ValidationErrors{}
+	r := ExchangeRate{
+		Currency: strings.ToUpper(strings.TrimSpace(c.PostForm("currency"))),
+		RateDate: c.PostForm("rate_date"),
+	}
+	if !validCurrency(r.Currency) {
+		errs["currency"] = "Please enter a three-letter currency code, e.g. EUR"
+	} else if r.Currency == baseCurrency() {
+		errs["currency"] = "No rate is needed for the base currency"
+	}
+	if _, err := time.Parse("2006-01-02", r.RateDate); err != nil {
+		errs["rate_date"] = "Please enter a valid date (YYYY-MM-DD)"
+	}
+	rate, err := strconv.ParseFloat(c.PostForm("rate"), 64)
+	if err != nil || rate <= 0 {
+		errs["rate"] = "Rate must be a number more than zero"
+	}
+	r.Rate = rate
+
+	if len(errs) > 0 {
+		showExchangeRatesPage(c, r, errs)
+		return
+	}
+
+	saveExchangeRate(r)
+	c.Redirect(http.StatusSeeOther, "/exchange_rates")
+}
+
+// Handle deletion of an exchange rate
+func deleteExchangeRateHandler(c *gin.Context) {
+
+	// Get rate ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid exchange rate ID")
+		return
+	}
+
+	deleteExchangeRate(id)
+	c.Redirect(http.StatusSeeOther, "/exchange_rates")
+}
@@ -12,6 +12,8 @@ import (
 	"database/sql"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -54,6 +56,15 @@ func getMaxId(tableName string) int {
 	return int(maxId.Int64)
 }
 
+// Trim a date read from a "date" column to YYYY-MM-DD, since the driver
+// returns these as timestamps (e.g., "2025-01-01T00:00:00Z")
+func dateOnly(s string) string {
+	if len(s) > 10 {
+		return s[:10]
+	}
+	return s
+}
+
 //------------------------------------------------------------------//
 //                          P R O J E C T S                         //
 //------------------------------------------------------------------//
@@ -61,19 +72,47 @@ func getMaxId(tableName string) int {
 // Record format for one project
 type Project struct {
 	Id          int
-	Client      string
+	ClientId    int    // client, 0 if none
+	Client      string // client name, joined from client table
 	Name        string
 	Description string
 	Category    string // Billable, CD, IP, Training, Absent, Other
 	Active      bool
+	Rate        float64 // hourly rate, 0 to use client or default rate
+	Fees        float64 // agreed fees (fee budget) for the whole project, if any
+	BudgetHours float64 // hours budget, if any
+	Estimate    float64 // estimated hours to complete the project, if any
+	Complete    float64 // percent complete, updated manually
+	Currency    string  // currency of rate and fees, blank for client's or base currency
 	// The following fields are calculated
-	Logs             int     // number of work entries
-	Earliest, Latest string  // earliest & latest date
-	Hours            float64 // total hours
+	Logs              int     // number of work entries
+	Earliest, Latest  string  // earliest & latest date
+	Hours             float64 // total hours
+	BillableHours     float64 // total billable hours
+	EffectiveRate     float64 // hourly rate actually applied (see rates.go)
+	Revenue           float64 // billable hours times effective rate
+	EffectiveCurrency string  // currency actually used (see currency.go)
+	BaseRevenue       float64 // revenue in the base currency, for reports
+	BudgetUsed        float64 // percent of hours or fee budget used (see budget.go)
+	BudgetAlert       float64 // highest alert threshold crossed, 0 if none
+	BudgetOver        bool    // true if the highest threshold was crossed
+	Forecast          float64 // estimate at completion (see progress.go)
+}
+
+// Work on a project is billable by default if its category is "Billable"
+func (p Project) IsBillable() bool {
+	return p.Category == "Billable"
 }
 
 // Get a list of all projects, sorted by client, name
 func getProjects() []Project {
+	return getProjectsBetween("0000-00-00", "9999-99-99")
+}
+
+// Get a list of all projects, sorted by client, name, with calculated
+// fields only for work between dates [startDate, endDate] inclusive. Work
+// on the project's tasks and subtasks is counted in the project's totals.
+func getProjectsBetween(startDate, endDate string) []Project {
 
 	// Connect to database
 	db := dbConnect()
@@ -81,12 +120,16 @@ func getProjects() []Project {
 
 	// Execute query to get all projects
 	//rows, err := db.Query("select id, client, name, description, category, active from project order by client, name")
-	q := "select p.id, p.client, p.name, p.description, p.category, p.active, "
-	q += "coalesce(min(w.work_date), 'n/a'), coalesce(max(w.work_date), 'n/a'), coalesce(count(w.id), 0), coalesce(sum(w.hours), 0) "
-	q += "from project as p left outer join work as w on p.id = w.project_id "
+	q := "select p.id, coalesce(p.client_id, 0), coalesce(cl.name, trim(p.client), ''), p.name, p.description, p.category, p.active, coalesce(p.rate, 0), coalesce(p.fees, 0), coalesce(p.budget_hours, 0), "
+	q += "coalesce(p.estimate, 0), coalesce(p.complete, 0), coalesce(p.currency, ''), "
+	q += "coalesce(min(w.work_date), 'n/a'), coalesce(max(w.work_date), 'n/a'), coalesce(count(w.id), 0), coalesce(sum(w.hours), 0), "
+	q += "coalesce(sum(case when w.billable = 1 then w.hours else 0 end), 0) "
+	q += "from project as p left outer join client as cl on p.client_id = cl.id "
+	q += "left outer join work as w on p.id = w.project_id "
+	q += "and substr(w.work_date, 1, 10) >= ? and substr(w.work_date, 1, 10) <= ? "
 	q += "group by p.id " // p.client, p.name, p.description, p.category, p.active "
-	q += "order by p.client, p.name"
-	rows, err := db.Query(q)
+	q += "order by coalesce(cl.name, trim(p.client), ''), p.name"
+	rows, err := db.Query(q, startDate, endDate)
 	if err != nil {
 		panic("getProjects query: " + err.Error())
 	}
@@ -96,7 +139,8 @@ func getProjects() []Project {
 	pp := []Project{}
 	for rows.Next() {
 		p := Project{}
-		err := rows.Scan(&p.Id, &p.Client, &p.Name, &p.Description, &p.Category, &p.Active, &p.Earliest, &p.Latest, &p.Logs, &p.Hours)
+		err := rows.Scan(&p.Id, &p.ClientId, &p.Client, &p.Name, &p.Description, &p.Category, &p.Active, &p.Rate, &p.Fees, &p.BudgetHours,
+			&p.Estimate, &p.Complete, &p.Currency, &p.Earliest, &p.Latest, &p.Logs, &p.Hours, &p.BillableHours)
 		if err != nil {
 			panic("getProjects next: " + err.Error())
 		}
@@ -110,6 +154,11 @@ func getProjects() []Project {
 	return pp
 }
 
+// Columns selected for one project, with client joined as cl
+const projectColumns = `p.id, coalesce(p.client_id, 0), coalesce(cl.name, trim(p.client), ''), p.name, p.description, p.category, p.active,
+                        coalesce(p.rate, 0), coalesce(p.fees, 0), coalesce(p.budget_hours, 0), coalesce(p.estimate, 0),
+                        coalesce(p.complete, 0), coalesce(p.currency, '')`
+
 // Get one project by ID
 func getProject(id int) Project {
 
@@ -119,8 +168,9 @@ func getProject(id int) Project {
 
 	// Execute query to get one project
 	var p Project
-	err := db.QueryRow("select id, client, name, description, category, active from project where id = ?", id).
-		Scan(&p.Id, &p.Client, &p.Name, &p.Description, &p.Category, &p.Active)
+	err := db.QueryRow("select "+projectColumns+" from project p left join client cl on p.client_id = cl.id where p.id = ?", id).
+		Scan(&p.Id, &p.ClientId, &p.Client, &p.Name, &p.Description, &p.Category, &p.Active, &p.Rate, &p.Fees, &p.BudgetHours,
+			&p.Estimate, &p.Complete, &p.Currency)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			panic("getProject: project with id " + fmt.Sprintf("%d", id) + " not found")
@@ -132,6 +182,27 @@ func getProject(id int) Project {
 	return p
 }
 
+// Look up one project by ID, returning false if it does not exist
+func findProject(id int) (Project, bool) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Execute query to get one project
+	var p Project
+	err := db.QueryRow("select "+projectColumns+" from project p left join client cl on p.client_id = cl.id where p.id = ?", id).
+		Scan(&p.Id, &p.ClientId, &p.Client, &p.Name, &p.Description, &p.Category, &p.Active, &p.Rate, &p.Fees, &p.BudgetHours,
+			&p.Estimate, &p.Complete, &p.Currency)
+	if err == sql.ErrNoRows {
+		return p, false
+	}
+	if err != nil {
+		panic("findProject: " + err.Error())
+	}
+	return p, true
+}
+
 // Save a project (insert if Id is zero, update if Id is nonzero)
 // Returns the project ID
 func saveProject(p Project) int {
@@ -145,24 +216,41 @@ func saveProject(p Project) int {
 		nextId := getMaxId("project") + 1
 		p.Id = nextId
 
-		// Insert new project
-		_, err := db.Exec("insert into project (id, client, name, description, category, active) values (?, ?, ?, ?, ?, ?)",
-			p.Id, p.Client, p.Name, p.Description, p.Category, p.Active)
+		// Insert new project (legacy billable column kept in sync with category)
+		_, err := db.Exec("insert into project (id, client_id, name, description, category, billable, active, rate, fees, budget_hours, estimate, complete, currency) values (?, nullif(?, 0), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			p.Id, p.ClientId, p.Name, p.Description, p.Category, p.IsBillable(), p.Active, p.Rate, p.Fees, p.BudgetHours, p.Estimate, p.Complete, p.Currency)
 		if err != nil {
 			panic("saveProject insert: " + err.Error())
 		}
 	} else {
 		// Update existing project
-		_, err := db.Exec("update project set client=?, name=?, description=?, category=?, active=? where id=?",
-			p.Client, p.Name, p.Description, p.Category, p.Active, p.Id)
+		_, err := db.Exec("update project set client_id=nullif(?, 0), name=?, description=?, category=?, billable=?, active=?, rate=?, fees=?, budget_hours=?, estimate=?, complete=?, currency=? where id=?",
+			p.ClientId, p.Name, p.Description, p.Category, p.IsBillable(), p.Active, p.Rate, p.Fees, p.BudgetHours, p.Estimate, p.Complete, p.Currency, p.Id)
 		if err != nil {
 			panic("saveProject update: " + err.Error())
 		}
 	}
+	indexForSearch("project", p.Id)
 	return p.Id
 }
 
-// Delete a project and all its child records (work and project_contact)
+// Update just the percent complete of a project
+func saveProjectComplete(id int, complete float64) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("update project set complete=? where id=?", complete, id)
+	if err != nil {
+		panic("saveProjectComplete: " + err.Error())
+	}
+}
+
+// Delete a project and all its child records (work and its tags, tasks,
+// expenses, project_contact, work_template, calendar feeds and meeting
+// rules), and unlink absences that log hours on it and pending meetings
+// proposed for it
 func deleteProject(id int) {
 
 	// Connect to database
@@ -175,13 +263,40 @@ func deleteProject(id int) {
 		panic("deleteProject begin: " + err.Error())
 	}
 
-	// Delete all work records for this project
+	// Delete all work records for this project, with their tags and search
+	// text
+	_, err = tx.Exec("delete from work_tag where work_id in (select id from work where project_id = ?)", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteProject work_tag: " + err.Error())
+	}
+	if ftsAvailable {
+		_, err = tx.Exec("delete from search_index where kind = 'work' and item_id in (select id from work where project_id = ?)", id)
+		if err != nil {
+			tx.Rollback()
+			panic("deleteProject search_index: " + err.Error())
+		}
+	}
 	_, err = tx.Exec("delete from work where project_id = ?", id)
 	if err != nil {
 		tx.Rollback()
 		panic("deleteProject work: " + err.Error())
 	}
 
+	// Delete all tasks for this project
+	_, err = tx.Exec("delete from task where project_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteProject task: " + err.Error())
+	}
+
+	// Delete all expenses for this project
+	_, err = tx.Exec("delete from expense where project_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteProject expense: " + err.Error())
+	}
+
 	// Delete all project_contact records for this project
 	_, err = tx.Exec("delete from project_contact where project_id = ?", id)
 	if err != nil {
@@ -189,6 +304,40 @@ func deleteProject(id int) {
 		panic("deleteProject project_contact: " + err.Error())
 	}
 
+	// Delete all work templates for this project
+	_, err = tx.Exec("delete from work_template where project_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteProject work_template: " + err.Error())
+	}
+
+	// Delete calendar feeds of the project's work
+	_, err = tx.Exec("delete from feed where project_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteProject feed: " + err.Error())
+	}
+
+	// Delete rules proposing the project for meetings, and leave pending
+	// meetings without a proposed project
+	_, err = tx.Exec("delete from meeting_rule where project_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteProject meeting_rule: " + err.Error())
+	}
+	_, err = tx.Exec("update meeting set project_id = null where project_id = ? and status = 'pending'", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteProject meeting: " + err.Error())
+	}
+
+	// Absences no longer log hours on the project
+	_, err = tx.Exec("update absence set project_id = null where project_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteProject absence: " + err.Error())
+	}
+
 	// Delete the project itself
 	_, err = tx.Exec("delete from project where id = ?", id)
 	if err != nil {
@@ -202,6 +351,171 @@ func deleteProject(id int) {
 		tx.Rollback()
 		panic("deleteProject commit: " + err.Error())
 	}
+	indexForSearch("project", id)
+}
+
+//------------------------------------------------------------------//
+//                             T A S K S                            //
+//------------------------------------------------------------------//
+
+// Record format for one task within a project, which may be a subtask of
+// another task in the same project
+type Task struct {
+	Id        int
+	ProjectId int
+	ParentId  int // parent task, 0 for a top-level task
+	Name      string
+	Active    bool
+	// The following fields are calculated (see tasks.go)
+	Depth         int     // 0 for top-level tasks, 1 for their subtasks, etc.
+	Path          string  // names from the top-level task down, e.g. "Design / Wireframes"
+	Logs          int     // number of work entries, including subtasks
+	Hours         float64 // total hours, including subtasks
+	BillableHours float64 // total billable hours, including subtasks
+}
+
+// Get the tasks of one project (or of all projects if projectId is 0), in
+// tree order with hours rolled up from subtasks to their parents
+func getTasks(projectId int) []Task {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Execute query to get tasks, with totals of work logged on each
+	q := `select t.id, t.project_id, coalesce(t.parent_id, 0), t.name, t.active,
+	      count(w.id), coalesce(sum(w.hours), 0),
+	      coalesce(sum(case when w.billable = 1 then w.hours else 0 end), 0)
+	      from task t
+	      left join work w on w.task_id = t.id
+	      where ? = 0 or t.project_id = ?
+	      group by t.id
+	      order by t.project_id, lower(t.name)`
+	rows, err := db.Query(q, projectId, projectId)
+	if err != nil {
+		panic("getTasks query: " + err.Error())
+	}
+	defer rows.Close()
+
+	// Collect into a list
+	tt := []Task{}
+	for rows.Next() {
+		var t Task
+		var active string
+		err := rows.Scan(&t.Id, &t.ProjectId, &t.ParentId, &t.Name, &active, &t.Logs, &t.Hours, &t.BillableHours)
+		if err != nil {
+			panic("getTasks next: " + err.Error())
+		}
+		t.Active = active == "1" || active == "true"
+		tt = append(tt, t)
+	}
+	if rows.Err() != nil {
+		panic("getTasks exit: " + rows.Err().Error())
+	}
+
+	// Arrange as a tree, and return list
+	return taskTree(tt)
+}
+
+// Look up one task by ID, returning false if it does not exist
+func findTask(id int) (Task, bool) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var t Task
+	var active string
+	err := db.QueryRow("select id, project_id, coalesce(parent_id, 0), name, active from task where id = ?", id).
+		Scan(&t.Id, &t.ProjectId, &t.ParentId, &t.Name, &active)
+	if err == sql.ErrNoRows {
+		return t, false
+	}
+	if err != nil {
+		panic("findTask: " + err.Error())
+	}
+	t.Active = active == "1" || active == "true"
+	return t, true
+}
+
+// Save a task (insert if Id is zero, update if Id is nonzero)
+// Returns the task ID
+func saveTask(t Task) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	if t.Id == 0 {
+		// Insert new task with next ID
+		t.Id = getMaxId("task") + 1
+		_, err := db.Exec("insert into task (id, project_id, parent_id, name, active) values (?, ?, ?, ?, ?)",
+			t.Id, t.ProjectId, t.ParentId, t.Name, t.Active)
+		if err != nil {
+			panic("saveTask insert: " + err.Error())
+		}
+	} else {
+		// Update existing task (it stays in the same project)
+		_, err := db.Exec("update task set parent_id=?, name=?, active=? where id=?",
+			t.ParentId, t.Name, t.Active, t.Id)
+		if err != nil {
+			panic("saveTask update: " + err.Error())
+		}
+	}
+	return t.Id
+}
+
+// Delete a task, moving its subtasks and work entries up to its parent task
+// (or to no task, if it is a top-level task)
+func deleteTask(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("deleteTask begin: " + err.Error())
+	}
+
+	// Parent of the task being deleted
+	var parentId int
+	err = tx.QueryRow("select coalesce(parent_id, 0) from task where id = ?", id).Scan(&parentId)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		panic("deleteTask parent: " + err.Error())
+	}
+
+	// Move subtasks and work entries up
+	_, err = tx.Exec("update task set parent_id = ? where parent_id = ?", parentId, id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteTask subtasks: " + err.Error())
+	}
+	_, err = tx.Exec("update work set task_id = ? where task_id = ?", parentId, id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteTask work: " + err.Error())
+	}
+
+	// Delete the task itself
+	_, err = tx.Exec("delete from task where id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteTask task: " + err.Error())
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("deleteTask commit: " + err.Error())
+	}
 }
 
 //------------------------------------------------------------------//
@@ -212,35 +526,118 @@ func deleteProject(id int) {
 type Work struct {
 	Id          int
 	ProjectId   int
+	TaskId      int    // task within the project, 0 if none
 	WorkDate    string // date as string
+	StartTime   string // time of day work started, "HH:MM", blank if not recorded
+	EndTime     string // time of day work ended, "HH:MM", blank if not recorded
 	Hours       float64
 	Billable    bool
 	Description string
-	// Joined fields from project
+	InvoiceId   int      // invoice this entry was billed on, 0 if not yet billed
+	MemberId    int      // team member who did the work, 0 if not recorded
+	Status      string   // draft, submitted, approved or rejected
+	Tags        []string // free-form tags, e.g. "meeting", from work_tag table
+	// Joined fields from project, task and member
 	ProjectName string
 	Client      string
+	TaskName    string
+	MemberName  string
+	// Calculated fields
+	Revenue float64 // hours times project rate, if billable
+}
+
+// Filter for work entries on the activity log, blank or zero fields match
+// all entries
+type LogFilter struct {
+	From, To  string // dates, inclusive
+	ProjectId int
+	ClientId  int
+	Category  string // project category
+	Billable  string // "yes" or "no"
+	Search    string // text in description, project or client name
+	Tag       string
+}
+
+// Position in the activity log, the date and ID of one entry
+type LogCursor struct {
+	Date string
+	Id   int
 }
 
-// Cutoff year for work entries
-const cutoffDate = "2025-01-01"
+// Make the where clause for a log filter, with arguments, for a query on
+// work w joined with project p and client cl
+func (f LogFilter) where() (string, []interface{}) {
+	clauses := []string{"1 = 1"}
+	args := []interface{}{}
+	if f.From != "" {
+		clauses = append(clauses, "substr(w.work_date, 1, 10) >= ?")
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		clauses = append(clauses, "substr(w.work_date, 1, 10) <= ?")
+		args = append(args, f.To)
+	}
+	if f.ProjectId != 0 {
+		clauses = append(clauses, "w.project_id = ?")
+		args = append(args, f.ProjectId)
+	}
+	if f.ClientId != 0 {
+		clauses = append(clauses, "p.client_id = ?")
+		args = append(args, f.ClientId)
+	}
+	if f.Category != "" {
+		clauses = append(clauses, "p.category = ?")
+		args = append(args, f.Category)
+	}
+	switch f.Billable {
+	case "yes":
+		clauses = append(clauses, "w.billable = 1")
+	case "no":
+		clauses = append(clauses, "coalesce(w.billable, 0) <> 1")
+	}
+	if f.Search != "" {
+		like := "%" + f.Search + "%"
+		clauses = append(clauses, "(w.description like ? or p.name like ? or coalesce(cl.name, trim(p.client), '') like ?)")
+		args = append(args, like, like, like)
+	}
+	if f.Tag != "" {
+		clauses = append(clauses, "exists (select 1 from work_tag t where t.work_id = w.id and t.tag = ?)")
+		args = append(args, f.Tag)
+	}
+	return strings.Join(clauses, " and "), args
+}
 
-// Get all work entries, sorted by date (increasing)
-func getWorkEntries() []Work {
+// Get one page of work entries matching a filter, newest first. With no
+// cursor, the page is the newest entries. Otherwise it is the entries just
+// older than the cursor, or just newer if newer is true.
+func getWorkEntriesPage(f LogFilter, cursor LogCursor, newer bool, limit int) []Work {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	// Execute query to get all work entries with project info
+	// Filter, and position after the cursor in the direction wanted
+	where, args := f.where()
+	order := "desc"
+	if cursor.Id != 0 {
+		op := "<"
+		if newer {
+			op, order = ">", "asc"
+		}
+		where += " and (substr(w.work_date, 1, 10) " + op + " ? or (substr(w.work_date, 1, 10) = ? and w.id " + op + " ?))"
+		args = append(args, cursor.Date, cursor.Date, cursor.Id)
+	}
 	query := `select w.id, w.project_id, w.work_date, w.hours, w.billable, w.description,
-	          p.name as project_name, p.client
+	          p.name as project_name, coalesce(cl.name, trim(p.client), '')
 	          from work w
 	          left join project p on w.project_id = p.id
-	          where w.work_date >= ?
-	          order by w.work_date, w.id`
-	rows, err := db.Query(query, cutoffDate)
+	          left join client cl on p.client_id = cl.id
+	          where ` + where + `
+	          order by substr(w.work_date, 1, 10) ` + order + `, w.id ` + order + `
+	          limit ?`
+	rows, err := db.Query(query, append(args, limit)...)
 	if err != nil {
-		panic("getWorkEntries query: " + err.Error())
+		panic("getWorkEntriesPage query: " + err.Error())
 	}
 	defer rows.Close()
 
@@ -252,7 +649,7 @@ func getWorkEntries() []Work {
 		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &hrs, &billable, &w.Description,
 			&w.ProjectName, &w.Client)
 		if err != nil {
-			panic("getWorkEntries next: " + err.Error())
+			panic("getWorkEntriesPage next: " + err.Error())
 		}
 
 		// Convert some fields
@@ -261,35 +658,109 @@ func getWorkEntries() []Work {
 		}
 		w.Hours, err = strconv.ParseFloat(hrs, 64)
 		if err != nil {
-			fmt.Printf("getWorkEntries: invalid hours \"%s\"\n", hrs)
 			w.Hours = 0
 		}
-		w.Billable = billable == "1"
+		w.Billable = billable == "1" || billable == "true"
 
 		// Add to list
 		ww = append(ww, w)
 	}
 	if rows.Err() != nil {
-		panic("getWorkEntries exit: " + err.Error())
+		panic("getWorkEntriesPage exit: " + rows.Err().Error())
 	}
 
-	// Return list
-	fmt.Printf("getWorkEntries: %d rows\n", len(ww))
+	// Newer entries were read oldest first, turn them around
+	if newer {
+		for i, j := 0, len(ww)-1; i < j; i, j = i+1, j-1 {
+			ww[i], ww[j] = ww[j], ww[i]
+		}
+	}
 	return ww
 }
 
-// Get one work entry by ID
+// Get the number of work entries matching a filter, and their total hours
+func getWorkTotal(f LogFilter) (int, float64) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	where, args := f.where()
+	var count int
+	var hours float64
+	err := db.QueryRow(`select count(w.id), coalesce(sum(w.hours), 0)
+	                    from work w
+	                    left join project p on w.project_id = p.id
+	                    left join client cl on p.client_id = cl.id
+	                    where `+where, args...).Scan(&count, &hours)
+	if err != nil {
+		panic("getWorkTotal: " + err.Error())
+	}
+	return count, hours
+}
+
+// Get total hours of work entries matching a filter on each day between
+// dates [startDate, endDate] inclusive, by date
+func getWorkHoursByDay(f LogFilter, startDate, endDate string) map[string]float64 {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	where, args := f.where()
+	rows, err := db.Query(`select substr(w.work_date, 1, 10), coalesce(sum(w.hours), 0)
+	                       from work w
+	                       left join project p on w.project_id = p.id
+	                       left join client cl on p.client_id = cl.id
+	                       where `+where+` and substr(w.work_date, 1, 10) >= ? and substr(w.work_date, 1, 10) <= ?
+	                       group by substr(w.work_date, 1, 10)`, append(args, startDate, endDate)...)
+	if err != nil {
+		panic("getWorkHoursByDay query: " + err.Error())
+	}
+	defer rows.Close()
+
+	hours := map[string]float64{}
+	for rows.Next() {
+		var date string
+		var h float64
+		err := rows.Scan(&date, &h)
+		if err != nil {
+			panic("getWorkHoursByDay next: " + err.Error())
+		}
+		hours[date] = h
+	}
+	if rows.Err() != nil {
+		panic("getWorkHoursByDay exit: " + rows.Err().Error())
+	}
+	return hours
+}
+
+// Get one work entry by ID, which must exist
 func getWorkEntry(id int) Work {
+	w, found := findWork(id)
+	if !found {
+		panic(fmt.Sprintf("getWorkEntry: work entry with id %d not found", id))
+	}
+	return w
+}
+
+// Look up one work entry by ID, returning false if there is none
+func findWork(id int) (Work, bool) {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
 	// Execute query to get one work entry with project info
-	query := `select w.id, w.project_id, w.work_date, w.hours, w.billable, w.description,
-	          p.name as project_name, p.client
+	query := `select w.id, w.project_id, coalesce(w.task_id, 0), w.work_date, coalesce(w.start_time, ''),
+	          coalesce(w.end_time, ''), w.hours, w.billable, w.description,
+	          coalesce(w.invoice_id, 0), coalesce(w.member_id, 0), coalesce(w.status, 'draft'),
+	          p.name as project_name, coalesce(cl.name, trim(p.client), ''), coalesce(t.name, ''), coalesce(m.name, '')
 	          from work w
 	          left join project p on w.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          left join task t on w.task_id = t.id
+	          left join member m on w.member_id = m.id
 	          where w.id = ?`
 	var w Work
 	var workDate sql.NullString
@@ -299,13 +770,13 @@ func getWorkEntry(id int) Work {
 	var projectName sql.NullString
 	var client sql.NullString
 
-	err := db.QueryRow(query, id).Scan(&w.Id, &w.ProjectId, &workDate, &hours, &billable, &description,
-		&projectName, &client)
+	err := db.QueryRow(query, id).Scan(&w.Id, &w.ProjectId, &w.TaskId, &workDate, &w.StartTime, &w.EndTime, &hours, &billable, &description,
+		&w.InvoiceId, &w.MemberId, &w.Status, &projectName, &client, &w.TaskName, &w.MemberName)
+	if err == sql.ErrNoRows {
+		return w, false
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			panic("getWorkEntry: work entry with id " + fmt.Sprintf("%d", id) + " not found")
-		}
-		panic("getWorkEntry: " + err.Error())
+		panic("findWork: " + err.Error())
 	}
 
 	if workDate.Valid {
@@ -326,9 +797,10 @@ func getWorkEntry(id int) Work {
 	if client.Valid {
 		w.Client = client.String
 	}
+	w.Tags = getWorkTags(w.Id)
 
 	// Return work entry
-	return w
+	return w, true
 }
 
 // Get work entries between dates [startDate, endDate] inclusive, sorted by date
@@ -339,10 +811,12 @@ func getWorkEntriesBetween(startDate, endDate string) []Work {
 	defer db.Close()
 
 	// Query with project info
-	query := `select w.id, w.project_id, w.work_date, w.hours, w.billable, w.description,
-	          p.name as project_name, p.client
+	query := `select w.id, w.project_id, w.work_date, coalesce(w.start_time, ''), coalesce(w.end_time, ''),
+	          w.hours, w.billable, w.description, coalesce(w.member_id, 0),
+	          p.name as project_name, coalesce(cl.name, trim(p.client), '')
 	          from work w
 	          left join project p on w.project_id = p.id
+	          left join client cl on p.client_id = cl.id
 	          where w.work_date >= ? and w.work_date <= ?
 	          order by w.work_date, w.id`
 	rows, err := db.Query(query, startDate, endDate)
@@ -355,7 +829,8 @@ func getWorkEntriesBetween(startDate, endDate string) []Work {
 	for rows.Next() {
 		w := Work{}
 		var hrs, billable string
-		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &hrs, &billable, &w.Description, &w.ProjectName, &w.Client)
+		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &w.StartTime, &w.EndTime, &hrs, &billable, &w.Description,
+			&w.MemberId, &w.ProjectName, &w.Client)
 		if err != nil {
 			panic("getWorkEntriesBetween next: " + err.Error())
 		}
@@ -366,7 +841,7 @@ func getWorkEntriesBetween(startDate, endDate string) []Work {
 		if err != nil {
 			w.Hours = 0
 		}
-		w.Billable = billable == "1"
+		w.Billable = billable == "1" || billable == "true"
 		entries = append(entries, w)
 	}
 	if rows.Err() != nil {
@@ -382,10 +857,12 @@ func getWorkEntriesForProject(projectId int) []Work {
 	db := dbConnect()
 	defer db.Close()
 
-	query := `select w.id, w.project_id, w.work_date, w.hours, w.billable, w.description,
-	          p.name as project_name, p.client
+	query := `select w.id, w.project_id, coalesce(w.task_id, 0), w.work_date, w.hours, w.billable, w.description,
+	          coalesce(w.member_id, 0), p.name as project_name, coalesce(cl.name, trim(p.client), ''), coalesce(t.name, '')
 	          from work w
 	          left join project p on w.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          left join task t on w.task_id = t.id
 	          where w.project_id = ?
 	          order by w.work_date, w.id`
 	rows, err := db.Query(query, projectId)
@@ -398,8 +875,8 @@ func getWorkEntriesForProject(projectId int) []Work {
 	for rows.Next() {
 		w := Work{}
 		var hrs, billable string
-		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &hrs, &billable, &w.Description,
-			&w.ProjectName, &w.Client)
+		err := rows.Scan(&w.Id, &w.ProjectId, &w.TaskId, &w.WorkDate, &hrs, &billable, &w.Description,
+			&w.MemberId, &w.ProjectName, &w.Client, &w.TaskName)
 		if err != nil {
 			panic("getWorkEntriesForProject next: " + err.Error())
 		}
@@ -410,7 +887,7 @@ func getWorkEntriesForProject(projectId int) []Work {
 		if err != nil {
 			w.Hours = 0
 		}
-		w.Billable = billable == "1"
+		w.Billable = billable == "1" || billable == "true"
 		list = append(list, w)
 	}
 	if rows.Err() != nil {
@@ -419,314 +896,3720 @@ func getWorkEntriesForProject(projectId int) []Work {
 	return list
 }
 
-// Delete one work entry by ID
-func deleteWork(id int) {
+// Get total hours logged on one date by one team member (0 for entries
+// without a member, -1 for everyone), excluding one work entry (e.g., the
+// one being edited, use 0 to include all)
+func getHoursForDate(date string, memberId, excludeId int) float64 {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	_, err := db.Exec("delete from work where id = ?", id)
+	var hours float64
+	err := db.QueryRow(`select coalesce(sum(hours), 0) from work where substr(work_date, 1, 10) = ? and id <> ?
+	                    and (? = -1 or coalesce(member_id, 0) = ?)`,
+		date, excludeId, memberId, memberId).Scan(&hours)
 	if err != nil {
-		panic("deleteWork: " + err.Error())
+		panic("getHoursForDate: " + err.Error())
 	}
+	return hours
 }
 
-// Save a work entry (insert if Id is zero, update if Id is nonzero)
-// Returns the work ID
-func saveWork(w Work) int {
+// Get work entries whose billable flag contradicts their project's category,
+// sorted by date
+func getBillableMismatches() []Work {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	if w.Id == 0 {
-		// Get next ID
-		nextId := getMaxId("work") + 1
-		w.Id = nextId
+	query := `select w.id, w.project_id, w.work_date, w.hours, w.billable, w.description,
+	          coalesce(w.invoice_id, 0), coalesce(w.status, 'draft'),
+	          p.name as project_name, coalesce(cl.name, trim(p.client), '')
+	          from work w
+	          inner join project p on w.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          where (w.billable = 1) <> (p.category = 'Billable')
+	          order by w.work_date, w.id`
+	rows, err := db.Query(query)
+	if err != nil {
+		panic("getBillableMismatches query: " + err.Error())
+	}
+	defer rows.Close()
 
-		// Insert new work entry
-		_, err := db.Exec("insert into work (id, project_id, work_date, hours, billable, description) values (?, ?, ?, ?, ?, ?)",
-			w.Id, w.ProjectId, w.WorkDate, w.Hours, w.Billable, w.Description)
+	list := []Work{}
+	for rows.Next() {
+		w := Work{}
+		var hrs, billable string
+		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &hrs, &billable, &w.Description,
+			&w.InvoiceId, &w.Status, &w.ProjectName, &w.Client)
 		if err != nil {
-			panic("saveWork insert: " + err.Error())
+			panic("getBillableMismatches next: " + err.Error())
 		}
-	} else {
-		// Update existing work entry
-		_, err := db.Exec("update work set project_id=?, work_date=?, hours=?, billable=?, description=? where id=?",
-			w.ProjectId, w.WorkDate, w.Hours, w.Billable, w.Description, w.Id)
+		if len(w.WorkDate) > 10 {
+			w.WorkDate = w.WorkDate[:10]
+		}
+		w.Hours, err = strconv.ParseFloat(hrs, 64)
 		if err != nil {
-			panic("saveWork update: " + err.Error())
+			w.Hours = 0
 		}
+		w.Billable = billable == "1" || billable == "true"
+		list = append(list, w)
 	}
-	return w.Id
+	if rows.Err() != nil {
+		panic("getBillableMismatches exit: " + rows.Err().Error())
+	}
+	return list
 }
 
-//------------------------------------------------------------------//
-//                          C O N T A C T S                         //
-//------------------------------------------------------------------//
-
-// Record format for one contact
-type Contact struct {
-	Id        int
-	FirstName string
-	LastName  string
-	Company   string
-	Title     string
-	Source    string
-	Phones    string
-	Emails    string
-	Address   string
-	Comments  string
-	Active    bool
-}
-
-// Get all contacts, sorted by last name (increasing)
-func getContacts() []Contact {
+// Set the billable flag of the given work entries from their project's
+// category, except those already invoiced, in a locked period, or submitted
+// or approved on a time sheet. Returns the number of entries changed.
+func reconcileBillable(ids []int) int {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	// Execute query to get all contacts
-	query := "select id, first_name, last_name, company, title, source, phones, emails, address, comments, active from contact order by last_name"
-	rows, err := db.Query(query)
+	// Update all in one transaction
+	tx, err := db.Begin()
 	if err != nil {
-		panic("getContacts query: " + err.Error())
+		panic("reconcileBillable begin: " + err.Error())
 	}
-	defer rows.Close()
-
-	// Collect into a list
-	cc := []Contact{}
-	for rows.Next() {
-		c := Contact{}
-		err := rows.Scan(&c.Id, &c.FirstName, &c.LastName, &c.Company, &c.Title, &c.Source, &c.Phones, &c.Emails, &c.Address, &c.Comments, &c.Active)
+	changed := 0
+	for _, id := range ids {
+		res, err := tx.Exec(`update work set billable =
+		                     (select p.category = 'Billable' from project p where p.id = work.project_id)
+		                     where id = ? and coalesce(invoice_id, 0) = 0 and (billable = 1) <>
+		                     (select p.category = 'Billable' from project p where p.id = work.project_id)
+		                     and coalesce(status, 'draft') not in ('submitted', 'approved')
+		                     and not `+workLockedSQL, id)
 		if err != nil {
-			panic("getContacts next: " + err.Error())
+			tx.Rollback()
+			panic("reconcileBillable update: " + err.Error())
 		}
-		cc = append(cc, c)
+		n, _ := res.RowsAffected()
+		changed += int(n)
 	}
-	if rows.Err() != nil {
-		panic("getContacts exit: " + err.Error())
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("reconcileBillable commit: " + err.Error())
 	}
-
-	// Return list
-	fmt.Printf("getContacts: %d rows\n", len(cc))
-	return cc
+	return changed
 }
 
-// Get one contact by ID
-func getContact(id int) Contact {
+// Delete one work entry by ID
+func deleteWork(id int) {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	// Execute query to get one contact
-	query := "select id, first_name, last_name, company, title, source, phones, emails, address, comments, active from contact where id = ?"
-	var c Contact
-	err := db.QueryRow(query, id).Scan(&c.Id, &c.FirstName, &c.LastName, &c.Company, &c.Title, &c.Source, &c.Phones, &c.Emails, &c.Address, &c.Comments, &c.Active)
+	_, err := db.Exec("delete from work_tag where work_id = ?", id)
 	if err != nil {
-		panic("getContact: " + err.Error())
+		panic("deleteWork tags: " + err.Error())
 	}
-
-	// Return work entry
-	return c
+	_, err = db.Exec("delete from work where id = ?", id)
+	if err != nil {
+		panic("deleteWork: " + err.Error())
+	}
+	indexForSearch("work", id)
 }
 
-// Save a contact (insert if Id is zero, update if Id is nonzero)
-// Returns the contact ID
-func saveContact(c Contact) int {
+// Save a work entry (insert if Id is zero, update if Id is nonzero)
+// Returns the work ID
+func saveWork(w Work) int {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	if c.Id == 0 {
-
+	if w.Id == 0 {
 		// Get next ID
-		nextId := getMaxId("contact") + 1
-		c.Id = nextId
+		nextId := getMaxId("work") + 1
+		w.Id = nextId
 
-		// Insert new contact
-		_, err := db.Exec("insert into contact (id, first_name, last_name, company, title, source, phones, emails, address, comments, active) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-			c.Id, c.FirstName, c.LastName, c.Company, c.Title, c.Source, c.Phones, c.Emails, c.Address, c.Comments, c.Active)
+		// Insert new work entry, as a draft
+		_, err := db.Exec(`insert into work (id, project_id, task_id, work_date, start_time, end_time, hours, billable,
+		                   description, member_id, status) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'draft')`,
+			w.Id, w.ProjectId, w.TaskId, w.WorkDate, w.StartTime, w.EndTime, w.Hours, w.Billable, w.Description, w.MemberId)
 		if err != nil {
-			panic("saveContact insert: " + err.Error())
+			panic("saveWork insert: " + err.Error())
 		}
-	} else { // Update existing contact
-
-		_, err := db.Exec("update contact set first_name=?, last_name=?, company=?, title=?, source=?, phones=?, emails=?, address=?, comments=?, active=? where id=?",
-			c.FirstName, c.LastName, c.Company, c.Title, c.Source, c.Phones, c.Emails, c.Address, c.Comments, c.Active, c.Id)
+	} else {
+		// Update existing work entry
+		_, err := db.Exec("update work set project_id=?, task_id=?, work_date=?, start_time=?, end_time=?, hours=?, billable=?, description=? where id=?",
+			w.ProjectId, w.TaskId, w.WorkDate, w.StartTime, w.EndTime, w.Hours, w.Billable, w.Description, w.Id)
 		if err != nil {
-			panic("saveContact update: " + err.Error())
+			panic("saveWork update: " + err.Error())
 		}
 	}
-	return c.Id
+	indexForSearch("work", w.Id)
+	return w.Id
 }
 
-// Delete a contact and all its child records (work and contact_contact)
-func deleteContact(id int) {
+// Import work entries in one transaction, first adding the new clients and
+// projects they're on. New clients and projects have negative IDs, which
+// projects and entries use to refer to them until they're added.
+func importWork(clients []Client, projects []Project, entries []Work) {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
-		panic("deleteContact begin: " + err.Error())
+		panic("importWork begin: " + err.Error())
 	}
-
-	// TODO: Delete all contact_project records for this contact
-	/*_, err = tx.Exec("delete from contact_contact where contact_id = ?", id)
-	if err != nil {
-		tx.Rollback()
-		panic("deleteContact contact_contact: " + err.Error())
-	}*/
-
-	// Delete the contact itself
-	_, err = tx.Exec("delete from contact where id = ?", id)
-	if err != nil {
-		tx.Rollback()
-		panic("deleteContact: " + err.Error())
+	newClients, newProjects := map[int]int{}, map[int]int{} // IDs of new clients and projects when added
+	for _, cl := range clients {
+		var id int
+		err = tx.QueryRow("select coalesce(max(id), 0) + 1 from client").Scan(&id)
+		if err == nil {
+			_, err = tx.Exec("insert into client (id, name, address, rate, currency, notes, active) values (?, ?, '', 0, '', '', ?)",
+				id, cl.Name, true)
+		}
+		if err != nil {
+			tx.Rollback()
+			panic("importWork insert client: " + err.Error())
+		}
+		newClients[cl.Id] = id
 	}
-
-	// Delete all project_contact records for this contact
-	_, err = tx.Exec("delete from project_contact where contact_id = ?", id)
-	if err != nil {
-		tx.Rollback()
-		panic("deleteContact project_contact: " + err.Error())
+	projectIds := []int{}
+	for _, p := range projects {
+		if p.ClientId < 0 {
+			p.ClientId = newClients[p.ClientId]
+		}
+		var id int
+		err = tx.QueryRow("select coalesce(max(id), 0) + 1 from project").Scan(&id)
+		if err == nil {
+			_, err = tx.Exec(`insert into project (id, client_id, name, description, category, billable, active, rate, fees,
+			                  budget_hours, estimate, complete, currency) values (?, nullif(?, 0), ?, '', ?, ?, ?, 0, 0, 0, 0, 0, '')`,
+				id, p.ClientId, p.Name, p.Category, p.IsBillable(), true)
+		}
+		if err != nil {
+			tx.Rollback()
+			panic("importWork insert project: " + err.Error())
+		}
+		newProjects[p.Id] = id
+		projectIds = append(projectIds, id)
+	}
+	workIds := []int{}
+	for _, w := range entries {
+		if w.ProjectId < 0 {
+			w.ProjectId = newProjects[w.ProjectId]
+		}
+		var id int
+		err = tx.QueryRow("select coalesce(max(id), 0) + 1 from work").Scan(&id)
+		if err == nil {
+			_, err = tx.Exec(`insert into work (id, project_id, work_date, start_time, end_time, hours, billable,
+			                  description, member_id, status) values (?, ?, ?, ?, ?, ?, ?, ?, ?, 'draft')`,
+				id, w.ProjectId, w.WorkDate, w.StartTime, w.EndTime, w.Hours, w.Billable, w.Description, w.MemberId)
+		}
+		for _, tag := range w.Tags {
+			if err == nil {
+				_, err = tx.Exec("insert into work_tag (id, work_id, tag) values ((select coalesce(max(id), 0) + 1 from work_tag), ?, ?)",
+					id, tag)
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			panic("importWork insert work: " + err.Error())
+		}
+		workIds = append(workIds, id)
 	}
-
-	// Commit the transaction
 	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
-		panic("deleteContact commit: " + err.Error())
+		panic("importWork commit: " + err.Error())
+	}
+
+	// Add the new projects and entries to the search index
+	for _, id := range projectIds {
+		indexForSearch("project", id)
+	}
+	for _, id := range workIds {
+		indexForSearch("work", id)
 	}
 }
 
 //------------------------------------------------------------------//
-//              P R O J E C T - C O N T A C T   L I N K S          //
+//                         W O R K   T A G S                        //
 //------------------------------------------------------------------//
 
-// Get all projects linked to a contact
-func getProjectsForContact(contactId int) []Project {
+// Get the tags of one work entry, sorted
+func getWorkTags(workId int) []string {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	// Query to get projects linked to this contact
-	query := `select p.id, p.client, p.name, p.description, p.category, p.active
-	          from project p
-	          inner join project_contact pc on p.id = pc.project_id
-	          where pc.contact_id = ?
-	          order by p.client, p.name`
-	rows, err := db.Query(query, contactId)
+	rows, err := db.Query("select tag from work_tag where work_id = ? order by tag", workId)
 	if err != nil {
-		panic("getProjectsForContact query: " + err.Error())
+		panic("getWorkTags query: " + err.Error())
 	}
 	defer rows.Close()
 
-	// Collect into a list
-	projects := []Project{}
+	tags := []string{}
 	for rows.Next() {
-		p := Project{}
-		err := rows.Scan(&p.Id, &p.Client, &p.Name, &p.Description, &p.Category, &p.Active)
+		var tag string
+		err := rows.Scan(&tag)
 		if err != nil {
-			panic("getProjectsForContact next: " + err.Error())
+			panic("getWorkTags next: " + err.Error())
 		}
-		projects = append(projects, p)
+		tags = append(tags, tag)
 	}
 	if rows.Err() != nil {
-		panic("getProjectsForContact exit: " + err.Error())
+		panic("getWorkTags exit: " + rows.Err().Error())
 	}
+	return tags
+}
 
-	return projects
+// Get the tags of all work entries, by work entry ID, each sorted
+func getAllWorkTags() map[int][]string {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query("select work_id, tag from work_tag order by work_id, tag")
+	if err != nil {
+		panic("getAllWorkTags query: " + err.Error())
+	}
+	defer rows.Close()
+
+	tags := map[int][]string{}
+	for rows.Next() {
+		var workId int
+		var tag string
+		err := rows.Scan(&workId, &tag)
+		if err != nil {
+			panic("getAllWorkTags next: " + err.Error())
+		}
+		tags[workId] = append(tags[workId], tag)
+	}
+	if rows.Err() != nil {
+		panic("getAllWorkTags exit: " + rows.Err().Error())
+	}
+	return tags
 }
 
-// Get all contacts linked to a project
-func getContactsForProject(projectId int) []Contact {
+// Get the tags of the given work entries, by work entry ID, each sorted
+func getWorkTagsFor(ids []int) map[int][]string {
+
+	tags := map[int][]string{}
+	if len(ids) == 0 {
+		return tags
+	}
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	// Query to get contacts linked to this project
-	query := `select c.id, c.first_name, c.last_name, c.company, c.title, c.source,
-	          c.phones, c.emails, c.address, c.comments, c.active
-	          from contact c
-	          inner join project_contact pc on c.id = pc.contact_id
-	          where pc.project_id = ?
-	          order by c.last_name, c.first_name`
-	rows, err := db.Query(query, projectId)
+	marks := strings.Repeat(", ?", len(ids))[2:]
+	args := []interface{}{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.Query("select work_id, tag from work_tag where work_id in ("+marks+") order by work_id, tag", args...)
 	if err != nil {
-		panic("getContactsForProject query: " + err.Error())
+		panic("getWorkTagsFor query: " + err.Error())
 	}
 	defer rows.Close()
 
-	// Collect into a list
-	contacts := []Contact{}
 	for rows.Next() {
-		c := Contact{}
-		err := rows.Scan(&c.Id, &c.FirstName, &c.LastName, &c.Company, &c.Title,
-			&c.Source, &c.Phones, &c.Emails, &c.Address, &c.Comments, &c.Active)
+		var workId int
+		var tag string
+		err := rows.Scan(&workId, &tag)
 		if err != nil {
-			panic("getContactsForProject next: " + err.Error())
+			panic("getWorkTagsFor next: " + err.Error())
 		}
-		contacts = append(contacts, c)
+		tags[workId] = append(tags[workId], tag)
 	}
 	if rows.Err() != nil {
-		panic("getContactsForProject exit: " + err.Error())
+		panic("getWorkTagsFor exit: " + rows.Err().Error())
 	}
+	return tags
+}
 
-	return contacts
+// Replace the tags of one work entry
+func saveWorkTags(workId int, tags []string) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Delete old tags and insert new ones in one transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("saveWorkTags begin: " + err.Error())
+	}
+	_, err = tx.Exec("delete from work_tag where work_id = ?", workId)
+	if err != nil {
+		tx.Rollback()
+		panic("saveWorkTags delete: " + err.Error())
+	}
+	for _, tag := range tags {
+		_, err = tx.Exec("insert into work_tag (id, work_id, tag) values ((select coalesce(max(id), 0) + 1 from work_tag), ?, ?)",
+			workId, tag)
+		if err != nil {
+			tx.Rollback()
+			panic("saveWorkTags insert: " + err.Error())
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("saveWorkTags commit: " + err.Error())
+	}
 }
 
-// Link a project to a contact
-func addProjectContact(projectId, contactId int) {
+// Record format for hours logged with one tag, on one project or in total
+type TagHours struct {
+	Tag           string
+	ProjectId     int // 0 for the total of all projects
+	ProjectName   string
+	Client        string
+	Logs          int
+	Hours         float64
+	BillableHours float64
+}
+
+// Get all tags in use, with the number of entries and hours for each,
+// sorted by tag
+func getTags() []TagHours {
+	return getTagHoursBetween("0000-00-00", "9999-99-99", false)
+}
+
+// Get hours logged with each tag for work between dates [startDate, endDate]
+// inclusive, either in total or by project, sorted by tag (then client and
+// project)
+func getTagHoursBetween(startDate, endDate string, byProject bool) []TagHours {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	// Check if link already exists
-	var count int
-	err := db.QueryRow("select count(*) from project_contact where project_id = ? and contact_id = ?",
-		projectId, contactId).Scan(&count)
+	// Group by tag, and by project if wanted
+	q := `select t.tag, p.id, p.name, coalesce(cl.name, trim(p.client), ''), count(w.id), coalesce(sum(w.hours), 0),
+	      coalesce(sum(case when w.billable = 1 then w.hours else 0 end), 0)
+	      from work_tag t
+	      inner join work w on t.work_id = w.id
+	      inner join project p on w.project_id = p.id
+	      left join client cl on p.client_id = cl.id
+	      where substr(w.work_date, 1, 10) >= ? and substr(w.work_date, 1, 10) <= ? `
+	if byProject {
+		q += "group by t.tag, p.id order by t.tag, coalesce(cl.name, trim(p.client), ''), p.name"
+	} else {
+		q += "group by t.tag order by t.tag"
+	}
+	rows, err := db.Query(q, startDate, endDate)
 	if err != nil {
-		panic("addProjectContact check: " + err.Error())
+		panic("getTagHoursBetween query: " + err.Error())
 	}
+	defer rows.Close()
 
-	// If link already exists, do nothing
-	if count > 0 {
-		return
+	// Collect into a list, without project for totals
+	list := []TagHours{}
+	for rows.Next() {
+		var th TagHours
+		err := rows.Scan(&th.Tag, &th.ProjectId, &th.ProjectName, &th.Client, &th.Logs, &th.Hours, &th.BillableHours)
+		if err != nil {
+			panic("getTagHoursBetween next: " + err.Error())
+		}
+		if !byProject {
+			th.ProjectId, th.ProjectName, th.Client = 0, "", ""
+		}
+		list = append(list, th)
+	}
+	if rows.Err() != nil {
+		panic("getTagHoursBetween exit: " + rows.Err().Error())
 	}
+	return list
+}
 
-	// Get next ID
-	nextId := getMaxId("project_contact") + 1
+//------------------------------------------------------------------//
+//                   W O R K   T E M P L A T E S                    //
+//------------------------------------------------------------------//
 
-	// Insert the link
-	_, err = db.Exec("insert into project_contact (id, project_id, contact_id) values (?, ?, ?)",
-		nextId, projectId, contactId)
+// Record format for one saved work entry template
+type WorkTemplate struct {
+	Id          int
+	Name        string
+	ProjectId   int
+	Hours       float64
+	Billable    bool
+	Description string
+	// Joined fields from project
+	ProjectName string
+	Client      string
+}
+
+// Get all work entry templates, sorted by name
+func getWorkTemplates() []WorkTemplate {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Execute query to get all templates with project info
+	query := `select t.id, t.name, t.project_id, t.hours, t.billable, t.description,
+	          coalesce(p.name, ''), coalesce(cl.name, trim(p.client), '')
+	          from work_template t
+	          left join project p on t.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          order by t.name`
+	rows, err := db.Query(query)
 	if err != nil {
-		panic("addProjectContact insert: " + err.Error())
+		panic("getWorkTemplates query: " + err.Error())
 	}
+	defer rows.Close()
+
+	// Collect into a list
+	tt := []WorkTemplate{}
+	for rows.Next() {
+		t := WorkTemplate{}
+		err := rows.Scan(&t.Id, &t.Name, &t.ProjectId, &t.Hours, &t.Billable, &t.Description,
+			&t.ProjectName, &t.Client)
+		if err != nil {
+			panic("getWorkTemplates next: " + err.Error())
+		}
+		tt = append(tt, t)
+	}
+	if rows.Err() != nil {
+		panic("getWorkTemplates exit: " + rows.Err().Error())
+	}
+
+	// Return list
+	return tt
 }
 
-// Unlink a project from a contact
-func deleteProjectContact(projectId, contactId int) {
+// Get one work entry template by ID
+func getWorkTemplate(id int) WorkTemplate {
 
 	// Connect to database
 	db := dbConnect()
 	defer db.Close()
 
-	// Delete the link
-	_, err := db.Exec("delete from project_contact where project_id = ? and contact_id = ?",
-		projectId, contactId)
+	// Execute query to get one template with project info
+	query := `select t.id, t.name, t.project_id, t.hours, t.billable, t.description,
+	          coalesce(p.name, ''), coalesce(cl.name, trim(p.client), '')
+	          from work_template t
+	          left join project p on t.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          where t.id = ?`
+	var t WorkTemplate
+	err := db.QueryRow(query, id).Scan(&t.Id, &t.Name, &t.ProjectId, &t.Hours, &t.Billable,
+		&t.Description, &t.ProjectName, &t.Client)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			panic("getWorkTemplate: template with id " + fmt.Sprintf("%d", id) + " not found")
+		}
+		panic("getWorkTemplate: " + err.Error())
+	}
+
+	// Return template
+	return t
+}
+
+// Save a work entry template (insert if Id is zero, update if Id is nonzero)
+// Returns the template ID
+func saveWorkTemplate(t WorkTemplate) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	if t.Id == 0 {
+		// Get next ID
+		nextId := getMaxId("work_template") + 1
+		t.Id = nextId
+
+		// Insert new template
+		_, err := db.Exec("insert into work_template (id, name, project_id, hours, billable, description) values (?, ?, ?, ?, ?, ?)",
+			t.Id, t.Name, t.ProjectId, t.Hours, t.Billable, t.Description)
+		if err != nil {
+			panic("saveWorkTemplate insert: " + err.Error())
+		}
+	} else {
+		// Update existing template
+		_, err := db.Exec("update work_template set name=?, project_id=?, hours=?, billable=?, description=? where id=?",
+			t.Name, t.ProjectId, t.Hours, t.Billable, t.Description, t.Id)
+		if err != nil {
+			panic("saveWorkTemplate update: " + err.Error())
+		}
+	}
+	return t.Id
+}
+
+// Delete one work entry template by ID
+func deleteWorkTemplate(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from work_template where id = ?", id)
+	if err != nil {
+		panic("deleteWorkTemplate: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                          C O N T A C T S                         //
+//------------------------------------------------------------------//
+
+// Record format for one contact
+type Contact struct {
+	Id        int
+	FirstName string
+	LastName  string
+	Company   string
+	Title     string
+	Source    string
+	Phones    string
+	Emails    string
+	Address   string
+	Comments  string
+	Active    bool
+}
+
+// Get all contacts, sorted by last name (increasing)
+func getContacts() []Contact {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Execute query to get all contacts
+	query := "select id, first_name, last_name, company, title, source, phones, emails, address, comments, active from contact order by last_name"
+	rows, err := db.Query(query)
+	if err != nil {
+		panic("getContacts query: " + err.Error())
+	}
+	defer rows.Close()
+
+	// Collect into a list
+	cc := []Contact{}
+	for rows.Next() {
+		c := Contact{}
+		err := rows.Scan(&c.Id, &c.FirstName, &c.LastName, &c.Company, &c.Title, &c.Source, &c.Phones, &c.Emails, &c.Address, &c.Comments, &c.Active)
+		if err != nil {
+			panic("getContacts next: " + err.Error())
+		}
+		cc = append(cc, c)
+	}
+	if rows.Err() != nil {
+		panic("getContacts exit: " + err.Error())
+	}
+
+	// Return list
+	fmt.Printf("getContacts: %d rows\n", len(cc))
+	return cc
+}
+
+// Get one contact by ID
+func getContact(id int) Contact {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Execute query to get one contact
+	query := "select id, first_name, last_name, company, title, source, phones, emails, address, comments, active from contact where id = ?"
+	var c Contact
+	err := db.QueryRow(query, id).Scan(&c.Id, &c.FirstName, &c.LastName, &c.Company, &c.Title, &c.Source, &c.Phones, &c.Emails, &c.Address, &c.Comments, &c.Active)
+	if err != nil {
+		panic("getContact: " + err.Error())
+	}
+
+	// Return work entry
+	return c
+}
+
+// Save a contact (insert if Id is zero, update if Id is nonzero)
+// Returns the contact ID
+func saveContact(c Contact) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	if c.Id == 0 {
+
+		// Get next ID
+		nextId := getMaxId("contact") + 1
+		c.Id = nextId
+
+		// Insert new contact
+		_, err := db.Exec("insert into contact (id, first_name, last_name, company, title, source, phones, emails, address, comments, active) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			c.Id, c.FirstName, c.LastName, c.Company, c.Title, c.Source, c.Phones, c.Emails, c.Address, c.Comments, c.Active)
+		if err != nil {
+			panic("saveContact insert: " + err.Error())
+		}
+	} else { // Update existing contact
+
+		_, err := db.Exec("update contact set first_name=?, last_name=?, company=?, title=?, source=?, phones=?, emails=?, address=?, comments=?, active=? where id=?",
+			c.FirstName, c.LastName, c.Company, c.Title, c.Source, c.Phones, c.Emails, c.Address, c.Comments, c.Active, c.Id)
+		if err != nil {
+			panic("saveContact update: " + err.Error())
+		}
+	}
+	indexForSearch("contact", c.Id)
+	return c.Id
+}
+
+// Delete a contact and all its child records (work and contact_contact)
+func deleteContact(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("deleteContact begin: " + err.Error())
+	}
+
+	// TODO: Delete all contact_project records for this contact
+	/*_, err = tx.Exec("delete from contact_contact where contact_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteContact contact_contact: " + err.Error())
+	}*/
+
+	// Delete the contact itself
+	_, err = tx.Exec("delete from contact where id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteContact: " + err.Error())
+	}
+
+	// Delete all project_contact records for this contact
+	_, err = tx.Exec("delete from project_contact where contact_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteContact project_contact: " + err.Error())
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("deleteContact commit: " + err.Error())
+	}
+	indexForSearch("contact", id)
+}
+
+//------------------------------------------------------------------//
+//              P R O J E C T - C O N T A C T   L I N K S          //
+//------------------------------------------------------------------//
+
+// Get all projects linked to a contact
+func getProjectsForContact(contactId int) []Project {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Query to get projects linked to this contact
+	query := `select p.id, coalesce(p.client_id, 0), coalesce(cl.name, trim(p.client), ''), p.name, p.description, p.category, p.active
+	          from project p
+	          inner join project_contact pc on p.id = pc.project_id
+	          left join client cl on p.client_id = cl.id
+	          where pc.contact_id = ?
+	          order by coalesce(cl.name, trim(p.client), ''), p.name`
+	rows, err := db.Query(query, contactId)
+	if err != nil {
+		panic("getProjectsForContact query: " + err.Error())
+	}
+	defer rows.Close()
+
+	// Collect into a list
+	projects := []Project{}
+	for rows.Next() {
+		p := Project{}
+		err := rows.Scan(&p.Id, &p.ClientId, &p.Client, &p.Name, &p.Description, &p.Category, &p.Active)
+		if err != nil {
+			panic("getProjectsForContact next: " + err.Error())
+		}
+		projects = append(projects, p)
+	}
+	if rows.Err() != nil {
+		panic("getProjectsForContact exit: " + err.Error())
+	}
+
+	return projects
+}
+
+// Get all contacts linked to a project
+func getContactsForProject(projectId int) []Contact {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Query to get contacts linked to this project
+	query := `select c.id, c.first_name, c.last_name, c.company, c.title, c.source,
+	          c.phones, c.emails, c.address, c.comments, c.active
+	          from contact c
+	          inner join project_contact pc on c.id = pc.contact_id
+	          where pc.project_id = ?
+	          order by c.last_name, c.first_name`
+	rows, err := db.Query(query, projectId)
+	if err != nil {
+		panic("getContactsForProject query: " + err.Error())
+	}
+	defer rows.Close()
+
+	// Collect into a list
+	contacts := []Contact{}
+	for rows.Next() {
+		c := Contact{}
+		err := rows.Scan(&c.Id, &c.FirstName, &c.LastName, &c.Company, &c.Title,
+			&c.Source, &c.Phones, &c.Emails, &c.Address, &c.Comments, &c.Active)
+		if err != nil {
+			panic("getContactsForProject next: " + err.Error())
+		}
+		contacts = append(contacts, c)
+	}
+	if rows.Err() != nil {
+		panic("getContactsForProject exit: " + err.Error())
+	}
+
+	return contacts
+}
+
+// Link a project to a contact
+func addProjectContact(projectId, contactId int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Check if link already exists
+	var count int
+	err := db.QueryRow("select count(*) from project_contact where project_id = ? and contact_id = ?",
+		projectId, contactId).Scan(&count)
+	if err != nil {
+		panic("addProjectContact check: " + err.Error())
+	}
+
+	// If link already exists, do nothing
+	if count > 0 {
+		return
+	}
+
+	// Get next ID
+	nextId := getMaxId("project_contact") + 1
+
+	// Insert the link
+	_, err = db.Exec("insert into project_contact (id, project_id, contact_id) values (?, ?, ?)",
+		nextId, projectId, contactId)
+	if err != nil {
+		panic("addProjectContact insert: " + err.Error())
+	}
+}
+
+// Unlink a project from a contact
+func deleteProjectContact(projectId, contactId int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Delete the link
+	_, err := db.Exec("delete from project_contact where project_id = ? and contact_id = ?",
+		projectId, contactId)
 	if err != nil {
 		panic("deleteProjectContact: " + err.Error())
 	}
 }
+
+//------------------------------------------------------------------//
+//                          S E T T I N G S                         //
+//------------------------------------------------------------------//
+
+// Get one setting by name, or the default value given if it is not set
+func getSetting(name, defaultValue string) string {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var value string
+	err := db.QueryRow("select value from setting where name = ?", name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return defaultValue
+	}
+	if err != nil {
+		panic("getSetting: " + err.Error())
+	}
+	return value
+}
+
+// Save one setting, replacing any previous value
+func saveSetting(name, value string) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from setting where name = ?", name)
+	if err != nil {
+		panic("saveSetting delete: " + err.Error())
+	}
+	_, err = db.Exec("insert into setting (name, value) values (?, ?)", name, value)
+	if err != nil {
+		panic("saveSetting insert: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                           C L I E N T S                          //
+//------------------------------------------------------------------//
+
+// Record format for one client
+type Client struct {
+	Id       int
+	Name     string
+	Address  string  // billing address
+	Rate     float64 // hourly rate for the client's projects, 0 for the default rate
+	Currency string  // currency for the client's projects, blank for the base currency
+	Notes    string
+	Active   bool
+	// The following fields are calculated
+	Projects int     // number of projects
+	Hours    float64 // total hours on all projects
+}
+
+// Get all clients, sorted by name, with their number of projects and hours
+func getClients() []Client {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select cl.id, cl.name, coalesce(cl.address, ''), coalesce(cl.rate, 0), coalesce(cl.currency, ''),
+	                       coalesce(cl.notes, ''), cl.active,
+	                       (select count(*) from project p where p.client_id = cl.id),
+	                       (select coalesce(sum(w.hours), 0) from work w inner join project p on w.project_id = p.id
+	                        where p.client_id = cl.id)
+	                       from client cl order by cl.name collate nocase`)
+	if err != nil {
+		panic("getClients query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Client{}
+	for rows.Next() {
+		var cl Client
+		var active string
+		err := rows.Scan(&cl.Id, &cl.Name, &cl.Address, &cl.Rate, &cl.Currency, &cl.Notes, &active, &cl.Projects, &cl.Hours)
+		if err != nil {
+			panic("getClients next: " + err.Error())
+		}
+		cl.Active = active == "1" || active == "true"
+		list = append(list, cl)
+	}
+	if rows.Err() != nil {
+		panic("getClients exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Get a list of all client names, sorted
+func getClientNames() []string {
+	names := []string{}
+	for _, cl := range getClients() {
+		names = append(names, cl.Name)
+	}
+	return names
+}
+
+// Look up one client by ID, returning false if it does not exist
+func findClient(id int) (Client, bool) {
+	return findClientWhere("id = ?", id)
+}
+
+// Look up one client by name, ignoring case, returning false if there is
+// no client with that name
+func findClientByName(name string) (Client, bool) {
+	return findClientWhere("lower(name) = lower(?)", name)
+}
+
+// Look up one client matching a condition
+func findClientWhere(cond string, arg any) (Client, bool) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var cl Client
+	var active string
+	err := db.QueryRow(`select id, name, coalesce(address, ''), coalesce(rate, 0), coalesce(currency, ''),
+	                    coalesce(notes, ''), active from client where `+cond, arg).
+		Scan(&cl.Id, &cl.Name, &cl.Address, &cl.Rate, &cl.Currency, &cl.Notes, &active)
+	if err == sql.ErrNoRows {
+		return cl, false
+	}
+	if err != nil {
+		panic("findClient: " + err.Error())
+	}
+	cl.Active = active == "1" || active == "true"
+	return cl, true
+}
+
+// Save a client (insert if Id is zero, update if Id is nonzero)
+// Returns the client ID
+func saveClient(cl Client) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	if cl.Id == 0 {
+		cl.Id = getMaxId("client") + 1
+		_, err := db.Exec("insert into client (id, name, address, rate, currency, notes, active) values (?, ?, ?, ?, ?, ?, ?)",
+			cl.Id, cl.Name, cl.Address, cl.Rate, cl.Currency, cl.Notes, cl.Active)
+		if err != nil {
+			panic("saveClient insert: " + err.Error())
+		}
+	} else {
+		_, err := db.Exec("update client set name=?, address=?, rate=?, currency=?, notes=?, active=? where id=?",
+			cl.Name, cl.Address, cl.Rate, cl.Currency, cl.Notes, cl.Active, cl.Id)
+		if err != nil {
+			panic("saveClient update: " + err.Error())
+		}
+	}
+
+	// Client name is in the search text of its projects
+	indexClientProjectsForSearch(cl.Id)
+	return cl.Id
+}
+
+// Delete a client and its links to contacts. The client must not have any
+// projects, invoices or period locks.
+func deleteClient(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("deleteClient begin: " + err.Error())
+	}
+
+	_, err = tx.Exec("delete from client_contact where client_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteClient contacts: " + err.Error())
+	}
+	_, err = tx.Exec("delete from client where id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteClient: " + err.Error())
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("deleteClient commit: " + err.Error())
+	}
+}
+
+// Check whether anything refers to a client (projects, invoices or period
+// locks), so that it can't be deleted
+func clientInUse(id int) bool {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var n int
+	err := db.QueryRow(`select (select count(*) from project where client_id = ?) +
+	                    (select count(*) from invoice where client_id = ?) +
+	                    (select count(*) from period_lock where client_id = ?)`, id, id, id).Scan(&n)
+	if err != nil {
+		panic("clientInUse: " + err.Error())
+	}
+	return n > 0
+}
+
+// Get hourly rates set for clients, as a map of client name to rate,
+// including the old rates of client names not yet moved to a client
+func getClientRates() map[string]float64 {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select name, coalesce(rate, 0) from client
+	                       union all
+	                       select trim(client), coalesce(rate, 0) from client_rate
+	                       where trim(client) not in (select name from client)`)
+	if err != nil {
+		panic("getClientRates query: " + err.Error())
+	}
+	defer rows.Close()
+
+	rates := map[string]float64{}
+	for rows.Next() {
+		var client string
+		var rate float64
+		err := rows.Scan(&client, &rate)
+		if err != nil {
+			panic("getClientRates next: " + err.Error())
+		}
+		rates[client] = rate
+	}
+	if rows.Err() != nil {
+		panic("getClientRates exit: " + rows.Err().Error())
+	}
+	return rates
+}
+
+// Get rates set for team members, as a map of member ID to rate, only for
+// members with a rate
+func getMemberRates() map[int]float64 {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query("select id, rate from member where coalesce(rate, 0) > 0")
+	if err != nil {
+		panic("getMemberRates query: " + err.Error())
+	}
+	defer rows.Close()
+
+	rates := map[int]float64{}
+	for rows.Next() {
+		var id int
+		var rate float64
+		err := rows.Scan(&id, &rate)
+		if err != nil {
+			panic("getMemberRates next: " + err.Error())
+		}
+		rates[id] = rate
+	}
+	if rows.Err() != nil {
+		panic("getMemberRates exit: " + rows.Err().Error())
+	}
+	return rates
+}
+
+// Get billable hours between dates [startDate, endDate] inclusive, by
+// project ID and member ID, for work entries with a member
+func getBillableHoursByMember(startDate, endDate string) map[int]map[int]float64 {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select project_id, member_id, coalesce(sum(hours), 0) from work
+	                       where billable = 1 and coalesce(member_id, 0) <> 0
+	                       and substr(work_date, 1, 10) >= ? and substr(work_date, 1, 10) <= ?
+	                       group by project_id, member_id`, startDate, endDate)
+	if err != nil {
+		panic("getBillableHoursByMember query: " + err.Error())
+	}
+	defer rows.Close()
+
+	hours := map[int]map[int]float64{}
+	for rows.Next() {
+		var projectId, memberId int
+		var h float64
+		err := rows.Scan(&projectId, &memberId, &h)
+		if err != nil {
+			panic("getBillableHoursByMember next: " + err.Error())
+		}
+		if hours[projectId] == nil {
+			hours[projectId] = map[int]float64{}
+		}
+		hours[projectId][memberId] = h
+	}
+	if rows.Err() != nil {
+		panic("getBillableHoursByMember exit: " + rows.Err().Error())
+	}
+	return hours
+}
+
+// Get currencies set for clients, as a map of client name to currency,
+// including the old currencies of client names not yet moved to a client
+func getClientCurrencies() map[string]string {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select name, currency from client where coalesce(currency, '') <> ''
+	                       union all
+	                       select trim(client), currency from client_rate
+	                       where coalesce(currency, '') <> '' and trim(client) not in (select name from client)`)
+	if err != nil {
+		panic("getClientCurrencies query: " + err.Error())
+	}
+	defer rows.Close()
+
+	currencies := map[string]string{}
+	for rows.Next() {
+		var client, currency string
+		err := rows.Scan(&client, &currency)
+		if err != nil {
+			panic("getClientCurrencies next: " + err.Error())
+		}
+		currencies[client] = currency
+	}
+	if rows.Err() != nil {
+		panic("getClientCurrencies exit: " + rows.Err().Error())
+	}
+	return currencies
+}
+
+// Get contacts linked to a client, sorted by name
+func getContactsForClient(clientId int) []Contact {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select c.id, c.first_name, c.last_name, c.company, c.title, c.source,
+	          c.phones, c.emails, c.address, c.comments, c.active
+	          from contact c
+	          inner join client_contact cc on c.id = cc.contact_id
+	          where cc.client_id = ?
+	          order by c.last_name, c.first_name`
+	rows, err := db.Query(query, clientId)
+	if err != nil {
+		panic("getContactsForClient query: " + err.Error())
+	}
+	defer rows.Close()
+
+	contacts := []Contact{}
+	for rows.Next() {
+		c := Contact{}
+		err := rows.Scan(&c.Id, &c.FirstName, &c.LastName, &c.Company, &c.Title,
+			&c.Source, &c.Phones, &c.Emails, &c.Address, &c.Comments, &c.Active)
+		if err != nil {
+			panic("getContactsForClient next: " + err.Error())
+		}
+		contacts = append(contacts, c)
+	}
+	if rows.Err() != nil {
+		panic("getContactsForClient exit: " + rows.Err().Error())
+	}
+	return contacts
+}
+
+// Link a contact to a client, if not already linked
+func addClientContact(clientId, contactId int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec(`insert into client_contact (id, client_id, contact_id)
+	                   select coalesce(max(id), 0) + 1, ?, ? from client_contact
+	                   where not exists (select 1 from client_contact where client_id = ? and contact_id = ?)`,
+		clientId, contactId, clientId, contactId)
+	if err != nil {
+		panic("addClientContact: " + err.Error())
+	}
+}
+
+// Remove the link between a contact and a client
+func deleteClientContact(clientId, contactId int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from client_contact where client_id = ? and contact_id = ?", clientId, contactId)
+	if err != nil {
+		panic("deleteClientContact: " + err.Error())
+	}
+}
+
+// Record format for a client name typed on projects, invoices and period
+// locks before there was a client table, still to be moved to a client
+type LegacyClient struct {
+	Name     string
+	Projects int // number of projects using the name
+	Invoices int // number of invoices using the name
+}
+
+// Get the client names not yet moved to the client table, sorted
+func getLegacyClients() []LegacyClient {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select name, sum(projects), sum(invoices) from (
+	                         select trim(client) as name, 1 as projects, 0 as invoices from project
+	                         where coalesce(client_id, 0) = 0 and coalesce(trim(client), '') <> ''
+	                         union all
+	                         select trim(client), 0, 1 from invoice
+	                         where coalesce(client_id, 0) = 0 and coalesce(trim(client), '') <> ''
+	                         union all
+	                         select trim(client), 0, 0 from period_lock
+	                         where coalesce(client_id, 0) = 0 and coalesce(trim(client), '') <> '')
+	                       group by name order by name`)
+	if err != nil {
+		panic("getLegacyClients query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []LegacyClient{}
+	for rows.Next() {
+		var lc LegacyClient
+		err := rows.Scan(&lc.Name, &lc.Projects, &lc.Invoices)
+		if err != nil {
+			panic("getLegacyClients next: " + err.Error())
+		}
+		list = append(list, lc)
+	}
+	if rows.Err() != nil {
+		panic("getLegacyClients exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Move client names typed before there was a client table to clients, given
+// a map of each old name to the name of the client it belongs to. Clients
+// are created as needed (matching existing ones ignoring case), taking their
+// rate and currency from the old client rates if not already set. All in
+// one transaction.
+func migrateClients(targets map[string]string) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("migrateClients begin: " + err.Error())
+	}
+
+	for legacy, target := range targets {
+
+		// Find or create the client
+		var id int
+		err := tx.QueryRow("select id from client where lower(name) = lower(?)", target).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow("select coalesce(max(id), 0) + 1 from client").Scan(&id)
+			if err == nil {
+				_, err = tx.Exec("insert into client (id, name, active) values (?, ?, ?)", id, target, true)
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			panic("migrateClients client: " + err.Error())
+		}
+
+		// Take the old rate and currency, unless already set
+		_, err = tx.Exec(`update client set
+		                  rate = coalesce(nullif(rate, 0), (select nullif(rate, 0) from client_rate where trim(client) = ?)),
+		                  currency = coalesce(nullif(currency, ''), (select nullif(currency, '') from client_rate where trim(client) = ?))
+		                  where id = ?`, legacy, legacy, id)
+		if err != nil {
+			tx.Rollback()
+			panic("migrateClients rate: " + err.Error())
+		}
+
+		// Point projects, invoices and locks at the client
+		for _, table := range []string{"project", "invoice", "period_lock"} {
+			_, err = tx.Exec("update "+table+" set client_id = ? where coalesce(client_id, 0) = 0 and trim(client) = ?", id, legacy)
+			if err != nil {
+				tx.Rollback()
+				panic("migrateClients " + table + ": " + err.Error())
+			}
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("migrateClients commit: " + err.Error())
+	}
+	rebuildSearchIndex()
+}
+
+//------------------------------------------------------------------//
+//                          I N V O I C E S                         //
+//------------------------------------------------------------------//
+
+// Record format for one invoice
+type Invoice struct {
+	Id          int
+	Number      int // sequential invoice number
+	ClientId    int
+	Client      string // client name, joined from client table
+	StartDate   string // period covered
+	EndDate     string
+	InvoiceDate string
+	Status      string // draft, sent, paid
+	Total       float64
+	Currency    string // currency of rates and amounts on the invoice
+	Notes       string
+}
+
+// Record format for one line on an invoice, with the rate frozen at the
+// time the invoice was created
+type InvoiceItem struct {
+	Id          int
+	InvoiceId   int
+	WorkId      int // work entry billed, if any
+	ExpenseId   int // or expense billed, if any
+	ProjectId   int
+	ItemDate    string
+	Description string
+	Hours       float64
+	Rate        float64
+	Amount      float64
+	// Joined field from project
+	ProjectName string
+}
+
+// Invoice statuses, in order: an invoice can only move forward, so work on
+// a sent invoice can't be released and billed again
+var invoiceStatuses = []string{"draft", "sent", "paid"}
+
+// Position of an invoice status in the order, -1 if unknown
+func invoiceStatusIndex(status string) int {
+	for i, s := range invoiceStatuses {
+		if s == status {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get unbilled billable work entries for a client between dates [startDate,
+// endDate] inclusive, sorted by project and date. If approvedOnly is set
+// (in team mode), only entries approved by a manager are included, and
+// entries without a member, which have no time sheet to approve.
+func getUnbilledWork(client, startDate, endDate string, approvedOnly bool) []Work {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select w.id, w.project_id, w.work_date, w.hours, w.billable, w.description, coalesce(w.member_id, 0),
+	          p.name as project_name, coalesce(cl.name, trim(p.client), '')
+	          from work w
+	          inner join project p on w.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          where cl.name = ? and w.billable = 1 and coalesce(w.invoice_id, 0) = 0
+	          and substr(w.work_date, 1, 10) >= ? and substr(w.work_date, 1, 10) <= ?
+	          and (? = 0 or w.status = 'approved' or coalesce(w.member_id, 0) = 0)
+	          order by p.name, w.work_date, w.id`
+	rows, err := db.Query(query, client, startDate, endDate, approvedOnly)
+	if err != nil {
+		panic("getUnbilledWork query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Work{}
+	for rows.Next() {
+		w := Work{}
+		var hrs, billable string
+		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &hrs, &billable, &w.Description, &w.MemberId,
+			&w.ProjectName, &w.Client)
+		if err != nil {
+			panic("getUnbilledWork next: " + err.Error())
+		}
+		if len(w.WorkDate) > 10 {
+			w.WorkDate = w.WorkDate[:10]
+		}
+		w.Hours, err = strconv.ParseFloat(hrs, 64)
+		if err != nil {
+			w.Hours = 0
+		}
+		w.Billable = billable == "1" || billable == "true"
+		list = append(list, w)
+	}
+	if rows.Err() != nil {
+		panic("getUnbilledWork exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Create an invoice with its items, assigning the next invoice number, and
+// mark the work entries billed as invoiced, all in one transaction. Returns
+// an error (and creates nothing) if any of the work entries was already
+// invoiced in the meantime.
+func createInvoice(inv Invoice, items []InvoiceItem) (int, error) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("createInvoice begin: " + err.Error())
+	}
+
+	// Next ID and invoice number
+	var maxId, maxNumber sql.NullInt64
+	err = tx.QueryRow("select max(id), max(number) from invoice").Scan(&maxId, &maxNumber)
+	if err != nil {
+		tx.Rollback()
+		panic("createInvoice max: " + err.Error())
+	}
+	inv.Id = int(maxId.Int64) + 1
+	inv.Number = int(maxNumber.Int64) + 1
+
+	// Insert the invoice
+	_, err = tx.Exec(`insert into invoice (id, number, client_id, start_date, end_date, invoice_date, status, total, currency, notes)
+	                  values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		inv.Id, inv.Number, inv.ClientId, inv.StartDate, inv.EndDate, inv.InvoiceDate, inv.Status, inv.Total, inv.Currency, inv.Notes)
+	if err != nil {
+		tx.Rollback()
+		panic("createInvoice insert: " + err.Error())
+	}
+
+	// Insert the items, and mark work entries and expenses as invoiced
+	var itemId sql.NullInt64
+	err = tx.QueryRow("select max(id) from invoice_item").Scan(&itemId)
+	if err != nil {
+		tx.Rollback()
+		panic("createInvoice max item: " + err.Error())
+	}
+	for i, it := range items {
+		_, err = tx.Exec(`insert into invoice_item (id, invoice_id, work_id, expense_id, project_id, item_date, description,
+		                  hours, rate, amount) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			int(itemId.Int64)+i+1, inv.Id, it.WorkId, it.ExpenseId, it.ProjectId, it.ItemDate, it.Description,
+			it.Hours, it.Rate, it.Amount)
+		if err != nil {
+			tx.Rollback()
+			panic("createInvoice item: " + err.Error())
+		}
+		if it.ExpenseId > 0 {
+			res, err := tx.Exec("update expense set invoice_id = ? where id = ? and coalesce(invoice_id, 0) = 0", inv.Id, it.ExpenseId)
+			if err != nil {
+				tx.Rollback()
+				panic("createInvoice expense: " + err.Error())
+			}
+			if n, _ := res.RowsAffected(); n != 1 {
+				tx.Rollback()
+				return 0, fmt.Errorf("expense %d has already been invoiced", it.ExpenseId)
+			}
+		}
+		if it.WorkId == 0 {
+			continue
+		}
+		res, err := tx.Exec("update work set invoice_id = ? where id = ? and coalesce(invoice_id, 0) = 0", inv.Id, it.WorkId)
+		if err != nil {
+			tx.Rollback()
+			panic("createInvoice work: " + err.Error())
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			tx.Rollback()
+			return 0, fmt.Errorf("work entry %d has already been invoiced", it.WorkId)
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("createInvoice commit: " + err.Error())
+	}
+	return inv.Id, nil
+}
+
+// Get all invoices, or only those for one client if not blank, sorted by
+// client and number (most recent first)
+func getInvoices(client string) []Invoice {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select i.id, i.number, coalesce(i.client_id, 0), coalesce(cl.name, trim(i.client), ''), i.start_date, i.end_date, i.invoice_date,
+	          i.status, i.total, coalesce(i.currency, ''), coalesce(i.notes, '')
+	          from invoice i left join client cl on i.client_id = cl.id
+	          where ? = '' or coalesce(cl.name, trim(i.client)) = ?
+	          order by coalesce(cl.name, trim(i.client), ''), i.number desc`
+	rows, err := db.Query(query, client, client)
+	if err != nil {
+		panic("getInvoices query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Invoice{}
+	for rows.Next() {
+		inv := Invoice{}
+		err := rows.Scan(&inv.Id, &inv.Number, &inv.ClientId, &inv.Client, &inv.StartDate, &inv.EndDate, &inv.InvoiceDate,
+			&inv.Status, &inv.Total, &inv.Currency, &inv.Notes)
+		if err != nil {
+			panic("getInvoices next: " + err.Error())
+		}
+		inv.StartDate, inv.EndDate, inv.InvoiceDate = dateOnly(inv.StartDate), dateOnly(inv.EndDate), dateOnly(inv.InvoiceDate)
+		list = append(list, inv)
+	}
+	if rows.Err() != nil {
+		panic("getInvoices exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Get one invoice by ID
+func getInvoice(id int) Invoice {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var inv Invoice
+	err := db.QueryRow(`select i.id, i.number, coalesce(i.client_id, 0), coalesce(cl.name, trim(i.client), ''), i.start_date, i.end_date, i.invoice_date,
+	                    i.status, i.total, coalesce(i.currency, ''), coalesce(i.notes, '')
+	                    from invoice i left join client cl on i.client_id = cl.id where i.id = ?`, id).
+		Scan(&inv.Id, &inv.Number, &inv.ClientId, &inv.Client, &inv.StartDate, &inv.EndDate, &inv.InvoiceDate,
+			&inv.Status, &inv.Total, &inv.Currency, &inv.Notes)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			panic("getInvoice: invoice with id " + fmt.Sprintf("%d", id) + " not found")
+		}
+		panic("getInvoice: " + err.Error())
+	}
+	inv.StartDate, inv.EndDate, inv.InvoiceDate = dateOnly(inv.StartDate), dateOnly(inv.EndDate), dateOnly(inv.InvoiceDate)
+	return inv
+}
+
+// Look up one invoice by ID, returning false if it does not exist
+func findInvoice(id int) (Invoice, bool) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var inv Invoice
+	err := db.QueryRow(`select i.id, i.number, coalesce(i.client_id, 0), coalesce(cl.name, trim(i.client), ''), i.start_date, i.end_date, i.invoice_date,
+	                    i.status, i.total, coalesce(i.currency, ''), coalesce(i.notes, '')
+	                    from invoice i left join client cl on i.client_id = cl.id where i.id = ?`, id).
+		Scan(&inv.Id, &inv.Number, &inv.ClientId, &inv.Client, &inv.StartDate, &inv.EndDate, &inv.InvoiceDate,
+			&inv.Status, &inv.Total, &inv.Currency, &inv.Notes)
+	if err == sql.ErrNoRows {
+		return inv, false
+	}
+	if err != nil {
+		panic("findInvoice: " + err.Error())
+	}
+	inv.StartDate, inv.EndDate, inv.InvoiceDate = dateOnly(inv.StartDate), dateOnly(inv.EndDate), dateOnly(inv.InvoiceDate)
+	return inv, true
+}
+
+// Get the items on one invoice, sorted by project and date
+func getInvoiceItems(invoiceId int) []InvoiceItem {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select i.id, i.invoice_id, coalesce(i.work_id, 0), coalesce(i.expense_id, 0), i.project_id, i.item_date, coalesce(i.description, ''),
+	          i.hours, i.rate, i.amount, coalesce(p.name, '')
+	          from invoice_item i
+	          left join project p on i.project_id = p.id
+	          where i.invoice_id = ?
+	          order by p.name, i.item_date, i.id`
+	rows, err := db.Query(query, invoiceId)
+	if err != nil {
+		panic("getInvoiceItems query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []InvoiceItem{}
+	for rows.Next() {
+		it := InvoiceItem{}
+		err := rows.Scan(&it.Id, &it.InvoiceId, &it.WorkId, &it.ExpenseId, &it.ProjectId, &it.ItemDate, &it.Description,
+			&it.Hours, &it.Rate, &it.Amount, &it.ProjectName)
+		if err != nil {
+			panic("getInvoiceItems next: " + err.Error())
+		}
+		it.ItemDate = dateOnly(it.ItemDate)
+		list = append(list, it)
+	}
+	if rows.Err() != nil {
+		panic("getInvoiceItems exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Change the status of an invoice, if it still has the status it had when
+// the change was asked for. Returns false if the status changed meanwhile.
+func setInvoiceStatus(id int, from, to string) bool {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	res, err := db.Exec("update invoice set status = ? where id = ? and status = ?", to, id, from)
+	if err != nil {
+		panic("setInvoiceStatus: " + err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		panic("setInvoiceStatus rows: " + err.Error())
+	}
+	return n > 0
+}
+
+// Delete an invoice and its items, releasing its work entries and expenses
+// so they can be billed again
+func deleteInvoice(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("deleteInvoice begin: " + err.Error())
+	}
+
+	// Release work entries
+	_, err = tx.Exec("update work set invoice_id = null where invoice_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteInvoice work: " + err.Error())
+	}
+	_, err = tx.Exec("update expense set invoice_id = null where invoice_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteInvoice expense: " + err.Error())
+	}
+
+	// Delete items, then the invoice itself
+	_, err = tx.Exec("delete from invoice_item where invoice_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteInvoice items: " + err.Error())
+	}
+	_, err = tx.Exec("delete from invoice where id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteInvoice invoice: " + err.Error())
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("deleteInvoice commit: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                      P E R I O D   L O C K S                     //
+//------------------------------------------------------------------//
+
+// Record format for a locked (closed) period, in which work entries can't
+// be changed or deleted until it is reopened
+type PeriodLock struct {
+	Id        int
+	StartDate string // period locked, inclusive
+	EndDate   string
+	ClientId  int    // 0 for all clients
+	Client    string // client name, joined from client table
+	Note      string
+	LockedAt  string // date and time locked
+}
+
+// Record format for one entry in the history of locks and unlocks
+type PeriodLockEvent struct {
+	Id        int
+	Action    string // lock or unlock
+	StartDate string
+	EndDate   string
+	Client    string
+	Note      string
+	Member    string // name of the team member who locked or reopened, if any
+	EventTime string
+}
+
+// SQL condition that is true if the work entry in the current row (table
+// work) falls inside a locked period. Locks and projects not yet moved to
+// the client table match on the client name typed before.
+const workLockedSQL = `exists (select 1 from period_lock l
+                       where substr(work.work_date, 1, 10) between l.start_date and l.end_date
+                       and (coalesce(l.client_id, 0) = 0 and coalesce(trim(l.client), '') = '' or
+                            l.client_id = (select p.client_id from project p where p.id = work.project_id) or
+                            trim(l.client) = (select trim(p.client) from project p
+                                              where p.id = work.project_id and coalesce(p.client_id, 0) = 0)))`
+
+// Get all period locks, most recent period first
+func getPeriodLocks() []PeriodLock {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select l.id, l.start_date, l.end_date, coalesce(l.client_id, 0), coalesce(cl.name, trim(l.client), ''),
+	                       coalesce(l.note, ''), l.locked_at
+	                       from period_lock l left join client cl on l.client_id = cl.id
+	                       order by l.start_date desc, coalesce(cl.name, trim(l.client), '')`)
+	if err != nil {
+		panic("getPeriodLocks query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []PeriodLock{}
+	for rows.Next() {
+		var l PeriodLock
+		err := rows.Scan(&l.Id, &l.StartDate, &l.EndDate, &l.ClientId, &l.Client, &l.Note, &l.LockedAt)
+		if err != nil {
+			panic("getPeriodLocks next: " + err.Error())
+		}
+		l.StartDate, l.EndDate = dateOnly(l.StartDate), dateOnly(l.EndDate)
+		list = append(list, l)
+	}
+	if rows.Err() != nil {
+		panic("getPeriodLocks exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Find a lock covering a date, either for all clients or for the client
+// given. Returns false if the date is not locked.
+func findPeriodLock(date, client string) (PeriodLock, bool) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var l PeriodLock
+	err := db.QueryRow(`select l.id, l.start_date, l.end_date, coalesce(l.client_id, 0), coalesce(cl.name, trim(l.client), ''),
+	                    coalesce(l.note, ''), l.locked_at
+	                    from period_lock l left join client cl on l.client_id = cl.id
+	                    where l.start_date <= ? and l.end_date >= ?
+	                    and (coalesce(l.client_id, 0) = 0 and coalesce(trim(l.client), '') = '' or
+	                         coalesce(cl.name, trim(l.client)) = ?) order by l.start_date limit 1`,
+		date, date, client).Scan(&l.Id, &l.StartDate, &l.EndDate, &l.ClientId, &l.Client, &l.Note, &l.LockedAt)
+	if err == sql.ErrNoRows {
+		return l, false
+	}
+	if err != nil {
+		panic("findPeriodLock: " + err.Error())
+	}
+	l.StartDate, l.EndDate = dateOnly(l.StartDate), dateOnly(l.EndDate)
+	return l, true
+}
+
+// Check whether a project has any work entries in a locked period
+func projectHasLockedWork(projectId int) bool {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var n int
+	err := db.QueryRow("select count(*) from work where project_id = ? and "+workLockedSQL, projectId).Scan(&n)
+	if err != nil {
+		panic("projectHasLockedWork: " + err.Error())
+	}
+	return n > 0
+}
+
+// Check whether a project has any work entries submitted or approved on a
+// time sheet
+func projectHasApprovedWork(projectId int) bool {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var n int
+	err := db.QueryRow("select count(*) from work where project_id = ? and status in ('submitted', 'approved')",
+		projectId).Scan(&n)
+	if err != nil {
+		panic("projectHasApprovedWork: " + err.Error())
+	}
+	return n > 0
+}
+
+// Check whether a project has any work entries or expenses on an invoice,
+// or is named on any invoice items
+func projectHasInvoicedWork(projectId int) bool {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var n int
+	err := db.QueryRow(`select (select count(*) from work where project_id = ? and coalesce(invoice_id, 0) <> 0)
+	                    + (select count(*) from expense where project_id = ? and coalesce(invoice_id, 0) <> 0)
+	                    + (select count(*) from invoice_item where project_id = ?)`,
+		projectId, projectId, projectId).Scan(&n)
+	if err != nil {
+		panic("projectHasInvoicedWork: " + err.Error())
+	}
+	return n > 0
+}
+
+// Record a lock or unlock by a team member (blank outside team mode) in the
+// history, as part of a transaction
+func logPeriodLockEvent(tx *sql.Tx, action string, l PeriodLock, note, member string) error {
+	var id int
+	err := tx.QueryRow("select coalesce(max(id), 0) + 1 from period_lock_log").Scan(&id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`insert into period_lock_log (id, action, start_date, end_date, client, note, member, event_time)
+	                  values (?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, action, l.StartDate, l.EndDate, l.Client, note, member, time.Now().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// Lock a period, and record it in the history with the team member who
+// locked it. Returns the lock ID.
+func lockPeriod(l PeriodLock, member string) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("lockPeriod begin: " + err.Error())
+	}
+
+	// Add the lock
+	l.Id = getMaxId("period_lock") + 1
+	l.LockedAt = time.Now().Format("2006-01-02 15:04:05")
+	_, err = tx.Exec(`insert into period_lock (id, start_date, end_date, client_id, note, locked_at)
+	                  values (?, ?, ?, ?, ?, ?)`, l.Id, l.StartDate, l.EndDate, l.ClientId, l.Note, l.LockedAt)
+	if err != nil {
+		tx.Rollback()
+		panic("lockPeriod insert: " + err.Error())
+	}
+
+	// Record in history
+	err = logPeriodLockEvent(tx, "lock", l, l.Note, member)
+	if err != nil {
+		tx.Rollback()
+		panic("lockPeriod log: " + err.Error())
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("lockPeriod commit: " + err.Error())
+	}
+	return l.Id
+}
+
+// Reopen a locked period by removing its lock, and record it in the
+// history with the reason given and the team member who reopened it
+func unlockPeriod(id int, note, member string) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Get the lock, so it can be recorded
+	var l PeriodLock
+	err := db.QueryRow(`select l.start_date, l.end_date, coalesce(cl.name, trim(l.client), '')
+	                    from period_lock l left join client cl on l.client_id = cl.id where l.id = ?`,
+		id).Scan(&l.StartDate, &l.EndDate, &l.Client)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		panic("unlockPeriod select: " + err.Error())
+	}
+	l.StartDate, l.EndDate = dateOnly(l.StartDate), dateOnly(l.EndDate)
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("unlockPeriod begin: " + err.Error())
+	}
+
+	// Remove the lock and record in history
+	_, err = tx.Exec("delete from period_lock where id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("unlockPeriod delete: " + err.Error())
+	}
+	err = logPeriodLockEvent(tx, "unlock", l, note, member)
+	if err != nil {
+		tx.Rollback()
+		panic("unlockPeriod log: " + err.Error())
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("unlockPeriod commit: " + err.Error())
+	}
+}
+
+// Get the history of locks and unlocks, most recent first
+func getPeriodLockEvents() []PeriodLockEvent {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select id, action, start_date, end_date, coalesce(client, ''), coalesce(note, ''),
+	                       coalesce(member, ''), event_time
+	                       from period_lock_log order by id desc`)
+	if err != nil {
+		panic("getPeriodLockEvents query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []PeriodLockEvent{}
+	for rows.Next() {
+		var e PeriodLockEvent
+		err := rows.Scan(&e.Id, &e.Action, &e.StartDate, &e.EndDate, &e.Client, &e.Note, &e.Member, &e.EventTime)
+		if err != nil {
+			panic("getPeriodLockEvents next: " + err.Error())
+		}
+		e.StartDate, e.EndDate = dateOnly(e.StartDate), dateOnly(e.EndDate)
+		list = append(list, e)
+	}
+	if rows.Err() != nil {
+		panic("getPeriodLockEvents exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+//------------------------------------------------------------------//
+//                          M E M B E R S                           //
+//------------------------------------------------------------------//
+
+// Record format for one team member
+type Member struct {
+	Id      int
+	Name    string
+	Email   string
+	Manager bool    // can approve or reject time sheets
+	Rate    float64 // hourly rate for work on projects without their own or client rate, 0 for default
+	Active  bool
+}
+
+// Get all team members, sorted by name
+func getMembers() []Member {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query("select id, name, coalesce(email, ''), manager, coalesce(rate, 0), active from member order by name")
+	if err != nil {
+		panic("getMembers query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Member{}
+	for rows.Next() {
+		var m Member
+		var manager, active string
+		err := rows.Scan(&m.Id, &m.Name, &m.Email, &manager, &m.Rate, &active)
+		if err != nil {
+			panic("getMembers next: " + err.Error())
+		}
+		m.Manager = manager == "1" || manager == "true"
+		m.Active = active == "1" || active == "true"
+		list = append(list, m)
+	}
+	if rows.Err() != nil {
+		panic("getMembers exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Get one team member by ID, returning false if there is no such member
+func findMember(id int) (Member, bool) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	var m Member
+	var manager, active string
+	err := db.QueryRow("select id, name, coalesce(email, ''), manager, coalesce(rate, 0), active from member where id = ?",
+		id).Scan(&m.Id, &m.Name, &m.Email, &manager, &m.Rate, &active)
+	if err == sql.ErrNoRows {
+		return m, false
+	}
+	if err != nil {
+		panic("findMember: " + err.Error())
+	}
+	m.Manager = manager == "1" || manager == "true"
+	m.Active = active == "1" || active == "true"
+	return m, true
+}
+
+// Save a team member (insert if Id is zero, update if Id is nonzero)
+// Returns the member ID
+func saveMember(m Member) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	if m.Id == 0 {
+		m.Id = getMaxId("member") + 1
+		_, err := db.Exec("insert into member (id, name, email, manager, rate, active) values (?, ?, ?, ?, ?, ?)",
+			m.Id, m.Name, m.Email, m.Manager, m.Rate, m.Active)
+		if err != nil {
+			panic("saveMember insert: " + err.Error())
+		}
+	} else {
+		_, err := db.Exec("update member set name = ?, email = ?, manager = ?, rate = ?, active = ? where id = ?",
+			m.Name, m.Email, m.Manager, m.Rate, m.Active, m.Id)
+		if err != nil {
+			panic("saveMember update: " + err.Error())
+		}
+	}
+	return m.Id
+}
+
+//------------------------------------------------------------------//
+//                       T I M E   S H E E T S                      //
+//------------------------------------------------------------------//
+
+// Record format for one member's time sheet for a week, which is submitted
+// for approval and then approved or rejected by a manager
+type Timesheet struct {
+	Id          int
+	MemberId    int
+	WeekStart   string // first day of the week covered, as set when submitted
+	Status      string // submitted, approved or rejected
+	SubmittedAt string
+	ReviewerId  int
+	ReviewedAt  string
+	Comment     string // from the reviewer
+	// Joined and calculated fields
+	MemberName   string
+	ReviewerName string
+	Hours        float64
+}
+
+// Get time sheets, for one member (or all if memberId is 0) and with one
+// status (or all if blank), most recent week first
+func getTimesheets(memberId int, status string) []Timesheet {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select t.id, t.member_id, t.week_start, t.status, coalesce(t.submitted_at, ''),
+	          coalesce(t.reviewer_id, 0), coalesce(t.reviewed_at, ''), coalesce(t.comment, ''),
+	          coalesce(m.name, ''), coalesce(r.name, ''),
+	          (select coalesce(sum(w.hours), 0) from work w where w.member_id = t.member_id
+	           and substr(w.work_date, 1, 10) between t.week_start and date(t.week_start, '+6 days'))
+	          from timesheet t
+	          left join member m on t.member_id = m.id
+	          left join member r on t.reviewer_id = r.id
+	          where (? = 0 or t.member_id = ?) and (? = '' or t.status = ?)
+	          order by t.week_start desc, m.name`
+	rows, err := db.Query(query, memberId, memberId, status, status)
+	if err != nil {
+		panic("getTimesheets query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Timesheet{}
+	for rows.Next() {
+		var t Timesheet
+		err := rows.Scan(&t.Id, &t.MemberId, &t.WeekStart, &t.Status, &t.SubmittedAt, &t.ReviewerId,
+			&t.ReviewedAt, &t.Comment, &t.MemberName, &t.ReviewerName, &t.Hours)
+		if err != nil {
+			panic("getTimesheets next: " + err.Error())
+		}
+		t.WeekStart = dateOnly(t.WeekStart)
+		list = append(list, t)
+	}
+	if rows.Err() != nil {
+		panic("getTimesheets exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Find a member's time sheet for the week starting on the date given,
+// returning false if it has not been submitted yet
+func findTimesheet(memberId int, weekStart string) (Timesheet, bool) {
+	for _, t := range getTimesheets(memberId, "") {
+		if t.WeekStart == weekStart {
+			return t, true
+		}
+	}
+	return Timesheet{}, false
+}
+
+// Get a member's work entries between dates [startDate, endDate]
+// inclusive, sorted by date
+func getMemberWork(memberId int, startDate, endDate string) []Work {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select w.id, w.project_id, w.work_date, w.hours, w.billable, w.description,
+	          coalesce(w.invoice_id, 0), coalesce(w.status, 'draft'), p.name, coalesce(cl.name, trim(p.client), '')
+	          from work w
+	          left join project p on w.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          where w.member_id = ? and substr(w.work_date, 1, 10) between ? and ?
+	          order by w.work_date, w.id`
+	rows, err := db.Query(query, memberId, startDate, endDate)
+	if err != nil {
+		panic("getMemberWork query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Work{}
+	for rows.Next() {
+		w := Work{MemberId: memberId}
+		var billable string
+		var hours sql.NullFloat64
+		var projectName, client sql.NullString
+		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &hours, &billable, &w.Description,
+			&w.InvoiceId, &w.Status, &projectName, &client)
+		if err != nil {
+			panic("getMemberWork next: " + err.Error())
+		}
+		w.WorkDate = dateOnly(w.WorkDate)
+		w.Hours = hours.Float64
+		w.Billable = billable == "1" || billable == "true"
+		w.ProjectName = projectName.String
+		w.Client = client.String
+		list = append(list, w)
+	}
+	if rows.Err() != nil {
+		panic("getMemberWork exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Get the total hours a member has logged in each week (by date of the
+// first day of the week), for weeks starting on or after startDate
+func getMemberWeeklyHours(memberId int, startDate string, first time.Weekday) map[string]float64 {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// SQLite weekday: 0 is Sunday, as in Go, so the first day of the week
+	// is this many days back
+	query := `select date(substr(work_date, 1, 10), '-' || ((strftime('%w', substr(work_date, 1, 10)) - ? + 7) % 7) || ' days') as week,
+	          sum(hours)
+	          from work where member_id = ? group by week having week >= ?`
+	rows, err := db.Query(query, int(first), memberId, startDate)
+	if err != nil {
+		panic("getMemberWeeklyHours query: " + err.Error())
+	}
+	defer rows.Close()
+
+	weeks := map[string]float64{}
+	for rows.Next() {
+		var week string
+		var hours float64
+		err := rows.Scan(&week, &hours)
+		if err != nil {
+			panic("getMemberWeeklyHours next: " + err.Error())
+		}
+		weeks[week] = hours
+	}
+	if rows.Err() != nil {
+		panic("getMemberWeeklyHours exit: " + rows.Err().Error())
+	}
+	return weeks
+}
+
+// Submit a member's draft and rejected work entries for the week starting
+// on weekStart for approval, creating or updating the week's time sheet.
+// Returns the number of entries submitted.
+func submitTimesheet(memberId int, weekStart, weekEnd string) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Time sheet ID, if submitted before
+	t, found := findTimesheet(memberId, weekStart)
+	if !found {
+		t.Id = getMaxId("timesheet") + 1
+	}
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("submitTimesheet begin: " + err.Error())
+	}
+
+	// Submit the entries that aren't already submitted or approved
+	res, err := tx.Exec(`update work set status = 'submitted'
+	                     where member_id = ? and substr(work_date, 1, 10) between ? and ?
+	                     and coalesce(status, 'draft') in ('draft', 'rejected')`, memberId, weekStart, weekEnd)
+	if err != nil {
+		tx.Rollback()
+		panic("submitTimesheet work: " + err.Error())
+	}
+	n, _ := res.RowsAffected()
+
+	// Create or update the time sheet
+	now := time.Now().Format("2006-01-02 15:04:05")
+	if found {
+		_, err = tx.Exec(`update timesheet set status = 'submitted', submitted_at = ?, reviewer_id = null,
+		                  reviewed_at = null, comment = null where id = ?`, now, t.Id)
+	} else {
+		_, err = tx.Exec(`insert into timesheet (id, member_id, week_start, status, submitted_at)
+		                  values (?, ?, ?, 'submitted', ?)`, t.Id, memberId, weekStart, now)
+	}
+	if err != nil {
+		tx.Rollback()
+		panic("submitTimesheet timesheet: " + err.Error())
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("submitTimesheet commit: " + err.Error())
+	}
+	return int(n)
+}
+
+// Approve or reject a submitted time sheet (status "approved" or
+// "rejected"), with the reviewer's comment, and set the status of its
+// submitted work entries to match
+func reviewTimesheet(t Timesheet, status string, reviewerId int, comment string) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("reviewTimesheet begin: " + err.Error())
+	}
+
+	// Set status of the work entries
+	_, err = tx.Exec(`update work set status = ?
+	                  where member_id = ? and substr(work_date, 1, 10) between ? and date(?, '+6 days')
+	                  and status = 'submitted'`, status, t.MemberId, t.WeekStart, t.WeekStart)
+	if err != nil {
+		tx.Rollback()
+		panic("reviewTimesheet work: " + err.Error())
+	}
+
+	// Record the review on the time sheet
+	_, err = tx.Exec("update timesheet set status = ?, reviewer_id = ?, reviewed_at = ?, comment = ? where id = ?",
+		status, reviewerId, time.Now().Format("2006-01-02 15:04:05"), comment, t.Id)
+	if err != nil {
+		tx.Rollback()
+		panic("reviewTimesheet timesheet: " + err.Error())
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("reviewTimesheet commit: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                          E X P E N S E S                         //
+//------------------------------------------------------------------//
+
+// Record format for one expense (travel, materials, etc.) on a project
+type Expense struct {
+	Id          int
+	ProjectId   int
+	ExpenseDate string
+	Amount      float64
+	Currency    string // three-letter code, e.g. USD
+	Category    string
+	Billable    bool
+	Description string
+	Receipt     string // file name of receipt under receiptsDir, if any
+	InvoiceId   int    // invoice this expense was billed on, 0 if not yet billed
+	// Joined fields from project
+	ProjectName string
+	Client      string
+}
+
+// Columns selected for expenses, with project joined as p and client as cl
+const expenseColumns = `e.id, e.project_id, e.expense_date, e.amount, coalesce(e.currency, ''),
+                        coalesce(e.category, ''), e.billable, coalesce(e.description, ''),
+                        coalesce(e.receipt, ''), coalesce(e.invoice_id, 0), coalesce(p.name, ''), coalesce(cl.name, trim(p.client), '')`
+
+// Scan one expense from a row selected with expenseColumns
+func scanExpense(scan func(dest ...any) error) (Expense, error) {
+	var e Expense
+	var billable string
+	err := scan(&e.Id, &e.ProjectId, &e.ExpenseDate, &e.Amount, &e.Currency, &e.Category, &billable,
+		&e.Description, &e.Receipt, &e.InvoiceId, &e.ProjectName, &e.Client)
+	e.ExpenseDate = dateOnly(e.ExpenseDate)
+	e.Billable = billable == "1" || billable == "true"
+	return e, err
+}
+
+// Get expenses for a project, sorted by date
+func getExpensesForProject(projectId int) []Expense {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select `+expenseColumns+` from expense e
+	                       left join project p on e.project_id = p.id
+	                       left join client cl on p.client_id = cl.id
+	                       where e.project_id = ? order by e.expense_date, e.id`, projectId)
+	if err != nil {
+		panic("getExpensesForProject query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Expense{}
+	for rows.Next() {
+		e, err := scanExpense(rows.Scan)
+		if err != nil {
+			panic("getExpensesForProject next: " + err.Error())
+		}
+		list = append(list, e)
+	}
+	if rows.Err() != nil {
+		panic("getExpensesForProject exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Get unbilled billable expenses for a client between dates [startDate,
+// endDate] inclusive, sorted by project and date
+func getUnbilledExpenses(client, startDate, endDate string) []Expense {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query(`select `+expenseColumns+` from expense e
+	                       inner join project p on e.project_id = p.id
+	                       inner join client cl on p.client_id = cl.id
+	                       where cl.name = ? and e.billable = 1 and coalesce(e.invoice_id, 0) = 0
+	                       and substr(e.expense_date, 1, 10) between ? and ?
+	                       order by p.name, e.expense_date, e.id`, client, startDate, endDate)
+	if err != nil {
+		panic("getUnbilledExpenses query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Expense{}
+	for rows.Next() {
+		e, err := scanExpense(rows.Scan)
+		if err != nil {
+			panic("getUnbilledExpenses next: " + err.Error())
+		}
+		list = append(list, e)
+	}
+	if rows.Err() != nil {
+		panic("getUnbilledExpenses exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Get one expense by ID, returning false if there is no such expense
+func findExpense(id int) (Expense, bool) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	e, err := scanExpense(db.QueryRow(`select `+expenseColumns+` from expense e
+	                                   left join project p on e.project_id = p.id
+	                                   left join client cl on p.client_id = cl.id where e.id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return e, false
+	}
+	if err != nil {
+		panic("findExpense: " + err.Error())
+	}
+	return e, true
+}
+
+// Save an expense (insert if Id is zero, update if Id is nonzero)
+// Returns the expense ID
+func saveExpense(e Expense) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	if e.Id == 0 {
+		e.Id = getMaxId("expense") + 1
+		_, err := db.Exec(`insert into expense (id, project_id, expense_date, amount, currency, category, billable, description, receipt)
+		                   values (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.Id, e.ProjectId, e.ExpenseDate, e.Amount, e.Currency, e.Category, e.Billable, e.Description, e.Receipt)
+		if err != nil {
+			panic("saveExpense insert: " + err.Error())
+		}
+	} else {
+		_, err := db.Exec(`update expense set project_id = ?, expense_date = ?, amount = ?, currency = ?, category = ?,
+		                   billable = ?, description = ?, receipt = ? where id = ?`,
+			e.ProjectId, e.ExpenseDate, e.Amount, e.Currency, e.Category, e.Billable, e.Description, e.Receipt, e.Id)
+		if err != nil {
+			panic("saveExpense update: " + err.Error())
+		}
+	}
+	return e.Id
+}
+
+// Delete one expense by ID
+func deleteExpense(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from expense where id = ?", id)
+	if err != nil {
+		panic("deleteExpense: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                   E X C H A N G E   R A T E S                    //
+//------------------------------------------------------------------//
+
+// Record format for one exchange rate: the value of one unit of a currency
+// in the base currency, from a date until the next rate for the currency
+type ExchangeRate struct {
+	Id       int
+	Currency string
+	RateDate string
+	Rate     float64
+}
+
+// Get all exchange rates, sorted by currency and date
+func getExchangeRates() []ExchangeRate {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query("select id, currency, rate_date, rate from exchange_rate order by currency, rate_date")
+	if err != nil {
+		panic("getExchangeRates query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []ExchangeRate{}
+	for rows.Next() {
+		var r ExchangeRate
+		err := rows.Scan(&r.Id, &r.Currency, &r.RateDate, &r.Rate)
+		if err != nil {
+			panic("getExchangeRates next: " + err.Error())
+		}
+		r.RateDate = dateOnly(r.RateDate)
+		list = append(list, r)
+	}
+	if rows.Err() != nil {
+		panic("getExchangeRates exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Save an exchange rate, replacing any rate for the same currency and date
+func saveExchangeRate(r ExchangeRate) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from exchange_rate where currency = ? and rate_date = ?", r.Currency, r.RateDate)
+	if err != nil {
+		panic("saveExchangeRate delete: " + err.Error())
+	}
+	_, err = db.Exec("insert into exchange_rate (id, currency, rate_date, rate) values (?, ?, ?, ?)",
+		getMaxId("exchange_rate")+1, r.Currency, r.RateDate, r.Rate)
+	if err != nil {
+		panic("saveExchangeRate insert: " + err.Error())
+	}
+}
+
+// Delete one exchange rate by ID
+func deleteExchangeRate(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from exchange_rate where id = ?", id)
+	if err != nil {
+		panic("deleteExchangeRate: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                         H O L I D A Y S                          //
+//------------------------------------------------------------------//
+
+// Record format for one holiday calendar, e.g. the public holidays of one
+// country, entered by hand or imported from an iCalendar file
+type HolidayCalendar struct {
+	Id     int
+	Name   string
+	Active bool // holidays of inactive calendars are not shown or used
+	// Calculated fields
+	Holidays    int    // number of holidays
+	First, Last string // dates of the first and last holidays
+}
+
+// Record format for one holiday, one day in a holiday calendar
+type Holiday struct {
+	Id          int
+	CalendarId  int
+	HolidayDate string
+	Name        string
+}
+
+// Get all holiday calendars, sorted by name
+func getHolidayCalendars() []HolidayCalendar {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select hc.id, hc.name, hc.active, count(h.id), coalesce(min(h.holiday_date), ''), coalesce(max(h.holiday_date), '')
+	          from holiday_calendar hc
+	          left join holiday h on h.calendar_id = hc.id
+	          group by hc.id, hc.name, hc.active
+	          order by hc.name`
+	rows, err := db.Query(query)
+	if err != nil {
+		panic("getHolidayCalendars query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []HolidayCalendar{}
+	for rows.Next() {
+		var hc HolidayCalendar
+		var active string
+		err := rows.Scan(&hc.Id, &hc.Name, &active, &hc.Holidays, &hc.First, &hc.Last)
+		if err != nil {
+			panic("getHolidayCalendars next: " + err.Error())
+		}
+		hc.Active = active == "1" || active == "true"
+		hc.First, hc.Last = dateOnly(hc.First), dateOnly(hc.Last)
+		list = append(list, hc)
+	}
+	if rows.Err() != nil {
+		panic("getHolidayCalendars exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Find one holiday calendar by ID, false if not found
+func findHolidayCalendar(id int) (HolidayCalendar, bool) {
+	for _, hc := range getHolidayCalendars() {
+		if hc.Id == id {
+			return hc, true
+		}
+	}
+	return HolidayCalendar{}, false
+}
+
+// Save a holiday calendar (insert if Id is zero, update if Id is nonzero)
+// Returns the calendar ID
+func saveHolidayCalendar(hc HolidayCalendar) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	if hc.Id == 0 {
+		hc.Id = getMaxId("holiday_calendar") + 1
+		_, err := db.Exec("insert into holiday_calendar (id, name, active) values (?, ?, ?)", hc.Id, hc.Name, hc.Active)
+		if err != nil {
+			panic("saveHolidayCalendar insert: " + err.Error())
+		}
+	} else {
+		_, err := db.Exec("update holiday_calendar set name = ?, active = ? where id = ?", hc.Name, hc.Active, hc.Id)
+		if err != nil {
+			panic("saveHolidayCalendar update: " + err.Error())
+		}
+	}
+	return hc.Id
+}
+
+// Delete a holiday calendar and its holidays
+func deleteHolidayCalendar(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic("deleteHolidayCalendar begin: " + err.Error())
+	}
+	_, err = tx.Exec("delete from holiday where calendar_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteHolidayCalendar holidays: " + err.Error())
+	}
+	_, err = tx.Exec("delete from holiday_calendar where id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteHolidayCalendar: " + err.Error())
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("deleteHolidayCalendar commit: " + err.Error())
+	}
+}
+
+// Get the holidays of one calendar, sorted by date
+func getHolidays(calendarId int) []Holiday {
+	return queryHolidays("where calendar_id = ?", calendarId)
+}
+
+// Get the holidays of active calendars between two dates, inclusive,
+// sorted by date
+func getHolidaysBetween(startDate, endDate string) []Holiday {
+	return queryHolidays(`where substr(holiday_date, 1, 10) between ? and ?
+	                      and calendar_id in (select id from holiday_calendar where active = 1)`, startDate, endDate)
+}
+
+// Get holidays matching a where clause, sorted by date
+func queryHolidays(where string, args ...interface{}) []Holiday {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query("select id, calendar_id, holiday_date, coalesce(name, '') from holiday "+where+
+		" order by holiday_date, id", args...)
+	if err != nil {
+		panic("queryHolidays query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Holiday{}
+	for rows.Next() {
+		var h Holiday
+		err := rows.Scan(&h.Id, &h.CalendarId, &h.HolidayDate, &h.Name)
+		if err != nil {
+			panic("queryHolidays next: " + err.Error())
+		}
+		h.HolidayDate = dateOnly(h.HolidayDate)
+		list = append(list, h)
+	}
+	if rows.Err() != nil {
+		panic("queryHolidays exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Add holidays to a calendar, skipping any that are already in it with the
+// same date and name. Returns the number added.
+func saveHolidays(calendarId int, holidays []Holiday) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Add all in one transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("saveHolidays begin: " + err.Error())
+	}
+	added := 0
+	for _, h := range holidays {
+		res, err := tx.Exec(`insert into holiday (id, calendar_id, holiday_date, name)
+		                     select (select coalesce(max(id), 0) + 1 from holiday), ?, ?, ?
+		                     where not exists (select 1 from holiday where calendar_id = ?
+		                                       and substr(holiday_date, 1, 10) = ? and name = ?)`,
+			calendarId, h.HolidayDate, h.Name, calendarId, h.HolidayDate, h.Name)
+		if err != nil {
+			tx.Rollback()
+			panic("saveHolidays insert: " + err.Error())
+		}
+		n, _ := res.RowsAffected()
+		added += int(n)
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("saveHolidays commit: " + err.Error())
+	}
+	return added
+}
+
+// Delete one holiday by ID
+func deleteHoliday(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from holiday where id = ?", id)
+	if err != nil {
+		panic("deleteHoliday: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                         A B S E N C E S                          //
+//------------------------------------------------------------------//
+
+// Record format for one personal absence, e.g. vacation or sick days
+type Absence struct {
+	Id        int
+	MemberId  int    // team member absent, 0 if not recorded
+	Kind      string // Vacation, Sick, Personal or Other
+	StartDate string
+	EndDate   string // inclusive
+	Note      string
+	ProjectId int // project in the Absent category to log work on, 0 for none
+	// Joined fields from member and project
+	MemberName  string
+	ProjectName string
+	// Calculated fields
+	Entries int     // number of work entries generated
+	Hours   float64 // hours of work entries generated
+}
+
+// Get absences overlapping a range of dates, newest first, or all absences
+// if the dates are blank
+func getAbsences(startDate, endDate string) []Absence {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select a.id, coalesce(a.member_id, 0), a.kind, a.start_date, a.end_date, coalesce(a.note, ''),
+	          coalesce(a.project_id, 0), coalesce(m.name, ''), coalesce(p.name, ''),
+	          (select count(*) from work w where w.absence_id = a.id),
+	          (select coalesce(sum(w.hours), 0) from work w where w.absence_id = a.id)
+	          from absence a
+	          left join member m on a.member_id = m.id
+	          left join project p on a.project_id = p.id`
+	args := []interface{}{}
+	if startDate != "" {
+		query += " where substr(a.start_date, 1, 10) <= ? and substr(a.end_date, 1, 10) >= ?"
+		args = append(args, endDate, startDate)
+	}
+	query += " order by a.start_date desc, a.id desc"
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		panic("getAbsences query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Absence{}
+	for rows.Next() {
+		var a Absence
+		err := rows.Scan(&a.Id, &a.MemberId, &a.Kind, &a.StartDate, &a.EndDate, &a.Note,
+			&a.ProjectId, &a.MemberName, &a.ProjectName, &a.Entries, &a.Hours)
+		if err != nil {
+			panic("getAbsences next: " + err.Error())
+		}
+		a.StartDate, a.EndDate = dateOnly(a.StartDate), dateOnly(a.EndDate)
+		list = append(list, a)
+	}
+	if rows.Err() != nil {
+		panic("getAbsences exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Find one absence by ID, false if not found
+func findAbsence(id int) (Absence, bool) {
+	for _, a := range getAbsences("", "") {
+		if a.Id == id {
+			return a, true
+		}
+	}
+	return Absence{}, false
+}
+
+// Get the work entries generated for an absence, with their project's
+// client, status and invoice
+func getAbsenceWork(absenceId int) []Work {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select w.id, w.project_id, w.work_date, w.hours, coalesce(w.invoice_id, 0), coalesce(w.status, 'draft'),
+	          coalesce(cl.name, trim(p.client), '')
+	          from work w
+	          left join project p on w.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          where w.absence_id = ?
+	          order by w.work_date`
+	rows, err := db.Query(query, absenceId)
+	if err != nil {
+		panic("getAbsenceWork query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Work{}
+	for rows.Next() {
+		var w Work
+		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &w.Hours, &w.InvoiceId, &w.Status, &w.Client)
+		if err != nil {
+			panic("getAbsenceWork next: " + err.Error())
+		}
+		w.WorkDate = dateOnly(w.WorkDate)
+		list = append(list, w)
+	}
+	if rows.Err() != nil {
+		panic("getAbsenceWork exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Delete the work entries generated for an absence, with their tags and
+// search index entries, within a transaction
+func deleteAbsenceWork(tx *sql.Tx, absenceId int) error {
+	_, err := tx.Exec("delete from work_tag where work_id in (select id from work where absence_id = ?)", absenceId)
+	if err == nil && ftsAvailable {
+		_, err = tx.Exec("delete from search_index where kind = 'work' and item_id in (select id from work where absence_id = ?)", absenceId)
+	}
+	if err == nil {
+		_, err = tx.Exec("delete from work where absence_id = ?", absenceId)
+	}
+	return err
+}
+
+// Save an absence (insert if Id is zero, update if Id is nonzero), replacing
+// the work entries generated for it with the ones given. Returns the
+// absence ID.
+func saveAbsence(a Absence, entries []Work) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Save the absence and its work entries in one transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("saveAbsence begin: " + err.Error())
+	}
+	if a.Id == 0 {
+		a.Id = getMaxId("absence") + 1
+		_, err = tx.Exec(`insert into absence (id, member_id, kind, start_date, end_date, note, project_id)
+		                  values (?, nullif(?, 0), ?, ?, ?, ?, nullif(?, 0))`,
+			a.Id, a.MemberId, a.Kind, a.StartDate, a.EndDate, a.Note, a.ProjectId)
+	} else {
+		_, err = tx.Exec(`update absence set kind = ?, start_date = ?, end_date = ?, note = ?, project_id = nullif(?, 0)
+		                  where id = ?`, a.Kind, a.StartDate, a.EndDate, a.Note, a.ProjectId, a.Id)
+	}
+	if err != nil {
+		tx.Rollback()
+		panic("saveAbsence: " + err.Error())
+	}
+	err = deleteAbsenceWork(tx, a.Id)
+	if err != nil {
+		tx.Rollback()
+		panic("saveAbsence delete work: " + err.Error())
+	}
+	ids := []int{}
+	for _, w := range entries {
+		var id int
+		err = tx.QueryRow("select coalesce(max(id), 0) + 1 from work").Scan(&id)
+		if err == nil {
+			_, err = tx.Exec(`insert into work (id, project_id, work_date, hours, billable, description, member_id, status, absence_id)
+			                  values (?, ?, ?, ?, ?, ?, ?, 'draft', ?)`,
+				id, w.ProjectId, w.WorkDate, w.Hours, w.Billable, w.Description, w.MemberId, a.Id)
+		}
+		if err != nil {
+			tx.Rollback()
+			panic("saveAbsence insert work: " + err.Error())
+		}
+		ids = append(ids, id)
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("saveAbsence commit: " + err.Error())
+	}
+
+	// Add the new entries to the search index
+	for _, id := range ids {
+		indexForSearch("work", id)
+	}
+	return a.Id
+}
+
+// Delete an absence and the work entries generated for it
+func deleteAbsence(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic("deleteAbsence begin: " + err.Error())
+	}
+	err = deleteAbsenceWork(tx, id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteAbsence work: " + err.Error())
+	}
+	_, err = tx.Exec("delete from absence where id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		panic("deleteAbsence: " + err.Error())
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("deleteAbsence commit: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                            F E E D S                             //
+//------------------------------------------------------------------//
+
+// Record format for one calendar feed of work entries, read by calendar
+// apps from a URL with a secret token
+type Feed struct {
+	Id        int
+	Token     string
+	MemberId  int // work of one member, or
+	ProjectId int // work on one project, or everything if neither
+	CreatedAt string
+	// Joined fields from member and project
+	MemberName  string
+	ProjectName string
+	Client      string
+}
+
+// Get all calendar feeds, in the order created
+func getFeeds() []Feed {
+	return queryFeeds("order by f.id")
+}
+
+// Find a calendar feed by its token, false if not found
+func findFeed(token string) (Feed, bool) {
+	list := queryFeeds("where f.token = ?", token)
+	if len(list) == 0 {
+		return Feed{}, false
+	}
+	return list[0], true
+}
+
+// Get calendar feeds matching a where or order by clause
+func queryFeeds(clause string, args ...interface{}) []Feed {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select f.id, f.token, coalesce(f.member_id, 0), coalesce(f.project_id, 0), coalesce(f.created_at, ''),
+	          coalesce(m.name, ''), coalesce(p.name, ''), coalesce(cl.name, trim(p.client), '')
+	          from feed f
+	          left join member m on f.member_id = m.id
+	          left join project p on f.project_id = p.id
+	          left join client cl on p.client_id = cl.id ` + clause
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		panic("queryFeeds query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Feed{}
+	for rows.Next() {
+		var f Feed
+		err := rows.Scan(&f.Id, &f.Token, &f.MemberId, &f.ProjectId, &f.CreatedAt, &f.MemberName, &f.ProjectName, &f.Client)
+		if err != nil {
+			panic("queryFeeds next: " + err.Error())
+		}
+		list = append(list, f)
+	}
+	if rows.Err() != nil {
+		panic("queryFeeds exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Add a calendar feed, returning its ID
+func saveFeed(f Feed) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	f.Id = getMaxId("feed") + 1
+	_, err := db.Exec(`insert into feed (id, token, member_id, project_id, created_at)
+	                   values (?, ?, nullif(?, 0), nullif(?, 0), ?)`,
+		f.Id, f.Token, f.MemberId, f.ProjectId, time.Now().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		panic("saveFeed: " + err.Error())
+	}
+	return f.Id
+}
+
+// Delete a calendar feed, so its URL no longer works
+func deleteFeed(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from feed where id = ?", id)
+	if err != nil {
+		panic("deleteFeed: " + err.Error())
+	}
+}
+
+// Get the work entries for a calendar feed, of one member or on one
+// project if not zero, from a date on, with project and client names
+func getFeedWork(memberId, projectId int, startDate string) []Work {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select w.id, w.project_id, w.work_date, coalesce(w.start_time, ''), coalesce(w.end_time, ''),
+	          w.hours, coalesce(w.description, ''), coalesce(p.name, ''), coalesce(cl.name, trim(p.client), '')
+	          from work w
+	          left join project p on w.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          where substr(w.work_date, 1, 10) >= ?`
+	args := []interface{}{startDate}
+	if memberId != 0 {
+		query += " and w.member_id = ?"
+		args = append(args, memberId)
+	}
+	if projectId != 0 {
+		query += " and w.project_id = ?"
+		args = append(args, projectId)
+	}
+	rows, err := db.Query(query+" order by w.work_date, w.id", args...)
+	if err != nil {
+		panic("getFeedWork query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Work{}
+	for rows.Next() {
+		var w Work
+		var hrs string
+		err := rows.Scan(&w.Id, &w.ProjectId, &w.WorkDate, &w.StartTime, &w.EndTime, &hrs, &w.Description,
+			&w.ProjectName, &w.Client)
+		if err != nil {
+			panic("getFeedWork next: " + err.Error())
+		}
+		w.WorkDate = dateOnly(w.WorkDate)
+		w.Hours, _ = strconv.ParseFloat(hrs, 64)
+		list = append(list, w)
+	}
+	if rows.Err() != nil {
+		panic("getFeedWork exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+//------------------------------------------------------------------//
+//                         M E E T I N G S                          //
+//------------------------------------------------------------------//
+
+// Record format for a meeting imported from an iCalendar file, proposed as
+// a work entry until it's accepted or dismissed
+type Meeting struct {
+	Id        int
+	ExtUID    string // UID and start of the calendar event
+	MemberId  int    // team member who imported it, 0 if none
+	WorkDate  string
+	StartTime string
+	EndTime   string
+	Hours     float64
+	Summary   string // title of the event, description of the work entry
+	Attendees string // email addresses, comma separated
+	ProjectId int    // proposed project, 0 if none matched
+	Billable  bool
+	Status    string // pending, accepted or dismissed
+	WorkId    int    // work entry created when accepted
+	// Joined field from member
+	MemberName string
+}
+
+// Record format for a rule proposing a project for meetings, by a pattern
+// in the title or in an attendee's email address
+type MeetingRule struct {
+	Id        int
+	Field     string // title or attendee
+	Pattern   string
+	ProjectId int
+	// Joined fields from project and client
+	ProjectName string
+	Client      string
+}
+
+// Get the meetings with a status, by date and start time
+func getMeetings(status string) []Meeting {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select mt.id, mt.ext_uid, coalesce(mt.member_id, 0), mt.work_date, coalesce(mt.start_time, ''),
+	          coalesce(mt.end_time, ''), mt.hours, coalesce(mt.summary, ''), coalesce(mt.attendees, ''),
+	          coalesce(mt.project_id, 0), mt.billable, mt.status, coalesce(mt.work_id, 0), coalesce(m.name, '')
+	          from meeting mt
+	          left join member m on mt.member_id = m.id
+	          where mt.status = ?
+	          order by mt.work_date, mt.start_time, mt.id`
+	rows, err := db.Query(query, status)
+	if err != nil {
+		panic("getMeetings query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []Meeting{}
+	for rows.Next() {
+		var mt Meeting
+		var hrs, billable string
+		err := rows.Scan(&mt.Id, &mt.ExtUID, &mt.MemberId, &mt.WorkDate, &mt.StartTime, &mt.EndTime, &hrs,
+			&mt.Summary, &mt.Attendees, &mt.ProjectId, &billable, &mt.Status, &mt.WorkId, &mt.MemberName)
+		if err != nil {
+			panic("getMeetings next: " + err.Error())
+		}
+		mt.WorkDate = dateOnly(mt.WorkDate)
+		mt.Hours, _ = strconv.ParseFloat(hrs, 64)
+		mt.Billable = billable == "1" || billable == "true"
+		list = append(list, mt)
+	}
+	if rows.Err() != nil {
+		panic("getMeetings exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Get the number of meetings with each status
+func getMeetingCounts() map[string]int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query("select status, count(*) from meeting group by status")
+	if err != nil {
+		panic("getMeetingCounts query: " + err.Error())
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		err := rows.Scan(&status, &n)
+		if err != nil {
+			panic("getMeetingCounts next: " + err.Error())
+		}
+		counts[strings.TrimSpace(status)] = n
+	}
+	if rows.Err() != nil {
+		panic("getMeetingCounts exit: " + rows.Err().Error())
+	}
+	return counts
+}
+
+// Get the UIDs of the meetings imported by a team member, whatever their
+// status, to detect meetings imported again
+func getMeetingUIDs(memberId int) map[string]bool {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	rows, err := db.Query("select ext_uid from meeting where coalesce(member_id, 0) = ?", memberId)
+	if err != nil {
+		panic("getMeetingUIDs query: " + err.Error())
+	}
+	defer rows.Close()
+
+	uids := map[string]bool{}
+	for rows.Next() {
+		var uid string
+		err := rows.Scan(&uid)
+		if err != nil {
+			panic("getMeetingUIDs next: " + err.Error())
+		}
+		uids[uid] = true
+	}
+	if rows.Err() != nil {
+		panic("getMeetingUIDs exit: " + rows.Err().Error())
+	}
+	return uids
+}
+
+// Add imported meetings, all pending, in one transaction
+func addMeetings(list []Meeting) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic("addMeetings begin: " + err.Error())
+	}
+	for _, mt := range list {
+		_, err = tx.Exec(`insert into meeting (id, ext_uid, member_id, work_date, start_time, end_time, hours, summary,
+		                  attendees, project_id, billable, status)
+		                  values ((select coalesce(max(id), 0) + 1 from meeting), ?, nullif(?, 0), ?, ?, ?, ?, ?,
+		                  ?, nullif(?, 0), ?, 'pending')`,
+			mt.ExtUID, mt.MemberId, mt.WorkDate, mt.StartTime, mt.EndTime, mt.Hours, mt.Summary,
+			mt.Attendees, mt.ProjectId, mt.Billable)
+		if err != nil {
+			tx.Rollback()
+			panic("addMeetings insert: " + err.Error())
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("addMeetings commit: " + err.Error())
+	}
+}
+
+// Save changes to pending meetings: the proposed project, hours, summary
+// and billable flag, in one transaction
+func updateMeetings(list []Meeting) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic("updateMeetings begin: " + err.Error())
+	}
+	for _, mt := range list {
+		_, err = tx.Exec(`update meeting set project_id = nullif(?, 0), hours = ?, summary = ?, billable = ?
+		                  where id = ? and status = 'pending'`,
+			mt.ProjectId, mt.Hours, mt.Summary, mt.Billable, mt.Id)
+		if err != nil {
+			tx.Rollback()
+			panic("updateMeetings: " + err.Error())
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("updateMeetings commit: " + err.Error())
+	}
+}
+
+// Accept pending meetings, adding a work entry tagged "meeting" for each,
+// all in one transaction
+func acceptMeetings(list []Meeting) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic("acceptMeetings begin: " + err.Error())
+	}
+	ids := []int{}
+	for _, mt := range list {
+		var id int
+		err = tx.QueryRow("select coalesce(max(id), 0) + 1 from work").Scan(&id)
+		if err == nil {
+			_, err = tx.Exec(`insert into work (id, project_id, work_date, start_time, end_time, hours, billable,
+			                  description, member_id, status) values (?, ?, ?, ?, ?, ?, ?, ?, ?, 'draft')`,
+				id, mt.ProjectId, mt.WorkDate, mt.StartTime, mt.EndTime, mt.Hours, mt.Billable, mt.Summary, mt.MemberId)
+		}
+		if err == nil {
+			_, err = tx.Exec(`insert into work_tag (id, work_id, tag)
+			                  values ((select coalesce(max(id), 0) + 1 from work_tag), ?, 'meeting')`, id)
+		}
+		if err == nil {
+			_, err = tx.Exec(`update meeting set project_id = ?, hours = ?, summary = ?, billable = ?,
+			                  status = 'accepted', work_id = ? where id = ?`,
+				mt.ProjectId, mt.Hours, mt.Summary, mt.Billable, id, mt.Id)
+		}
+		if err != nil {
+			tx.Rollback()
+			panic("acceptMeetings: " + err.Error())
+		}
+		ids = append(ids, id)
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("acceptMeetings commit: " + err.Error())
+	}
+
+	// Add the new entries to the search index
+	for _, id := range ids {
+		indexForSearch("work", id)
+	}
+}
+
+// Dismiss pending meetings, keeping them so they're not proposed again
+func dismissMeetings(ids []int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	for _, id := range ids {
+		_, err := db.Exec("update meeting set status = 'dismissed' where id = ? and status = 'pending'", id)
+		if err != nil {
+			panic("dismissMeetings: " + err.Error())
+		}
+	}
+}
+
+// Get all meeting rules, in the order they're tried
+func getMeetingRules() []MeetingRule {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	query := `select r.id, r.field, r.pattern, r.project_id, coalesce(p.name, ''), coalesce(cl.name, trim(p.client), '')
+	          from meeting_rule r
+	          left join project p on r.project_id = p.id
+	          left join client cl on p.client_id = cl.id
+	          order by r.id`
+	rows, err := db.Query(query)
+	if err != nil {
+		panic("getMeetingRules query: " + err.Error())
+	}
+	defer rows.Close()
+
+	list := []MeetingRule{}
+	for rows.Next() {
+		var r MeetingRule
+		err := rows.Scan(&r.Id, &r.Field, &r.Pattern, &r.ProjectId, &r.ProjectName, &r.Client)
+		if err != nil {
+			panic("getMeetingRules next: " + err.Error())
+		}
+		r.Field = strings.TrimSpace(r.Field)
+		list = append(list, r)
+	}
+	if rows.Err() != nil {
+		panic("getMeetingRules exit: " + rows.Err().Error())
+	}
+	return list
+}
+
+// Add a meeting rule, returning its ID
+func saveMeetingRule(r MeetingRule) int {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	r.Id = getMaxId("meeting_rule") + 1
+	_, err := db.Exec("insert into meeting_rule (id, field, pattern, project_id) values (?, ?, ?, ?)",
+		r.Id, r.Field, r.Pattern, r.ProjectId)
+	if err != nil {
+		panic("saveMeetingRule: " + err.Error())
+	}
+	return r.Id
+}
+
+// Delete a meeting rule
+func deleteMeetingRule(id int) {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from meeting_rule where id = ?", id)
+	if err != nil {
+		panic("deleteMeetingRule: " + err.Error())
+	}
+}
+
+//------------------------------------------------------------------//
+//                           S E A R C H                            //
+//------------------------------------------------------------------//
+
+// Whether the SQLite build has FTS5, for the full-text search index. Set at
+// startup by initSearch (see search.go).
+var ftsAvailable bool
+
+// Where the text indexed for each kind of record comes from: the table and
+// its alias, and expressions for the name and the rest of the text, which
+// are searched in separate columns
+type searchSource struct {
+	from, alias string
+	name, body  string
+}
+
+var searchSources = map[string]searchSource{
+	"work": {"work w", "w", "''", "coalesce(w.description, '')"},
+	"project": {"project p left join client cl on p.client_id = cl.id", "p", "p.name",
+		"trim(coalesce(p.description, '') || ' ' || coalesce(cl.name, trim(p.client), ''))"},
+	"contact": {"contact c", "c", "coalesce(c.first_name, '') || ' ' || coalesce(c.last_name, '')",
+		`trim(coalesce(c.company, '') || ' ' || coalesce(c.title, '') || ' ' || coalesce(c.source, '') || ' ' ||
+		      coalesce(c.phones, '') || ' ' || coalesce(c.emails, '') || ' ' || coalesce(c.address, '') || ' ' ||
+		      coalesce(c.comments, ''))`},
+}
+
+// Query to add records of one kind to the search index, all of them or
+// only those meeting a condition
+func (src searchSource) insertSQL(kind, where string) string {
+	q := "insert into search_index (kind, item_id, name, body) select '" + kind + "', " +
+		src.alias + ".id, " + src.name + ", " + src.body + " from " + src.from
+	if where != "" {
+		q += " where " + where
+	}
+	return q
+}
+
+// Create the full-text search index if it doesn't exist, returning false if
+// this SQLite build doesn't have FTS5
+func createSearchIndex() bool {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec(`create virtual table if not exists search_index using fts5(
+	                   kind unindexed, item_id unindexed, name, body, tokenize = 'unicode61 remove_diacritics 2')`)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return false
+		}
+		panic("createSearchIndex: " + err.Error())
+	}
+
+	// The table may already exist from a build with FTS5, so check that it
+	// can be read
+	var n int
+	err = db.QueryRow("select count(*) from search_index").Scan(&n)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return false
+		}
+		panic("createSearchIndex count: " + err.Error())
+	}
+	return true
+}
+
+// Fill the search index again from all work entries, projects and contacts
+func rebuildSearchIndex() {
+	if !ftsAvailable {
+		return
+	}
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Replace everything in one transaction
+	tx, err := db.Begin()
+	if err != nil {
+		panic("rebuildSearchIndex begin: " + err.Error())
+	}
+	_, err = tx.Exec("delete from search_index")
+	if err != nil {
+		tx.Rollback()
+		panic("rebuildSearchIndex delete: " + err.Error())
+	}
+	for kind, src := range searchSources {
+		_, err = tx.Exec(src.insertSQL(kind, ""))
+		if err != nil {
+			tx.Rollback()
+			panic("rebuildSearchIndex " + kind + ": " + err.Error())
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		panic("rebuildSearchIndex commit: " + err.Error())
+	}
+}
+
+// Update the search index for one record after it was saved or deleted
+// (kind is "work", "project" or "contact")
+func indexForSearch(kind string, id int) {
+	if !ftsAvailable {
+		return
+	}
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Remove old text, and add new text if the record still exists
+	_, err := db.Exec("delete from search_index where kind = ? and item_id = ?", kind, id)
+	if err != nil {
+		panic("indexForSearch delete: " + err.Error())
+	}
+	src := searchSources[kind]
+	_, err = db.Exec(src.insertSQL(kind, src.alias+".id = ?"), id)
+	if err != nil {
+		panic("indexForSearch insert: " + err.Error())
+	}
+}
+
+// Update the search index for all projects of a client, e.g. after the
+// client was renamed
+func indexClientProjectsForSearch(clientId int) {
+	if !ftsAvailable {
+		return
+	}
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	_, err := db.Exec("delete from search_index where kind = 'project' and item_id in (select id from project where client_id = ?)", clientId)
+	if err != nil {
+		panic("indexClientProjectsForSearch delete: " + err.Error())
+	}
+	_, err = db.Exec(searchSources["project"].insertSQL("project", "p.client_id = ?"), clientId)
+	if err != nil {
+		panic("indexClientProjectsForSearch insert: " + err.Error())
+	}
+}
+
+// Record format for one search result, with the text matched, either a
+// snippet with matches between \x01 and \x02 from the search index, or the
+// whole text if searched without the index
+type SearchHit struct {
+	Kind   string // work, project or contact
+	Id     int
+	Title  string
+	Detail string
+	Text   string
+}
+
+// Search the full-text index for records of one kind, best matches first
+func searchIndex(kind, match string, limit int) []SearchHit {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Join to the records for titles, the index has only the text searched
+	snippet := "snippet(search_index, -1, char(1), char(2), '…', 16)"
+	var q string
+	switch kind {
+	case "work":
+		q = `select w.id, substr(w.work_date, 1, 10), coalesce(cl.name, trim(p.client), '') || ' - ' || p.name, ` + snippet + `
+		     from search_index s
+		     inner join work w on w.id = s.item_id
+		     left join project p on w.project_id = p.id
+		     left join client cl on p.client_id = cl.id`
+	case "project":
+		q = `select p.id, p.name, coalesce(cl.name, trim(p.client), ''), ` + snippet + `
+		     from search_index s
+		     inner join project p on p.id = s.item_id
+		     left join client cl on p.client_id = cl.id`
+	case "contact":
+		q = `select c.id, coalesce(c.first_name, '') || ' ' || coalesce(c.last_name, ''), coalesce(c.company, ''), ` + snippet + `
+		     from search_index s
+		     inner join contact c on c.id = s.item_id`
+	default:
+		panic("searchIndex: unknown kind " + kind)
+	}
+	q += " where s.kind = ? and search_index match ? order by s.rank limit ?"
+	rows, err := db.Query(q, kind, match, limit)
+	if err != nil {
+		panic("searchIndex query: " + err.Error())
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		h := SearchHit{Kind: kind}
+		err := rows.Scan(&h.Id, &h.Title, &h.Detail, &h.Text)
+		if err != nil {
+			panic("searchIndex next: " + err.Error())
+		}
+		hits = append(hits, h)
+	}
+	if rows.Err() != nil {
+		panic("searchIndex exit: " + rows.Err().Error())
+	}
+	return hits
+}
+
+// Search records of one kind without the index, for text containing all the
+// words given (ignoring case), newest or alphabetically first
+func searchLike(kind string, words []string, limit int) []SearchHit {
+
+	// Connect to database
+	db := dbConnect()
+	defer db.Close()
+
+	// Text searched, as in the index, and order of results
+	var q, order string
+	switch kind {
+	case "work":
+		q = `select w.id, substr(w.work_date, 1, 10), coalesce(cl.name, trim(p.client), '') || ' - ' || p.name, %s
+		     from work w
+		     left join project p on w.project_id = p.id
+		     left join client cl on p.client_id = cl.id`
+		order = "w.work_date desc, w.id desc"
+	case "project":
+		q = `select p.id, p.name, coalesce(cl.name, trim(p.client), ''), %s
+		     from project p left join client cl on p.client_id = cl.id`
+		order = "lower(p.name)"
+	case "contact":
+		q = `select c.id, coalesce(c.first_name, '') || ' ' || coalesce(c.last_name, ''), coalesce(c.company, ''), %s
+		     from contact c`
+		order = "lower(c.last_name), lower(c.first_name)"
+	default:
+		panic("searchLike: unknown kind " + kind)
+	}
+	src := searchSources[kind]
+	text := "(" + src.name + " || ' ' || " + src.body + ")"
+	q = fmt.Sprintf(q, text)
+
+	// All words must appear somewhere in the text
+	args := []interface{}{}
+	clauses := []string{}
+	for _, word := range words {
+		clauses = append(clauses, text+" like ?")
+		args = append(args, "%"+word+"%")
+	}
+	q += " where " + strings.Join(clauses, " and ") + " order by " + order + " limit ?"
+	rows, err := db.Query(q, append(args, limit)...)
+	if err != nil {
+		panic("searchLike query: " + err.Error())
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		h := SearchHit{Kind: kind}
+		err := rows.Scan(&h.Id, &h.Title, &h.Detail, &h.Text)
+		if err != nil {
+			panic("searchLike next: " + err.Error())
+		}
+		hits = append(hits, h)
+	}
+	if rows.Err() != nil {
+		panic("searchLike exit: " + rows.Err().Error())
+	}
+	return hits
+}
@@ -0,0 +1,267 @@
+// Page handlers for expenses on projects (travel, materials, etc.), with an
+// optional receipt file for each. Billable expenses can be included on
+// invoices.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Directory where receipt files are kept
+const receiptsDir = "receipts"
+
+// Largest receipt file that can be uploaded
+const maxReceiptSize = 10 << 20
+
+// File types accepted for receipts
+var receiptTypes = []string{".pdf", ".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic"}
+
+// Valid expense categories
+var expenseCategories = []string{"Travel", "Accommodation", "Meals", "Materials", "Software", "Other"}
+
+// Check whether an existing expense can still be changed, returning an
+// error message if not, or a blank string if it can
+func expenseLockedMessage(e Expense) string {
+	if e.InvoiceId > 0 {
+		return fmt.Sprintf("This expense has been invoiced (invoice %d), delete the draft invoice first to change it",
+			getInvoice(e.InvoiceId).Number)
+	}
+	if l, locked := findPeriodLock(e.ExpenseDate, e.Client); locked {
+		return "This expense is in a locked period (" + lockDescription(l) + "), reopen the period first to change it"
+	}
+	return ""
+}
+
+// Page to create/edit an expense. New expenses are for the project given
+// in the "project" query parameter.
+func editExpense(c *gin.Context) {
+
+	// Get expense ID from URL, 0 means new expense
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid expense ID")
+		return
+	}
+
+	var e Expense
+	if id == 0 {
+		projectId, _ := strconv.Atoi(c.Query("project"))
+		p, _ := findProject(projectId)
+		e = Expense{
+			ProjectId:   projectId,
+			ExpenseDate: time.Now().Format("2006-01-02"),
+			Currency:    getProjectCurrency(p),
+			Category:    "Travel",
+			Billable:    p.IsBillable(),
+		}
+	} else {
+		var found bool
+		e, found = findExpense(id)
+		if !found {
+			c.String(http.StatusNotFound, "Expense not found")
+			return
+		}
+	}
+	showExpenseForm(c, e, ValidationErrors{})
+}
+
+// Show the expense form, with error messages if any
+func showExpenseForm(c *gin.Context, e Expense, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "edit_expense.html", gin.H{
+		"e":          e,
+		"projects":   getActiveProjects(),
+		"categories": expenseCategories,
+		"errors":     errs,
+		"current":    "projects",
+	})
+}
+
+// Handle save of an expense, including upload of a receipt file
+func saveExpenseForm(c *gin.Context) {
+
+	// Parse fields, collecting errors for any that can't be parsed
+	errs := ValidationErrors{}
+	id, _ := strconv.Atoi(c.PostForm("id"))
+	projectId, err := strconv.Atoi(c.PostForm("project_id"))
+	if err != nil {
+		errs["project_id"] = "Please select a project"
+	}
+	amount, err := strconv.ParseFloat(c.PostForm("amount"), 64)
+	if err != nil {
+		errs["amount"] = "Please enter the amount as a number, e.g. 12.50"
+	}
+	e := Expense{
+		Id:          id,
+		ProjectId:   projectId,
+		ExpenseDate: c.PostForm("expense_date"),
+		Amount:      amount,
+		Currency:    strings.ToUpper(strings.TrimSpace(c.PostForm("currency"))),
+		Category:    c.PostForm("category"),
+		Billable:    c.PostForm("billable") == "on",
+		Description: strings.TrimSpace(c.PostForm("description")),
+	}
+
+	// Keep the existing receipt unless it is being removed or replaced
+	var old Expense
+	if id > 0 {
+		old, _ = findExpense(id)
+		if msg := expenseLockedMessage(old); msg != "" {
+			errs["form"] = msg
+		}
+		if c.PostForm("remove_receipt") != "on" {
+			e.Receipt = old.Receipt
+		}
+	}
+
+	// Validate the rest
+	for field, msg := range validateExpense(e) {
+		if errs[field] == "" {
+			errs[field] = msg
+		}
+	}
+
+	// Check the receipt file, if one was uploaded
+	file, err := c.FormFile("receipt")
+	if err == nil {
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		validType := false
+		for _, t := range receiptTypes {
+			if ext == t {
+				validType = true
+			}
+		}
+		if !validType {
+			errs["receipt"] = "Receipt must be one of " + strings.Join(receiptTypes, ", ")
+		} else if file.Size > maxReceiptSize {
+			errs["receipt"] = fmt.Sprintf("Receipt cannot be larger than %d MB", maxReceiptSize>>20)
+		}
+	}
+
+	if len(errs) > 0 {
+		showExpenseForm(c, e, errs)
+		return
+	}
+
+	// Save the receipt file, with a time stamp to make the name unique
+	if file != nil {
+		err = os.MkdirAll(receiptsDir, 0755)
+		if err != nil {
+			panic("saveExpenseForm mkdir: " + err.Error())
+		}
+		e.Receipt = time.Now().Format("20060102150405") + "-" + safeFileName(file.Filename)
+		err = c.SaveUploadedFile(file, filepath.Join(receiptsDir, e.Receipt))
+		if err != nil {
+			panic("saveExpenseForm upload: " + err.Error())
+		}
+	}
+
+	saveExpense(e)
+
+	// Remove the old receipt if it was replaced or removed
+	if old.Receipt != "" && old.Receipt != e.Receipt {
+		os.Remove(filepath.Join(receiptsDir, old.Receipt))
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/project/%d", e.ProjectId))
+}
+
+// Make a file name safe to store, keeping only letters, digits, dots,
+// dashes and underscores
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, filepath.Base(name))
+}
+
+// Handle deletion of an expense, and its receipt file
+func deleteExpenseHandler(c *gin.Context) {
+
+	// Get expense ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid expense ID")
+		return
+	}
+	e, found := findExpense(id)
+	if !found {
+		c.String(http.StatusNotFound, "Expense not found")
+		return
+	}
+
+	// Can't delete one that has been billed or is in a locked period
+	if msg := expenseLockedMessage(e); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	deleteExpense(id)
+	if e.Receipt != "" {
+		os.Remove(filepath.Join(receiptsDir, e.Receipt))
+	}
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/project/%d", e.ProjectId))
+}
+
+// Send the receipt file for an expense
+func showReceipt(c *gin.Context) {
+
+	// Get expense ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid expense ID")
+		return
+	}
+	e, found := findExpense(id)
+	if !found || e.Receipt == "" {
+		c.String(http.StatusNotFound, "No receipt for this expense")
+		return
+	}
+	c.File(filepath.Join(receiptsDir, e.Receipt))
+}
+
+// Make invoice items for a list of expenses, billed at cost and converted
+// to the invoice currency at the rate on the date of each expense. Returns
+// the items and their total amount, or an error if an exchange rate is
+// missing.
+func buildExpenseItems(expenses []Expense, currency string, cv *Converter) ([]InvoiceItem, float64, error) {
+	items := []InvoiceItem{}
+	total := 0.0
+	for _, e := range expenses {
+		amount, ok := cv.Convert(e.Amount, e.Currency, currency, e.ExpenseDate)
+		if !ok {
+			return nil, 0, fmt.Errorf("no exchange rate to convert %s to %s", e.Currency, currency)
+		}
+		desc := e.Category
+		if e.Description != "" {
+			desc += ": " + e.Description
+		}
+		if e.Currency != currency {
+			desc += fmt.Sprintf(" (%.2f %s)", e.Amount, e.Currency)
+		}
+		items = append(items, InvoiceItem{
+			ExpenseId:   e.Id,
+			ProjectId:   e.ProjectId,
+			ProjectName: e.ProjectName,
+			ItemDate:    e.ExpenseDate,
+			Description: desc,
+			Amount:      amount,
+		})
+		total += amount
+	}
+	return items, total, nil
+}
@@ -0,0 +1,173 @@
+// Calendar feeds of work entries, in iCalendar (ICS) format, for calendar
+// apps to subscribe to and show logged time next to other events. There's
+// a feed for everything, and feeds for one member's work or one project.
+// Feeds can't use a login, so each has a secret token in its URL instead,
+// and deleting a feed stops its URL from working.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Months of work entries in a feed, before today
+const feedMonths = 12
+
+// Name of a feed, as shown in calendar apps
+func (f Feed) Name() string {
+	switch {
+	case f.MemberId != 0:
+		return "Work: " + f.MemberName
+	case f.ProjectId != 0 && f.Client != "":
+		return "Work: " + f.Client + " - " + f.ProjectName
+	case f.ProjectId != 0:
+		return "Work: " + f.ProjectName
+	}
+	return "Work"
+}
+
+// URL of a feed on the host of the request
+func feedURL(c *gin.Context, f Feed) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/ics/" + f.Token + ".ics"
+}
+
+// Make a new secret token for a feed
+func newFeedToken() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic("newFeedToken: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Calendar event for a work entry: at its start and end times if it has
+// them, otherwise all day with the hours in the summary
+func workEvent(w Work) (ICalEvent, bool) {
+	date, err := time.ParseInLocation("2006-01-02", w.WorkDate, time.Local)
+	if err != nil {
+		return ICalEvent{}, false
+	}
+	name := w.ProjectName
+	if w.Client != "" {
+		name = w.Client + " - " + name
+	}
+	e := ICalEvent{
+		UID:         fmt.Sprintf("work-%d@timelog2", w.Id),
+		Summary:     name,
+		Description: w.Description,
+	}
+	from, ok1 := clockMinutes(w.StartTime)
+	to, ok2 := clockMinutes(w.EndTime)
+	if ok1 && ok2 && to > from {
+		y, m, d := date.Date()
+		e.Start = time.Date(y, m, d, from/60, from%60, 0, 0, time.Local)
+		e.End = time.Date(y, m, d, to/60, to%60, 0, 0, time.Local)
+	} else {
+		e.Summary = fmt.Sprintf("%.2fh %s", w.Hours, name)
+		e.Start, e.End, e.AllDay = date, date.AddDate(0, 0, 1), true
+	}
+	return e, true
+}
+
+// Page showing calendar feeds, with a form to add one
+func showFeeds(c *gin.Context) {
+	type feedLink struct {
+		Feed
+		URL string
+	}
+	feeds := []feedLink{}
+	for _, f := range getFeeds() {
+		feeds = append(feeds, feedLink{f, feedURL(c, f)})
+	}
+	c.HTML(http.StatusOK, "feeds.html", gin.H{
+		"feeds":    feeds,
+		"members":  getMembers(),
+		"projects": getActiveProjects(),
+		"months":   feedMonths,
+		"current":  "settings",
+	})
+}
+
+// Handle form submission to add a feed, for "all", "member:<id>" or
+// "project:<id>"
+func addFeedForm(c *gin.Context) {
+	f := Feed{Token: newFeedToken()}
+	kind, idStr, _ := strings.Cut(c.PostForm("scope"), ":")
+	id, _ := strconv.Atoi(idStr)
+	switch kind {
+	case "all":
+	case "member":
+		if _, found := findMember(id); !found {
+			c.String(http.StatusBadRequest, "Invalid member")
+			return
+		}
+		f.MemberId = id
+	case "project":
+		if _, found := findProject(id); !found {
+			c.String(http.StatusBadRequest, "Invalid project")
+			return
+		}
+		f.ProjectId = id
+	default:
+		c.String(http.StatusBadRequest, "Please choose what the feed is for")
+		return
+	}
+
+	saveFeed(f)
+	c.Redirect(http.StatusSeeOther, "/feeds")
+}
+
+// Handle deletion of a feed
+func deleteFeedHandler(c *gin.Context) {
+
+	// Get feed ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid feed ID")
+		return
+	}
+
+	deleteFeed(id)
+	c.Redirect(http.StatusSeeOther, "/feeds")
+}
+
+// Serve a feed as an iCalendar file, for the token in the file name
+func serveFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("file"), ".ics")
+	f, found := findFeed(token)
+	if !found || token == "" {
+		c.String(http.StatusNotFound, "Feed not found")
+		return
+	}
+
+	// Events for work entries of the last months, and any after today
+	start := time.Now().AddDate(0, -feedMonths, 0).Format("2006-01-02")
+	events := []ICalEvent{}
+	for _, w := range getFeedWork(f.MemberId, f.ProjectId, start) {
+		if e, ok := workEvent(w); ok {
+			events = append(events, e)
+		}
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", "inline; filename=\"work.ics\"")
+	c.Status(http.StatusOK)
+	// A write error means the calendar app went away, nothing to tell it
+	err := writeICal(c.Writer, f.Name(), events)
+	if err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,133 @@
+// Yearly activity heatmap: one square per day, in a column for each week,
+// shaded by the hours logged that day, like a contribution graph.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Colors of the heatmap squares, from no hours to a full day or more
+var heatmapColors = []string{"#ebedf0", "#9be9a8", "#40c463", "#30a14e", "#216e39"}
+
+// One day on the heatmap, nil for days outside the year
+type HeatmapDay struct {
+	Date  string
+	Title string // date and hours, shown on hover
+	Hours float64
+	Color string
+	Link  string
+}
+
+// Page showing the heatmap for a year, for all work or one project or
+// category
+func showHeatmap(c *gin.Context) {
+
+	// Year and filter from query string
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(time.Now().Year())))
+	if err != nil || year < 1900 || year > 9999 {
+		c.String(http.StatusBadRequest, "Invalid year")
+		return
+	}
+	projectId, _ := strconv.Atoi(c.Query("project"))
+	f := LogFilter{ProjectId: projectId, Category: c.Query("category")}
+
+	// Hours by day, in one query
+	first := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local)
+	last := time.Date(year, 12, 31, 0, 0, 0, 0, time.Local)
+	hours := getWorkHoursByDay(f, first.Format("2006-01-02"), last.Format("2006-01-02"))
+
+	// Shades are quarters of a day's target hours, or of 8 hours if there is
+	// no target
+	daily := weeklyTarget() / 5
+	if daily <= 0 {
+		daily = 8
+	}
+
+	// Rows of days, one for each day of the week, with a column for each week
+	// and the month names over the columns where months start. Days link to
+	// the calendar, or to the log if filtered, as the calendar isn't.
+	locale := currentLocale()
+	weekDay := firstDayOfWeek()
+	rows := make([][]*HeatmapDay, 7)
+	months := []string{}
+	var total, maxHours float64
+	daysWorked := 0
+	for ws := weekStartOn(first, weekDay); !ws.After(last); ws = ws.AddDate(0, 0, 7) {
+		month := ""
+		for i := 0; i < 7; i++ {
+			d := ws.AddDate(0, 0, i)
+			if d.Year() != year {
+				rows[i] = append(rows[i], nil)
+				continue
+			}
+			if d.Day() == 1 {
+				month = locale.ShortMonths[d.Month()-1]
+			}
+			ds := d.Format("2006-01-02")
+			h := hours[ds]
+			day := &HeatmapDay{
+				Date:  ds,
+				Title: fmt.Sprintf("%s: %.2f hours", locale.Date(d), h),
+				Hours: h,
+				Color: heatmapColors[0],
+				Link:  "/calendar?view=day&date=" + ds,
+			}
+			if f.IsSet() {
+				df := f
+				df.From, df.To = ds, ds
+				day.Link = "/log?" + df.Query()
+			}
+			if h > 0 {
+				level := int(h/daily*4 + 0.999)
+				if level >= len(heatmapColors) {
+					level = len(heatmapColors) - 1
+				}
+				day.Color = heatmapColors[level]
+				total += h
+				daysWorked++
+				if h > maxHours {
+					maxHours = h
+				}
+			}
+			rows[i] = append(rows[i], day)
+		}
+		months = append(months, month)
+	}
+
+	// Legend, with the hours at the top of each shade
+	type legendItem struct{ Color, Title string }
+	legend := []legendItem{{heatmapColors[0], "No hours"}}
+	for i := 1; i < len(heatmapColors); i++ {
+		title := fmt.Sprintf("Up to %.2f hours", daily*float64(i)/4)
+		if i == len(heatmapColors)-1 {
+			title = fmt.Sprintf("More than %.2f hours", daily*float64(i-1)/4)
+		}
+		legend = append(legend, legendItem{heatmapColors[i], title})
+	}
+
+	average := 0.0
+	if daysWorked > 0 {
+		average = total / float64(daysWorked)
+	}
+	c.HTML(http.StatusOK, "heatmap.html", gin.H{
+		"year":       year,
+		"filter":     f,
+		"projects":   getProjects(),
+		"categories": projectCategories,
+		"rows":       rows,
+		"dayNames":   locale.WeekDays(weekDay),
+		"months":     months,
+		"legend":     legend,
+		"total":      total,
+		"daysWorked": daysWorked,
+		"average":    average,
+		"maxHours":   maxHours,
+		"current":    "reports",
+	})
+}
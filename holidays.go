@@ -0,0 +1,243 @@
+// Page handlers for holiday calendars, e.g. the public holidays of a
+// country, entered by hand or imported from iCalendar files. Holidays of
+// active calendars are shown on the calendar and are not workdays.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest iCalendar file that can be imported
+const maxICalSize = 2 << 20
+
+// Most days of one event imported as holidays
+const maxHolidayDays = 31
+
+// Page showing all holiday calendars, with forms to add or import one
+func showHolidayCalendars(c *gin.Context) {
+	showHolidayCalendarsPage(c, HolidayCalendar{Active: true}, ValidationErrors{})
+}
+
+// Show the holiday calendars page, with the form filled in and any errors
+func showHolidayCalendarsPage(c *gin.Context, hc HolidayCalendar, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "holidays.html", gin.H{
+		"calendars": getHolidayCalendars(),
+		"hc":        hc,
+		"errors":    errs,
+		"current":   "settings",
+	})
+}
+
+// Page showing the holidays of one calendar, with forms to add holidays,
+// import them, or rename the calendar
+func showHolidayCalendar(c *gin.Context) {
+
+	// Get calendar ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid holiday calendar ID")
+		return
+	}
+	hc, found := findHolidayCalendar(id)
+	if !found {
+		c.String(http.StatusNotFound, "Holiday calendar not found")
+		return
+	}
+	showHolidayCalendarPage(c, hc, Holiday{}, ValidationErrors{}, c.Query("imported"))
+}
+
+// Show one holiday calendar, with the forms filled in and any errors, and
+// a message about an import if any
+func showHolidayCalendarPage(c *gin.Context, hc HolidayCalendar, h Holiday, errs ValidationErrors, imported string) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	saved, _ := findHolidayCalendar(hc.Id)
+	c.HTML(status, "holiday_calendar.html", gin.H{
+		"hc":       hc,
+		"name":     saved.Name,
+		"holidays": getHolidays(hc.Id),
+		"h":        h,
+		"imported": imported,
+		"errors":   errs,
+		"current":  "settings",
+	})
+}
+
+// Handle form submission to add a holiday calendar, or rename one or turn
+// it on or off
+func saveHolidayCalendarForm(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.PostForm("id"))
+	hc := HolidayCalendar{
+		Id:     id,
+		Name:   strings.TrimSpace(c.PostForm("name")),
+		Active: c.PostForm("active") == "on",
+	}
+	if id > 0 {
+		if _, found := findHolidayCalendar(id); !found {
+			c.String(http.StatusNotFound, "Holiday calendar not found")
+			return
+		}
+	}
+
+	// Validate, and show the form again if there are any errors
+	errs := validateHolidayCalendar(hc)
+	if len(errs) > 0 {
+		if id > 0 {
+			showHolidayCalendarPage(c, hc, Holiday{}, errs, "")
+		} else {
+			showHolidayCalendarsPage(c, hc, errs)
+		}
+		return
+	}
+
+	id = saveHolidayCalendar(hc)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/holiday_calendar/%d", id))
+}
+
+// Handle deletion of a holiday calendar and its holidays
+func deleteHolidayCalendarHandler(c *gin.Context) {
+
+	// Get calendar ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid holiday calendar ID")
+		return
+	}
+
+	deleteHolidayCalendar(id)
+	c.Redirect(http.StatusSeeOther, "/holidays")
+}
+
+// Handle form submission to add one holiday to a calendar
+func saveHolidayForm(c *gin.Context) {
+
+	calendarId, _ := strconv.Atoi(c.PostForm("calendar_id"))
+	hc, found := findHolidayCalendar(calendarId)
+	if !found {
+		c.String(http.StatusNotFound, "Holiday calendar not found")
+		return
+	}
+	h := Holiday{
+		CalendarId:  calendarId,
+		HolidayDate: c.PostForm("holiday_date"),
+		Name:        strings.TrimSpace(c.PostForm("holiday_name")),
+	}
+
+	// Validate, and show the form again if there are any errors
+	errs := validateHoliday(h)
+	if len(errs) > 0 {
+		showHolidayCalendarPage(c, hc, h, errs, "")
+		return
+	}
+
+	saveHolidays(calendarId, []Holiday{h})
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/holiday_calendar/%d", calendarId))
+}
+
+// Handle deletion of one holiday
+func deleteHolidayHandler(c *gin.Context) {
+
+	// Get holiday ID from URL, and calendar to go back to from query
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid holiday ID")
+		return
+	}
+	calendarId, _ := strconv.Atoi(c.Query("calendar"))
+
+	deleteHoliday(id)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/holiday_calendar/%d", calendarId))
+}
+
+// Handle upload of an iCalendar file, adding its events as holidays to a
+// calendar, or to a new calendar named after the file if none is given.
+// Each day of an event is a holiday, up to a month. Holidays already in
+// the calendar are skipped, so the same file can be imported again.
+func importHolidaysForm(c *gin.Context) {
+
+	// Calendar to add to, or a new one
+	calendarId, _ := strconv.Atoi(c.PostForm("calendar_id"))
+	hc := HolidayCalendar{Active: true}
+	if calendarId > 0 {
+		var found bool
+		hc, found = findHolidayCalendar(calendarId)
+		if !found {
+			c.String(http.StatusNotFound, "Holiday calendar not found")
+			return
+		}
+	}
+	showErrors := func(errs ValidationErrors) {
+		if calendarId > 0 {
+			showHolidayCalendarPage(c, hc, Holiday{}, errs, "")
+		} else {
+			showHolidayCalendarsPage(c, hc, errs)
+		}
+	}
+
+	// Read the events from the file
+	file, err := c.FormFile("ics")
+	if err != nil {
+		showErrors(ValidationErrors{"ics": "Please choose an iCalendar (.ics) file"})
+		return
+	}
+	if file.Size > maxICalSize {
+		showErrors(ValidationErrors{"ics": fmt.Sprintf("File cannot be larger than %d MB", maxICalSize>>20)})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		panic("importHolidaysForm open: " + err.Error())
+	}
+	defer f.Close()
+	events, err := parseICal(f)
+	if err != nil {
+		showErrors(ValidationErrors{"ics": "Could not read " + file.Filename + ": " + err.Error()})
+		return
+	}
+
+	// Holidays for each day of each event
+	holidays := []Holiday{}
+	for _, e := range events {
+		name := strings.TrimSpace(e.Summary)
+		if len(name) > 128 {
+			name = name[:128]
+		}
+		for _, d := range e.Dates(maxHolidayDays) {
+			holidays = append(holidays, Holiday{HolidayDate: d, Name: name})
+		}
+	}
+	if len(holidays) == 0 {
+		showErrors(ValidationErrors{"ics": "There are no events in " + file.Filename})
+		return
+	}
+
+	// New calendar, named after the file unless a name is given
+	if calendarId == 0 {
+		hc.Name = strings.TrimSpace(c.PostForm("name"))
+		if hc.Name == "" {
+			hc.Name = strings.TrimSuffix(file.Filename, ".ics")
+		}
+		errs := validateHolidayCalendar(hc)
+		if len(errs) > 0 {
+			showErrors(errs)
+			return
+		}
+		calendarId = saveHolidayCalendar(hc)
+	}
+
+	n := saveHolidays(calendarId, holidays)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/holiday_calendar/%d?imported=%d", calendarId, n))
+}
@@ -0,0 +1,222 @@
+// Reading and writing iCalendar (.ics) files, e.g. to import public
+// holidays and meetings, or publish work entries. Only the parts needed
+// here are read and written: the UID, summary, description, start, end and
+// attendees of each event. Recurring events are read as their first
+// occurrence.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// One event of an iCalendar file
+type ICalEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time // exclusive, e.g. midnight after the last day of an all-day event
+	AllDay      bool
+	Attendees   []string // email addresses, lower case
+}
+
+// Dates of the days an event is on, at most maxDays
+func (e ICalEvent) Dates(maxDays int) []string {
+	dates := []string{}
+	d := time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.Local)
+	for len(dates) == 0 || (d.Before(e.End) && len(dates) < maxDays) {
+		dates = append(dates, d.Format("2006-01-02"))
+		d = d.AddDate(0, 0, 1)
+	}
+	return dates
+}
+
+// Read the events from an iCalendar file
+func parseICal(r io.Reader) ([]ICalEvent, error) {
+
+	// Read lines, joining folded lines, which continue on the next line
+	// after a space or tab
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, errors.New("not an iCalendar file")
+	}
+
+	// Properties of each event
+	events := []ICalEvent{}
+	var e *ICalEvent
+	for _, line := range lines {
+		name, params, value := icalProperty(line)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			e = &ICalEvent{}
+		case e == nil:
+			// Outside an event
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if e.Start.IsZero() {
+				return nil, fmt.Errorf("event \"%s\" has no start", e.Summary)
+			}
+			if e.End.IsZero() || !e.End.After(e.Start) {
+				e.End = e.Start
+				if e.AllDay {
+					e.End = e.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *e)
+			e = nil
+		case name == "UID":
+			e.UID = value
+		case name == "SUMMARY":
+			e.Summary = icalUnescape(value)
+		case name == "DESCRIPTION":
+			e.Description = icalUnescape(value)
+		case name == "ATTENDEE":
+			email := strings.ToLower(value)
+			email = strings.TrimPrefix(email, "mailto:")
+			if email != "" {
+				e.Attendees = append(e.Attendees, email)
+			}
+		case name == "DTSTART" || name == "DTEND":
+			t, allDay, err := icalTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("event \"%s\": invalid %s \"%s\"", e.Summary, name, value)
+			}
+			if name == "DTSTART" {
+				e.Start, e.AllDay = t, allDay
+			} else {
+				e.End = t
+			}
+		}
+	}
+	return events, nil
+}
+
+// Split a content line into its name (upper case), parameters and value,
+// e.g. "DTSTART;TZID=Europe/Berlin:20250101T090000". Parameter values in
+// quotes can have colons and semicolons, e.g. CN="Smith; Bob".
+func icalProperty(line string) (string, map[string]string, string) {
+	parts := []string{}
+	quoted, from := false, 0
+	value := ""
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if !quoted && (r == ';' || r == ':') {
+			parts = append(parts, line[from:i])
+			from = i + 1
+			if r == ':' {
+				value = line[from:]
+				break
+			}
+		}
+	}
+	if from == 0 {
+		parts = append(parts, line)
+	}
+	params := map[string]string{}
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+// Parse a date or date and time value, true if it's a date without time.
+// Times are in UTC if they end in Z, in the time zone given by a TZID
+// parameter if it's known, otherwise local.
+func icalTime(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t.Local(), false, err
+	}
+	loc := time.Local
+	if tz, err := time.LoadLocation(params["TZID"]); err == nil && params["TZID"] != "" {
+		loc = tz
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t.Local(), false, err
+}
+
+// Undo the escaping of commas, semicolons, backslashes and newlines in text
+func icalUnescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// Write events as an iCalendar file, with a name for the calendar
+func writeICal(w io.Writer, name string, events []ICalEvent) error {
+	b := bufio.NewWriter(w)
+	line := func(s string) {
+		b.WriteString(icalFold(s) + "\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//timelog2//Work entries//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icalEscape(name))
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + stamp)
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + e.End.Format("20060102"))
+		} else {
+			line("DTSTART:" + e.Start.UTC().Format("20060102T150405Z"))
+			line("DTEND:" + e.End.UTC().Format("20060102T150405Z"))
+		}
+		line("SUMMARY:" + icalEscape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + icalEscape(e.Description))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.Flush()
+}
+
+// Escape commas, semicolons, backslashes and newlines in text
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// Fold a content line longer than 75 bytes onto continuation lines starting
+// with a space, without splitting UTF-8 characters
+func icalFold(s string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := utf8.RuneLen(r)
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
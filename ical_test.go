@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICalProperty(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		params map[string]string
+		value  string
+	}{
+		{"SUMMARY:Team call", "SUMMARY", map[string]string{}, "Team call"},
+		{"summary:lower case name", "SUMMARY", map[string]string{}, "lower case name"},
+		{"DTSTART;TZID=Europe/Berlin:20250101T090000", "DTSTART",
+			map[string]string{"TZID": "Europe/Berlin"}, "20250101T090000"},
+		{"DTSTART;VALUE=DATE:20250101", "DTSTART", map[string]string{"VALUE": "DATE"}, "20250101"},
+		{`ATTENDEE;CN="Smith; Bob: Sales";ROLE=REQ-PARTICIPANT:mailto:bob@example.com`, "ATTENDEE",
+			map[string]string{"CN": "Smith; Bob: Sales", "ROLE": "REQ-PARTICIPANT"}, "mailto:bob@example.com"},
+		{"DESCRIPTION:Agenda: one; two", "DESCRIPTION", map[string]string{}, "Agenda: one; two"},
+		{"BEGIN:VEVENT", "BEGIN", map[string]string{}, "VEVENT"},
+		{"NOVALUE", "NOVALUE", map[string]string{}, ""},
+	}
+	for _, tt := range tests {
+		name, params, value := icalProperty(tt.line)
+		if name != tt.name || value != tt.value || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("icalProperty(%q) = %q, %v, %q, want %q, %v, %q",
+				tt.line, name, params, value, tt.name, tt.params, tt.value)
+		}
+	}
+}
+
+func TestICalTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+	tests := []struct {
+		value  string
+		params map[string]string
+		want   time.Time
+		allDay bool
+		ok     bool
+	}{
+		{"20250101", map[string]string{}, time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local), true, true},
+		{"20250101", map[string]string{"VALUE": "DATE"}, time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local), true, true},
+		{"20250101T090000Z", map[string]string{}, time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC), false, true},
+		{"20250101T090000", map[string]string{"TZID": "Europe/Berlin"},
+			time.Date(2025, 1, 1, 9, 0, 0, 0, berlin), false, true},
+		{"20250701T090000", map[string]string{"TZID": "Europe/Berlin"}, // summer time
+			time.Date(2025, 7, 1, 7, 0, 0, 0, time.UTC), false, true},
+		{"20250101T090000", map[string]string{"TZID": "Nowhere/Unknown"},
+			time.Date(2025, 1, 1, 9, 0, 0, 0, time.Local), false, true},
+		{"20250101T090000", map[string]string{}, time.Date(2025, 1, 1, 9, 0, 0, 0, time.Local), false, true},
+		{"2025-01-01T09:00", map[string]string{}, time.Time{}, false, false},
+		{"20251301", map[string]string{}, time.Time{}, true, false},
+	}
+	for _, tt := range tests {
+		got, allDay, err := icalTime(tt.value, tt.params)
+		if (err == nil) != tt.ok {
+			t.Errorf("icalTime(%q, %v) error = %v, want ok %v", tt.value, tt.params, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if !got.Equal(tt.want) || allDay != tt.allDay {
+			t.Errorf("icalTime(%q, %v) = %v, %v, want %v, %v", tt.value, tt.params, got, allDay, tt.want, tt.allDay)
+		}
+	}
+}
+
+func TestICalFold(t *testing.T) {
+	tests := []string{
+		"SUMMARY:short",
+		"DESCRIPTION:" + strings.Repeat("x", 63),  // exactly 75 bytes
+		"DESCRIPTION:" + strings.Repeat("x", 64),  // one byte over
+		"DESCRIPTION:" + strings.Repeat("x", 300), // several lines
+		"SUMMARY:" + strings.Repeat("äöü€", 30),   // multi-byte characters
+	}
+	for _, s := range tests {
+		folded := icalFold(s)
+		for _, line := range strings.Split(folded, "\r\n") {
+			if len(line) > 75 {
+				t.Errorf("icalFold(%q): line of %d bytes", s, len(line))
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("icalFold(%q): line %q splits a character", s, line)
+			}
+		}
+		if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != s {
+			t.Errorf("icalFold(%q) unfolds to %q", s, unfolded)
+		}
+	}
+}
+
+func TestParseICal(t *testing.T) {
+	tests := []struct {
+		name string
+		ics  string
+		want []ICalEvent
+		ok   bool
+	}{
+		{"timed event with folded lines and attendees", "BEGIN:VCALENDAR\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"UID:abc@example.com\r\n" +
+			"SUMMARY:Planning\\, Q3\r\n" +
+			"DESCRIPTION:First line\\nsecond\r\n" +
+			"  line\r\n" +
+			"DTSTART:20250101T090000Z\r\n" +
+			"DTEND:20250101T103000Z\r\n" +
+			"ATTENDEE;CN=\"Smith; Bob\":MAILTO:Bob@Example.com\r\n" +
+			"ATTENDEE:mailto:amy@example.com\r\n" +
+			"END:VEVENT\r\n" +
+			"END:VCALENDAR\r\n",
+			[]ICalEvent{{
+				UID: "abc@example.com", Summary: "Planning, Q3", Description: "First line\nsecond line",
+				Start:     time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+				End:       time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC),
+				Attendees: []string{"bob@example.com", "amy@example.com"},
+			}}, true},
+		{"all-day event without end", "BEGIN:VCALENDAR\n" +
+			"BEGIN:VEVENT\n" +
+			"SUMMARY:New Year\n" +
+			"DTSTART;VALUE=DATE:20250101\n" +
+			"END:VEVENT\n" +
+			"END:VCALENDAR\n",
+			[]ICalEvent{{
+				Summary: "New Year", AllDay: true,
+				Start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local),
+				End:   time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local),
+			}}, true},
+		{"properties outside events ignored", "BEGIN:VCALENDAR\n" +
+			"X-WR-CALNAME:Holidays\n" +
+			"SUMMARY:not an event\n" +
+			"END:VCALENDAR\n",
+			[]ICalEvent{}, true},
+		{"event without start", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:Lost\nEND:VEVENT\nEND:VCALENDAR\n", nil, false},
+		{"invalid start", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:tomorrow\nEND:VEVENT\nEND:VCALENDAR\n", nil, false},
+		{"not a calendar", "Date,Project,Hours\n2025-01-01,website,2\n", nil, false},
+		{"empty", "", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseICal(strings.NewReader(tt.ics))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d events, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			g, w := got[i], tt.want[i]
+			if g.UID != w.UID || g.Summary != w.Summary || g.Description != w.Description || g.AllDay != w.AllDay ||
+				!g.Start.Equal(w.Start) || !g.End.Equal(w.End) || !reflect.DeepEqual(g.Attendees, w.Attendees) {
+				t.Errorf("%s: event %d = %+v, want %+v", tt.name, i, g, w)
+			}
+		}
+	}
+}
+
+func TestWriteICalRoundTrip(t *testing.T) {
+	events := []ICalEvent{
+		{UID: "work-1@timelog2", Summary: "ACME - website; fixes, " + strings.Repeat("long ", 30),
+			Description: "line one\nline two \\ done",
+			Start:       time.Date(2025, 3, 30, 9, 0, 0, 0, time.UTC),
+			End:         time.Date(2025, 3, 30, 10, 15, 0, 0, time.UTC)},
+		{UID: "work-2@timelog2", Summary: "2.00h ACME - website", AllDay: true,
+			Start: time.Date(2025, 3, 31, 0, 0, 0, 0, time.Local),
+			End:   time.Date(2025, 4, 1, 0, 0, 0, 0, time.Local)},
+	}
+	var b bytes.Buffer
+	if err := writeICal(&b, "Work: ACME", events); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseICal(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("%d events read back, want %d", len(got), len(events))
+	}
+	for i, e := range events {
+		g := got[i]
+		if g.UID != e.UID || g.Summary != e.Summary || g.Description != e.Description || g.AllDay != e.AllDay ||
+			!g.Start.Equal(e.Start) || !g.End.Equal(e.End) {
+			t.Errorf("event %d read back as %+v, want %+v", i, g, e)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Page handlers for invoices, which bill a client for unbilled billable
+// work over a date range, at the project rates in effect when the invoice
+// is created
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Subtotal of an invoice for one project
+type InvoiceSubtotal struct {
+	ProjectName string
+	Hours       float64
+	Amount      float64
+}
+
+// Page showing list of invoices, optionally for one client
+func showInvoices(c *gin.Context) {
+	client := c.Query("client")
+	c.HTML(http.StatusOK, "invoices.html", gin.H{
+		"invoices": getInvoices(client),
+		"clients":  getClientNames(),
+		"client":   client,
+		"current":  "invoices",
+	})
+}
+
+// Page to create a new invoice: choose client and dates, and preview the
+// unbilled work that would be included
+func newInvoice(c *gin.Context) {
+
+	// Default to the previous month
+	firstOfMonth := time.Now().AddDate(0, 0, 1-time.Now().Day())
+	start := c.DefaultQuery("start", firstOfMonth.AddDate(0, -1, 0).Format("2006-01-02"))
+	end := c.DefaultQuery("end", firstOfMonth.AddDate(0, 0, -1).Format("2006-01-02"))
+	client := c.Query("client")
+
+	// Include expenses by default, until the preview is refreshed without
+	includeExpenses := client == "" || c.Query("expenses") == "on"
+
+	// Preview of items if a client was chosen, in the client's currency
+	var items []InvoiceItem
+	var total float64
+	var currency, errMsg string
+	if client != "" {
+		currency = clientCurrency(client)
+		var err error
+		items, total, err = invoiceItems(client, start, end, currency, includeExpenses)
+		if err != nil {
+			errMsg = err.Error()
+		}
+	}
+
+	c.HTML(http.StatusOK, "new_invoice.html", gin.H{
+		"clients":  getClientNames(),
+		"client":   client,
+		"start":    start,
+		"end":      end,
+		"items":    items,
+		"total":    total,
+		"currency": currency,
+		"error":    errMsg,
+		"expenses": includeExpenses,
+		"current":  "invoices",
+	})
+}
+
+// Handle form submission to create an invoice
+func createInvoiceForm(c *gin.Context) {
+
+	// Check client and dates
+	client := c.PostForm("client")
+	start := c.PostForm("start")
+	end := c.PostForm("end")
+	cl, found := findClientByName(client)
+	_, err1 := time.Parse("2006-01-02", start)
+	_, err2 := time.Parse("2006-01-02", end)
+	if !found || err1 != nil || err2 != nil {
+		c.String(http.StatusBadRequest, "Invalid client or dates")
+		return
+	}
+
+	// Unbilled work for the invoice priced at current rates, and expenses,
+	// in the client's currency
+	currency := clientCurrency(client)
+	items, total, err := invoiceItems(client, start, end, currency, c.PostForm("expenses") == "on")
+	if err != nil {
+		c.String(http.StatusBadRequest, "Could not create invoice: "+err.Error())
+		return
+	}
+	if len(items) == 0 {
+		c.String(http.StatusBadRequest, "Nothing unbilled and billable for "+client+" from "+start+" to "+end)
+		return
+	}
+
+	// Create the invoice as a draft, and show it
+	inv := Invoice{
+		ClientId:    cl.Id,
+		Client:      cl.Name,
+		StartDate:   start,
+		EndDate:     end,
+		InvoiceDate: time.Now().Format("2006-01-02"),
+		Status:      "draft",
+		Total:       total,
+		Currency:    currency,
+		Notes:       c.PostForm("notes"),
+	}
+	id, err := createInvoice(inv, items)
+	if err != nil {
+		c.String(http.StatusConflict, "Could not create invoice: "+err.Error())
+		return
+	}
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/%d", id))
+}
+
+// Make the items for an invoice to a client for a period: unbilled
+// billable work (only approved work in team mode), and optionally unbilled
+// billable expenses, in the currency given. Returns the items and their
+// total amount, or an error if an exchange rate is missing.
+func invoiceItems(client, start, end, currency string, includeExpenses bool) ([]InvoiceItem, float64, error) {
+	cv := newConverter()
+	items, total, err := buildInvoiceItems(getUnbilledWork(client, start, end, teamMode()), currency, cv)
+	if err != nil || !includeExpenses {
+		return items, total, err
+	}
+	expenseItems, expenseTotal, err := buildExpenseItems(getUnbilledExpenses(client, start, end), currency, cv)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(items, expenseItems...), total + expenseTotal, nil
+}
+
+// Make invoice items for a list of work entries, using the effective rate
+// of each entry's project and member, converted to the invoice currency at
+// the rate on the date of the work. Returns the items and their total
+// amount, or an error if an exchange rate is missing.
+func buildInvoiceItems(entries []Work, currency string, cv *Converter) ([]InvoiceItem, float64, error) {
+
+	// Rates, and each project and its currency, looked up once
+	rates := getRates()
+	clientCurrencies := getClientCurrencies()
+	projects := map[int]Project{}
+	currencies := map[int]string{}
+
+	items := []InvoiceItem{}
+	total := 0.0
+	for _, w := range entries {
+		if _, ok := projects[w.ProjectId]; !ok {
+			p := getProject(w.ProjectId)
+			projects[w.ProjectId] = p
+			currencies[w.ProjectId] = projectCurrency(p, clientCurrencies, cv.Base)
+		}
+		rate, ok := cv.Convert(rates.For(projects[w.ProjectId], w.MemberId), currencies[w.ProjectId], currency, w.WorkDate)
+		if !ok {
+			return nil, 0, fmt.Errorf("no exchange rate to convert %s to %s", currencies[w.ProjectId], currency)
+		}
+		it := InvoiceItem{
+			WorkId:      w.Id,
+			ProjectId:   w.ProjectId,
+			ProjectName: w.ProjectName,
+			ItemDate:    w.WorkDate,
+			Description: w.Description,
+			Hours:       w.Hours,
+			Rate:        rate,
+			Amount:      w.Hours * rate,
+		}
+		items = append(items, it)
+		total += it.Amount
+	}
+	return items, total, nil
+}
+
+// Page showing one invoice
+func showInvoice(c *gin.Context) {
+
+	// Get invoice ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+
+	// Invoice must exist
+	inv, found := findInvoice(id)
+	if !found {
+		c.String(http.StatusNotFound, "Invoice not found")
+		return
+	}
+
+	// Items, with subtotals by project (items are sorted by project)
+	items := getInvoiceItems(id)
+	subtotals := []InvoiceSubtotal{}
+	var totalHours float64
+	for _, it := range items {
+		if len(subtotals) == 0 || subtotals[len(subtotals)-1].ProjectName != it.ProjectName {
+			subtotals = append(subtotals, InvoiceSubtotal{ProjectName: it.ProjectName})
+		}
+		subtotals[len(subtotals)-1].Hours += it.Hours
+		subtotals[len(subtotals)-1].Amount += it.Amount
+		totalHours += it.Hours
+	}
+
+	// Statuses it can move to, only forward and only by managers in team mode
+	me, _ := currentMember(c)
+	c.HTML(http.StatusOK, "invoice.html", gin.H{
+		"inv":        inv,
+		"items":      items,
+		"subtotals":  subtotals,
+		"totalHours": totalHours,
+		"statuses":   invoiceStatuses[max(invoiceStatusIndex(inv.Status), 0):],
+		"canManage":  !teamMode() || me.Manager,
+		"current":    "invoices",
+	})
+}
+
+// Handle change of invoice status
+func invoiceStatusForm(c *gin.Context) {
+
+	// Get invoice ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+
+	// Invoice must exist
+	inv, found := findInvoice(id)
+	if !found {
+		c.String(http.StatusNotFound, "Invoice not found")
+		return
+	}
+
+	// Only managers can change invoices in team mode
+	if _, ok := requireManager(c, "change invoice status"); !ok {
+		return
+	}
+
+	// Status must be a known one, and later than the current one
+	status := c.PostForm("status")
+	if invoiceStatusIndex(status) < 0 {
+		c.String(http.StatusBadRequest, "Invalid invoice status")
+		return
+	}
+	if status == inv.Status {
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/%d", id))
+		return
+	}
+	if invoiceStatusIndex(status) < invoiceStatusIndex(inv.Status) {
+		c.String(http.StatusBadRequest, "An invoice that is "+inv.Status+" cannot go back to "+status)
+		return
+	}
+
+	if !setInvoiceStatus(id, inv.Status, status) {
+		c.String(http.StatusConflict, "The invoice status was changed meanwhile, please reload the invoice")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/%d", id))
+}
+
+// Handle deletion of a draft invoice, which releases its work entries
+func deleteInvoiceHandler(c *gin.Context) {
+
+	// Get invoice ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+
+	// Only managers can delete invoices in team mode, as that unbills work
+	if _, ok := requireManager(c, "delete invoices"); !ok {
+		return
+	}
+
+	// Only drafts can be deleted
+	inv, found := findInvoice(id)
+	if !found {
+		c.String(http.StatusNotFound, "Invoice not found")
+		return
+	}
+	if inv.Status != "draft" {
+		c.String(http.StatusBadRequest, "Only draft invoices can be deleted")
+		return
+	}
+
+	deleteInvoice(id)
+	c.Redirect(http.StatusSeeOther, "/invoices")
+}
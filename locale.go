@@ -0,0 +1,148 @@
+// Settings for the first day of the week, used for the calendar, the log's
+// week totals, time sheets and other weekly reports, and for the language
+// of month and day names.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Month and day names in one language, and how dates are written in it
+type Locale struct {
+	Name        string // name of the language, in the language
+	Months      [12]string
+	ShortMonths [12]string
+	Days        [7]string // Sunday first, as numbered by time.Weekday
+	ShortDays   [7]string
+	// Formats with {weekday}, {day}, {month} and {year} replaced
+	DateFormat     string // e.g. "January 2, 2006"
+	LongDateFormat string // e.g. "Monday, January 2, 2006"
+}
+
+// Languages of month and day names, by code
+var locales = map[string]Locale{
+	"en": {
+		Name: "English",
+		Months: [12]string{"January", "February", "March", "April", "May", "June",
+			"July", "August", "September", "October", "November", "December"},
+		ShortMonths:    [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		Days:           [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		ShortDays:      [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		DateFormat:     "{month} {day}, {year}",
+		LongDateFormat: "{weekday}, {month} {day}, {year}",
+	},
+	"de": {
+		Name: "Deutsch",
+		Months: [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni",
+			"Juli", "August", "September", "Oktober", "November", "Dezember"},
+		ShortMonths:    [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		Days:           [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		ShortDays:      [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		DateFormat:     "{day}. {month} {year}",
+		LongDateFormat: "{weekday}, {day}. {month} {year}",
+	},
+	"fr": {
+		Name: "Français",
+		Months: [12]string{"janvier", "février", "mars", "avril", "mai", "juin",
+			"juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		ShortMonths:    [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		Days:           [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		ShortDays:      [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		DateFormat:     "{day} {month} {year}",
+		LongDateFormat: "{weekday} {day} {month} {year}",
+	},
+	"es": {
+		Name: "Español",
+		Months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio",
+			"julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		ShortMonths:    [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		Days:           [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		ShortDays:      [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		DateFormat:     "{day} de {month} de {year}",
+		LongDateFormat: "{weekday}, {day} de {month} de {year}",
+	},
+	"nl": {
+		Name: "Nederlands",
+		Months: [12]string{"januari", "februari", "maart", "april", "mei", "juni",
+			"juli", "augustus", "september", "oktober", "november", "december"},
+		ShortMonths:    [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		Days:           [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		ShortDays:      [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		DateFormat:     "{day} {month} {year}",
+		LongDateFormat: "{weekday} {day} {month} {year}",
+	},
+}
+
+// Codes of the languages, in the order offered in the settings
+var localeCodes = []string{"en", "de", "fr", "es", "nl"}
+
+// Get the language chosen in the settings for month and day names
+func currentLocale() Locale {
+	if l, ok := locales[getSetting("locale", "")]; ok {
+		return l
+	}
+	return locales["en"]
+}
+
+// Fill in a date format with the names for a date
+func (l Locale) format(f string, d time.Time) string {
+	return strings.NewReplacer(
+		"{weekday}", l.Days[d.Weekday()],
+		"{day}", strconv.Itoa(d.Day()),
+		"{month}", l.Months[d.Month()-1],
+		"{year}", strconv.Itoa(d.Year()),
+	).Replace(f)
+}
+
+// Date with the month name, e.g. "January 2, 2006"
+func (l Locale) Date(d time.Time) string {
+	return l.format(l.DateFormat, d)
+}
+
+// Date with the day and month names, e.g. "Monday, January 2, 2006"
+func (l Locale) LongDate(d time.Time) string {
+	return l.format(l.LongDateFormat, d)
+}
+
+// Month and year, e.g. "January 2006"
+func (l Locale) MonthYear(d time.Time) string {
+	return l.Months[d.Month()-1] + " " + strconv.Itoa(d.Year())
+}
+
+// Short day name and day of the month, e.g. "Mon 2"
+func (l Locale) DayLabel(d time.Time) string {
+	return l.ShortDays[d.Weekday()] + " " + strconv.Itoa(d.Day())
+}
+
+// Short day names for a week starting on the given day
+func (l Locale) WeekDays(first time.Weekday) []string {
+	names := []string{}
+	for i := 0; i < 7; i++ {
+		names = append(names, l.ShortDays[(int(first)+i)%7])
+	}
+	return names
+}
+
+// Get the first day of the week from the settings, default Monday
+func firstDayOfWeek() time.Weekday {
+	n, err := strconv.Atoi(getSetting("first_day_of_week", ""))
+	if err != nil || n < 0 || n > 6 {
+		return time.Monday
+	}
+	return time.Weekday(n)
+}
+
+// Get the start of the week containing a date, for weeks starting on the
+// given day
+func weekStartOn(d time.Time, first time.Weekday) time.Time {
+	return d.AddDate(0, 0, -((int(d.Weekday()) - int(first) + 7) % 7))
+}
+
+// Get the start of the week containing a date, on the first day of the
+// week from the settings
+func weekStart(d time.Time) time.Time {
+	return weekStartOn(d, firstDayOfWeek())
+}
@@ -0,0 +1,132 @@
+// Period locks: once a month is invoiced or closed, the period can be
+// locked (for all clients or just one), so that work entries in it can't be
+// changed or deleted until it is reopened. Every lock and unlock is
+// recorded in a history, with the team member who did it. In team mode only
+// managers can lock and reopen periods.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Describe a locked period, for error messages
+func lockDescription(l PeriodLock) string {
+	s := l.StartDate + " to " + l.EndDate
+	if l.Client != "" {
+		s += " for " + l.Client
+	}
+	return s
+}
+
+// Check whether an existing work entry is in a locked period, returning an
+// error message if so, or a blank string if it can be changed
+func workLockedMessage(w Work) string {
+	if l, locked := findPeriodLock(dateOnly(w.WorkDate), w.Client); locked {
+		return "This entry is in a locked period (" + lockDescription(l) + "), reopen the period first to change it"
+	}
+	return ""
+}
+
+// Page showing locked periods, a form to lock another, and the history
+func showPeriodLocks(c *gin.Context) {
+
+	// Default to locking the previous month for all clients
+	firstOfMonth := time.Now().AddDate(0, 0, 1-time.Now().Day())
+	l := PeriodLock{
+		StartDate: firstOfMonth.AddDate(0, -1, 0).Format("2006-01-02"),
+		EndDate:   firstOfMonth.AddDate(0, 0, -1).Format("2006-01-02"),
+	}
+	showPeriodLocksPage(c, l, ValidationErrors{})
+}
+
+// Show the period locks page, with the lock form filled in and any errors
+func showPeriodLocksPage(c *gin.Context, l PeriodLock, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	me, _ := currentMember(c)
+	c.HTML(status, "period_locks.html", gin.H{
+		"locks":   getPeriodLocks(),
+		"events":  getPeriodLockEvents(),
+		"clients": getClients(),
+		"l":       l,
+		"errors":  errs,
+		"canLock": !teamMode() || me.Manager,
+		"current": "settings",
+	})
+}
+
+// Handle form submission to lock a period
+func lockPeriodForm(c *gin.Context) {
+
+	// Only managers can lock periods in team mode
+	me, ok := requireManager(c, "lock periods")
+	if !ok {
+		return
+	}
+
+	clientId, _ := strconv.Atoi(c.PostForm("client_id"))
+	l := PeriodLock{
+		StartDate: c.PostForm("start_date"),
+		EndDate:   c.PostForm("end_date"),
+		ClientId:  clientId,
+		Note:      strings.TrimSpace(c.PostForm("note")),
+	}
+
+	// Dates must be valid and in order
+	errs := ValidationErrors{}
+	start, err1 := time.Parse("2006-01-02", l.StartDate)
+	end, err2 := time.Parse("2006-01-02", l.EndDate)
+	if err1 != nil {
+		errs["start_date"] = "Please enter a valid date (YYYY-MM-DD)"
+	}
+	if err2 != nil {
+		errs["end_date"] = "Please enter a valid date (YYYY-MM-DD)"
+	} else if err1 == nil && end.Before(start) {
+		errs["end_date"] = "End date cannot be before start date"
+	}
+
+	// Client, if any, must be a known one
+	if l.ClientId != 0 {
+		cl, found := findClient(l.ClientId)
+		if !found {
+			errs["client_id"] = "Unknown client"
+		}
+		l.Client = cl.Name
+	}
+
+	if len(errs) > 0 {
+		showPeriodLocksPage(c, l, errs)
+		return
+	}
+
+	lockPeriod(l, me.Name)
+	c.Redirect(http.StatusSeeOther, "/period_locks")
+}
+
+// Handle form submission to reopen a locked period, with the reason
+func unlockPeriodForm(c *gin.Context) {
+
+	// Get lock ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid lock ID")
+		return
+	}
+
+	// Only managers can reopen periods in team mode
+	me, ok := requireManager(c, "reopen periods")
+	if !ok {
+		return
+	}
+
+	unlockPeriod(id, strings.TrimSpace(c.PostForm("note")), me.Name)
+	c.Redirect(http.StatusSeeOther, "/period_locks")
+}
@@ -5,19 +5,14 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CalendarDay represents one day and its work entries
-type CalendarDay struct {
-	Date    string
-	Day     int
-	Entries []Work
-}
-
 // LogEntryWithSubtotals contains a work entry and subtotal information
 type LogEntryWithSubtotals struct {
 	Work           Work
@@ -32,18 +27,172 @@ type LogEntryWithSubtotals struct {
 	MonthLabel     string
 }
 
-// Page showing activity on projects
+// Number of entries on each page of the activity log
+const logPageSize = 100
+
+// Read the activity log filter from the query string
+func parseLogFilter(c *gin.Context) LogFilter {
+	projectId, _ := strconv.Atoi(c.Query("project"))
+	clientId, _ := strconv.Atoi(c.Query("client"))
+	return LogFilter{
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+		ProjectId: projectId,
+		ClientId:  clientId,
+		Category:  c.Query("category"),
+		Billable:  c.Query("billable"),
+		Search:    strings.TrimSpace(c.Query("q")),
+		Tag:       strings.ToLower(strings.TrimLeft(c.Query("tag"), "#")),
+	}
+}
+
+// Query string for a log filter, without the blank fields, for links to the
+// same filtered log
+func (f LogFilter) Query() string {
+	v := url.Values{}
+	set := func(name, value string) {
+		if value != "" && value != "0" {
+			v.Set(name, value)
+		}
+	}
+	set("from", f.From)
+	set("to", f.To)
+	set("project", strconv.Itoa(f.ProjectId))
+	set("client", strconv.Itoa(f.ClientId))
+	set("category", f.Category)
+	set("billable", f.Billable)
+	set("q", f.Search)
+	set("tag", f.Tag)
+	return v.Encode()
+}
+
+// Check whether a log filter has any fields set
+func (f LogFilter) IsSet() bool {
+	return f.Query() != ""
+}
+
+// Log cursor as used in the query string, e.g. "2025-03-14_42"
+func (lc LogCursor) String() string {
+	return fmt.Sprintf("%s_%d", lc.Date, lc.Id)
+}
+
+// Parse a log cursor from the query string, false if it isn't valid
+func parseLogCursor(s string) (LogCursor, bool) {
+	date, idStr, found := strings.Cut(s, "_")
+	if !found {
+		return LogCursor{}, false
+	}
+	id, err := strconv.Atoi(idStr)
+	if _, dateErr := time.Parse("2006-01-02", date); err != nil || dateErr != nil || id <= 0 {
+		return LogCursor{}, false
+	}
+	return LogCursor{Date: date, Id: id}, true
+}
+
+// Labels of the day, week and month a log entry is in, the week by the
+// date it starts on, for weeks starting on the given day
+func logLabels(date time.Time, first time.Weekday) (string, string, string) {
+	return date.Format("2006-01-02"), weekStartOn(date, first).Format("2006-01-02"), date.Format("2006-01")
+}
+
+// Page showing activity on projects, newest first, one page at a time, with
+// filters from the query string. The page is given by a cursor, the entry
+// that the page is older or newer than.
 func showLog(c *gin.Context) {
 
-	// Get all work entries
-	entries := getWorkEntries()
+	// Get filter, checking dates
+	f := parseLogFilter(c)
+	for _, date := range []string{f.From, f.To} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			c.String(http.StatusBadRequest, "Invalid date "+date)
+			return
+		}
+	}
 
-	// Process entries and calculate subtotals
-	logEntries := []LogEntryWithSubtotals{}
-	var lastDate, lastWeek, lastMonth string
-	var dayTotal, weekTotal, monthTotal float64
+	// Get cursor, if not on the first page
+	var cursor LogCursor
+	newer := false
+	if s := c.Query("newer_than"); s != "" {
+		var ok bool
+		cursor, ok = parseLogCursor(s)
+		if !ok {
+			c.String(http.StatusBadRequest, "Invalid page")
+			return
+		}
+		newer = true
+	} else if s := c.Query("older_than"); s != "" {
+		var ok bool
+		cursor, ok = parseLogCursor(s)
+		if !ok {
+			c.String(http.StatusBadRequest, "Invalid page")
+			return
+		}
+	}
 
+	// Get the page, reading one more entry to see if there are more pages.
+	// Note the date of the entry just after the page (older) if there is
+	// one, as totals go after the last entry of a day, week or month.
+	entries := getWorkEntriesPage(f, cursor, newer, logPageSize+1)
+	hasNewer, hasOlder := false, false
+	nextDate := ""
+	if newer {
+		hasOlder = true
+		nextDate = cursor.Date
+		if len(entries) > logPageSize {
+			entries = entries[1:]
+			hasNewer = true
+		}
+	} else {
+		hasNewer = cursor.Id != 0
+		if len(entries) > logPageSize {
+			nextDate = entries[logPageSize].WorkDate
+			entries = entries[:logPageSize]
+			hasOlder = true
+		}
+	}
+
+	// Tags of entries on the page
+	ids := []int{}
+	for _, w := range entries {
+		ids = append(ids, w.Id)
+	}
+	tags := getWorkTagsFor(ids)
+
+	// Totals for each day, week and month on the page, including entries on
+	// other pages, from the start of the oldest week or month to the end of
+	// the newest
+	dayTotals, weekTotals, monthTotals := map[string]float64{}, map[string]float64{}, map[string]float64{}
+	first := firstDayOfWeek()
+	if len(entries) > 0 {
+		oldest, err1 := time.Parse("2006-01-02", entries[len(entries)-1].WorkDate)
+		newest, err2 := time.Parse("2006-01-02", entries[0].WorkDate)
+		if err1 == nil && err2 == nil {
+			start := weekStartOn(oldest, first)
+			if monthStart := oldest.AddDate(0, 0, 1-oldest.Day()); monthStart.Before(start) {
+				start = monthStart
+			}
+			end := weekStartOn(newest, first).AddDate(0, 0, 6)
+			if monthEnd := newest.AddDate(0, 1, -newest.Day()); monthEnd.After(end) {
+				end = monthEnd
+			}
+			for date, hours := range getWorkHoursByDay(f, start.Format("2006-01-02"), end.Format("2006-01-02")) {
+				d, err := time.Parse("2006-01-02", date)
+				if err != nil {
+					continue
+				}
+				day, week, month := logLabels(d, first)
+				dayTotals[day] += hours
+				weekTotals[week] += hours
+				monthTotals[month] += hours
+			}
+		}
+	}
+
+	// Show totals after the last entry of each day, week and month, unless
+	// it continues on the next page
+	logEntries := []LogEntryWithSubtotals{}
 	for i, w := range entries {
+		w.Tags = tags[w.Id]
 		entry := LogEntryWithSubtotals{Work: w}
 
 		// Parse date (assuming format YYYY-MM-DD)
@@ -53,75 +202,67 @@ func showLog(c *gin.Context) {
 			fmt.Printf("showLog: invalid date \"%s\"\n", w.WorkDate)
 			continue
 		}
+		dayLabel, weekLabel, monthLabel := logLabels(date, first)
 
-		// Calculate day, week, and month labels
-		dayLabel := date.Format("2006-01-02")
-		year, week := date.ISOWeek()
-		weekLabel := fmt.Sprintf("%d-W%02d", year, week)
-		monthLabel := date.Format("2006-01")
-
-		// Check if we're starting a new day
-		if dayLabel != lastDate && lastDate != "" {
-			// Show day total on last entry of previous day
-			if len(logEntries) > 0 {
-				logEntries[len(logEntries)-1].ShowDayTotal = true
-				logEntries[len(logEntries)-1].DayTotal = dayTotal
-				logEntries[len(logEntries)-1].DayLabel = lastDate
-			}
-			dayTotal = 0
+		// Labels of the next entry, blank if none
+		var nextDay, nextWeek, nextMonth string
+		next := nextDate
+		if i+1 < len(entries) {
+			next = entries[i+1].WorkDate
 		}
-		dayTotal += w.Hours
-
-		// Check if we're starting a new week
-		if weekLabel != lastWeek && lastWeek != "" {
-			// Show week total on last entry of previous week
-			if len(logEntries) > 0 {
-				logEntries[len(logEntries)-1].ShowWeekTotal = true
-				logEntries[len(logEntries)-1].WeekTotal = weekTotal
-				logEntries[len(logEntries)-1].WeekLabel = lastWeek
-			}
-			weekTotal = 0
+		if d, err := time.Parse("2006-01-02", next); err == nil {
+			nextDay, nextWeek, nextMonth = logLabels(d, first)
 		}
-		weekTotal += w.Hours
-
-		// Check if we're starting a new month
-		if monthLabel != lastMonth && lastMonth != "" {
-			// Show month total on last entry of previous month
-			if len(logEntries) > 0 {
-				logEntries[len(logEntries)-1].ShowMonthTotal = true
-				logEntries[len(logEntries)-1].MonthTotal = monthTotal
-				logEntries[len(logEntries)-1].MonthLabel = lastMonth
-			}
-			monthTotal = 0
-		}
-		monthTotal += w.Hours
-
-		lastDate = dayLabel
-		lastWeek = weekLabel
-		lastMonth = monthLabel
 
+		if dayLabel != nextDay {
+			entry.ShowDayTotal = true
+			entry.DayTotal = dayTotals[dayLabel]
+			entry.DayLabel = dayLabel
+		}
+		if weekLabel != nextWeek {
+			entry.ShowWeekTotal = true
+			entry.WeekTotal = weekTotals[weekLabel]
+			entry.WeekLabel = weekLabel
+		}
+		if monthLabel != nextMonth {
+			entry.ShowMonthTotal = true
+			entry.MonthTotal = monthTotals[monthLabel]
+			entry.MonthLabel = monthLabel
+		}
 		logEntries = append(logEntries, entry)
+	}
 
-		// If this is the last entry, show all totals
-		if i == len(entries)-1 {
-			logEntries[len(logEntries)-1].ShowDayTotal = true
-			logEntries[len(logEntries)-1].DayTotal = dayTotal
-			logEntries[len(logEntries)-1].DayLabel = dayLabel
-
-			logEntries[len(logEntries)-1].ShowWeekTotal = true
-			logEntries[len(logEntries)-1].WeekTotal = weekTotal
-			logEntries[len(logEntries)-1].WeekLabel = weekLabel
-
-			logEntries[len(logEntries)-1].ShowMonthTotal = true
-			logEntries[len(logEntries)-1].MonthTotal = monthTotal
-			logEntries[len(logEntries)-1].MonthLabel = monthLabel
-		}
+	// Links to newer and older pages, keeping the filter
+	query := f.Query()
+	if query != "" {
+		query += "&"
 	}
+	newerLink, olderLink := "", ""
+	if hasNewer && len(entries) > 0 {
+		newerLink = "/log?" + query + "newer_than=" + LogCursor{entries[0].WorkDate, entries[0].Id}.String()
+	}
+	if hasOlder && len(entries) > 0 {
+		last := entries[len(entries)-1]
+		olderLink = "/log?" + query + "older_than=" + LogCursor{last.WorkDate, last.Id}.String()
+	}
+	count, totalHours := getWorkTotal(f)
 
 	// Show the page
 	c.HTML(http.StatusOK,
 		"log.html",
-		gin.H{"entries": logEntries, "current": "log"})
+		gin.H{
+			"entries":    logEntries,
+			"filter":     f,
+			"count":      count,
+			"totalHours": totalHours,
+			"newerLink":  newerLink,
+			"olderLink":  olderLink,
+			"projects":   getProjects(),
+			"clients":    getClients(),
+			"categories": projectCategories,
+			"tags":       getTags(),
+			"current":    "log",
+		})
 }
 
 // Page showing one work entry detail
@@ -135,10 +276,16 @@ func showWorkEntry(c *gin.Context) {
 		return
 	}
 
+	w, found := findWork(id)
+	if !found {
+		c.String(http.StatusNotFound, "Work entry not found")
+		return
+	}
+
 	// Show the page
 	c.HTML(http.StatusOK,
 		"work_entry.html",
-		gin.H{"work": getWorkEntry(id), "current": "log"})
+		gin.H{"work": w, "current": "log"})
 }
 
 // Page to create/edit a work entry
@@ -162,60 +309,109 @@ func editWork(c *gin.Context) {
 			Hours:     1.0,
 			ProjectId: 0,
 		}
-	} else {
-		w = getWorkEntry(id)
-	}
 
-	// Get active projects for dropdown
-	activeProjects := []Project{}
-	for _, p := range getProjects() {
-		if p.Active {
-			activeProjects = append(activeProjects, p)
+		// Fill in from a template if one was chosen
+		if tid, err := strconv.Atoi(c.Query("template")); err == nil && tid > 0 {
+			t := getWorkTemplate(tid)
+			w.ProjectId = t.ProjectId
+			w.Hours = t.Hours
+			w.Billable = t.Billable
+			w.Description = t.Description
+		}
+	} else {
+		var found bool
+		w, found = findWork(id)
+		if !found {
+			c.String(http.StatusNotFound, "Work entry not found")
+			return
 		}
 	}
 
-	c.HTML(http.StatusOK, "edit_work.html", gin.H{
-		"work":     w,
-		"projects": activeProjects,
-		"current":  "log",
-	})
+	// Show form, with active projects and tasks for dropdowns, and templates
+	// for new entries
+	showWorkForm(c, w, ValidationErrors{}, "")
 }
 
 // Handle save of a work entry
 func saveWorkForm(c *gin.Context) {
 
-	// Parse fields
+	// Parse fields, collecting errors for any that can't be parsed
+	errs := ValidationErrors{}
 	id, _ := strconv.Atoi(c.PostForm("id"))
 	projectId, err := strconv.Atoi(c.PostForm("project_id"))
 	if err != nil {
-		c.String(http.StatusBadRequest, "Invalid project")
-		return
+		errs["project_id"] = "Please select a project"
 	}
-	workDate := c.PostForm("work_date")
-	hoursStr := c.PostForm("hours")
-	hours, err := strconv.ParseFloat(hoursStr, 64)
+	taskId, _ := strconv.Atoi(c.PostForm("task_id"))
+	hours, err := strconv.ParseFloat(c.PostForm("hours"), 64)
 	if err != nil {
-		c.String(http.StatusBadRequest, "Invalid hours")
-		return
+		errs["hours"] = "Please enter hours as a number, e.g. 1.5"
 	}
-	billable := c.PostForm("billable") == "on" || c.PostForm("billable") == "true"
-	description := c.PostForm("description")
 
 	w := Work{
 		Id:          id,
 		ProjectId:   projectId,
-		WorkDate:    workDate,
+		TaskId:      taskId,
+		WorkDate:    c.PostForm("work_date"),
+		StartTime:   strings.TrimSpace(c.PostForm("start_time")),
+		EndTime:     strings.TrimSpace(c.PostForm("end_time")),
 		Hours:       hours,
-		Billable:    billable,
-		Description: description,
+		Billable:    c.PostForm("billable") == "on" || c.PostForm("billable") == "true",
+		Description: c.PostForm("description"),
+		Tags:        parseTags(c.PostForm("tags")),
+	}
+
+	// Existing entries must still be there and keep their team member, new
+	// ones belong to the current team member, if any
+	old, found := findWork(id)
+	if id > 0 && !found {
+		c.String(http.StatusNotFound, "Work entry not found")
+		return
+	}
+	if id > 0 {
+		w.MemberId = old.MemberId
+	} else {
+		if me, found := currentMember(c); found {
+			w.MemberId = me.Id
+		}
+	}
+
+	// Validate the rest, and show the form again if there are any errors
+	for field, msg := range validateWork(w) {
+		if errs[field] == "" {
+			errs[field] = msg
+		}
+	}
+	if len(errs) > 0 {
+		showWorkForm(c, w, errs, "")
+		return
 	}
 
 	savedId := saveWork(w)
+	saveWorkTags(savedId, w.Tags)
 
 	// Redirect to work entry detail
 	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/work_entry/%d", savedId))
 }
 
+// Show the work entry form, with error messages if any
+func showWorkForm(c *gin.Context, w Work, errs ValidationErrors, errMsg string) {
+	status := http.StatusOK
+	if len(errs) > 0 || errMsg != "" {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "edit_work.html", gin.H{
+		"work":      w,
+		"projects":  getActiveProjects(),
+		"tasks":     getActiveTasks(w.TaskId),
+		"tags":      getTags(),
+		"templates": getWorkTemplates(),
+		"errors":    errs,
+		"error":     errMsg,
+		"current":   "log",
+	})
+}
+
 // Handle deletion of a work entry
 func deleteWorkHandler(c *gin.Context) {
 	// Get work entry ID from URL
@@ -225,112 +421,29 @@ func deleteWorkHandler(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Invalid work entry ID")
 		return
 	}
-	// Delete and redirect to log
-	deleteWork(id)
-	c.Redirect(http.StatusSeeOther, "/log")
-}
-
-// Page: monthly calendar of work entries
-func showCalendar(c *gin.Context) {
-	// Parse year and month from query; default to current
-	now := time.Now()
-	year, _ := strconv.Atoi(c.DefaultQuery("year", fmt.Sprintf("%04d", now.Year())))
-	monthInt, _ := strconv.Atoi(c.DefaultQuery("month", fmt.Sprintf("%02d", int(now.Month()))))
-	if monthInt < 1 || monthInt > 12 {
-		monthInt = int(now.Month())
-	}
-	month := time.Month(monthInt)
-
-	firstOfMonth := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
-	// Compute last day
-	firstNextMonth := firstOfMonth.AddDate(0, 1, 0)
-	lastOfMonth := firstNextMonth.AddDate(0, 0, -1)
-	daysInMonth := lastOfMonth.Day()
-
-	// Range strings
-	startDate := firstOfMonth.Format("2006-01-02")
-	endDate := lastOfMonth.Format("2006-01-02")
-
-	// Fetch entries in range
-	entries := getWorkEntriesBetween(startDate, endDate)
-
-	// Bucket entries by date
-	dayMap := map[string][]Work{}
-	for _, w := range entries {
-		dayMap[w.WorkDate] = append(dayMap[w.WorkDate], w)
-	}
-
-	// Prepare days slice
-	days := make([]CalendarDay, 0, daysInMonth)
-	for d := 1; d <= daysInMonth; d++ {
-		cur := time.Date(year, month, d, 0, 0, 0, 0, time.Local)
-		ds := cur.Format("2006-01-02")
-		days = append(days, CalendarDay{
-			Date:    ds,
-			Day:     d,
-			Entries: dayMap[ds],
-		})
+	w, found := findWork(id)
+	if !found {
+		c.String(http.StatusNotFound, "Work entry not found")
+		return
 	}
 
-	// Weekday of first (0=Sunday .. 6=Saturday)
-	startWeekday := int(firstOfMonth.Weekday())
-
-	// Next/prev month routing
-	prev := firstOfMonth.AddDate(0, -1, 0)
-	next := firstOfMonth.AddDate(0, 1, 0)
-
-	// Build 6x7 grid of weeks with optional days
-	weeks := make([][]*CalendarDay, 0, 6)
-	curWeek := make([]*CalendarDay, 7)
-	// Fill leading blanks
-	for i := 0; i < startWeekday; i++ {
-		curWeek[i] = nil
-	}
-	col := startWeekday
-	for i := 0; i < len(days); i++ {
-		d := days[i]
-		curWeek[col] = &d
-		col++
-		if col == 7 {
-			weeks = append(weeks, curWeek)
-			curWeek = make([]*CalendarDay, 7)
-			col = 0
-		}
-	}
-	if col != 0 {
-		weeks = append(weeks, curWeek)
+	// Can't delete an entry that has already been billed
+	if inv := w.InvoiceId; inv > 0 {
+		c.String(http.StatusBadRequest, fmt.Sprintf("Work entry is on invoice %d, cannot delete it", getInvoice(inv).Number))
+		return
 	}
 
-	// Build project color map (stable palette)
-	palette := []string{
-		"is-primary", "is-link", "is-info", "is-success", "is-warning", "is-danger",
-		"is-dark", "is-black", "is-primary is-light", "is-link is-light", "is-info is-light",
-		"is-success is-light", "is-warning is-light", "is-danger is-light",
+	// Or one that has been submitted or approved, or is in a locked period
+	if msg := workStatusMessage(w); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
 	}
-	colors := map[int]string{}
-	for _, w := range entries {
-		if _, ok := colors[w.ProjectId]; !ok {
-			idx := w.ProjectId % len(palette)
-			if idx < 0 {
-				idx = -idx
-			}
-			colors[w.ProjectId] = palette[idx]
-		}
+	if msg := workLockedMessage(w); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
 	}
 
-	c.HTML(http.StatusOK, "calendar.html", gin.H{
-		"year":         year,
-		"month":        int(month),
-		"monthName":    firstOfMonth.Format("January 2006"),
-		"daysInMonth":  daysInMonth,
-		"startWeekday": startWeekday,
-		"days":         days,
-		"weeks":        weeks,
-		"prevYear":     prev.Year(),
-		"prevMonth":    int(prev.Month()),
-		"nextYear":     next.Year(),
-		"nextMonth":    int(next.Month()),
-		"colors":       colors,
-		"current":      "calendar",
-	})
+	// Delete and redirect to log
+	deleteWork(id)
+	c.Redirect(http.StatusSeeOther, "/log")
 }
@@ -36,6 +36,12 @@ func main() {
 		return
 	}
 
+	// Set up the full-text search index
+	initSearch()
+	if !ftsAvailable {
+		fmt.Println("SQLite has no FTS5, searching without an index (build with -tags sqlite_fts5 to use one)")
+	}
+
 	// Create router, initialize templates and location of static files
 	r := gin.Default()
 	r.LoadHTMLGlob("templates/*")
@@ -55,6 +61,21 @@ func main() {
 	r.GET("/edit_project/:id", editProject)
 	r.POST("/save_project", saveProjectForm)
 	r.GET("/delete_project/:id", deleteProjectHandler)
+	r.POST("/update_complete/:id", updateProjectComplete)
+
+	// Tasks within projects
+	r.GET("/edit_task/:id", editTask)
+	r.POST("/save_task", saveTaskForm)
+	r.GET("/delete_task/:id", deleteTaskHandler)
+
+	// Expenses on projects
+	r.GET("/edit_expense/:id", editExpense)
+	r.POST("/save_expense", saveExpenseForm)
+	r.GET("/delete_expense/:id", deleteExpenseHandler)
+	r.GET("/receipt/:id", showReceipt)
+
+	// Search
+	r.GET("/search", showSearch)
 
 	// Work history
 	r.GET("/log", showLog)
@@ -62,6 +83,24 @@ func main() {
 	r.POST("/save_work", saveWorkForm)
 	r.GET("/work_entry/:id", showWorkEntry)
 	r.GET("/delete_work/:id", deleteWorkHandler)
+	r.POST("/quick_add", quickAdd)
+
+	// Work entry templates
+	r.GET("/entry_templates", showWorkTemplates)
+	r.GET("/edit_template/:id", editWorkTemplate)
+	r.POST("/save_template", saveWorkTemplateForm)
+	r.GET("/delete_template/:id", deleteWorkTemplateHandler)
+
+	// Clients
+	r.GET("/clients", showClients)
+	r.GET("/client/:id", showClient)
+	r.GET("/edit_client/:id", editClient)
+	r.POST("/save_client", saveClientForm)
+	r.GET("/delete_client/:id", deleteClientHandler)
+	r.POST("/add_client_contact/:id", addClientContactLink)
+	r.GET("/del_client_contact", deleteClientContactLink)
+	r.GET("/migrate_clients", showClientMigration)
+	r.POST("/migrate_clients", migrateClientsForm)
 
 	// Contacts
 	r.GET("/contacts", showContacts)
@@ -74,9 +113,67 @@ func main() {
 	r.POST("/add_contact_project/:contact_id", addContactProjectLink)
 	r.GET("/del_contact_project", deleteContactProjectLink)
 
+	// Invoices
+	r.GET("/invoices", showInvoices)
+	r.GET("/new_invoice", newInvoice)
+	r.POST("/create_invoice", createInvoiceForm)
+	r.GET("/invoice/:id", showInvoice)
+	r.POST("/invoice_status/:id", invoiceStatusForm)
+	r.GET("/delete_invoice/:id", deleteInvoiceHandler)
+	r.GET("/invoice_pdf/:id", invoicePDF)
+	r.GET("/timesheet_pdf", timesheetPDF)
+	r.GET("/project_pdf/:id", projectPDF)
+
 	// Other pages
+	r.GET("/dashboard", showDashboard)
 	r.GET("/reports", showReports)
+	r.GET("/reports/billable", showBillableMismatches)
+	r.POST("/reconcile_billable", reconcileBillableForm)
+	r.GET("/reports/revenue", showRevenueReport)
+	r.GET("/reports/portfolio", showPortfolio)
+	r.GET("/reports/tags", showTagReport)
+	r.GET("/reports/heatmap", showHeatmap)
 	r.GET("/calendar", showCalendar)
+	r.GET("/absences", showAbsences)
+	r.GET("/edit_absence/:id", editAbsence)
+	r.POST("/save_absence", saveAbsenceForm)
+	r.GET("/delete_absence/:id", deleteAbsenceHandler)
+	r.GET("/holidays", showHolidayCalendars)
+	r.GET("/holiday_calendar/:id", showHolidayCalendar)
+	r.POST("/save_holiday_calendar", saveHolidayCalendarForm)
+	r.GET("/delete_holiday_calendar/:id", deleteHolidayCalendarHandler)
+	r.POST("/save_holiday", saveHolidayForm)
+	r.GET("/delete_holiday/:id", deleteHolidayHandler)
+	r.POST("/import_holidays", importHolidaysForm)
+	r.GET("/settings", showSettings)
+	r.POST("/save_settings", saveSettingsForm)
+	r.GET("/period_locks", showPeriodLocks)
+	r.POST("/lock_period", lockPeriodForm)
+	r.POST("/unlock_period/:id", unlockPeriodForm)
+	r.GET("/import_csv", showCSVImport)
+	r.POST("/import_csv", importCSVForm)
+	r.GET("/meetings", showMeetings)
+	r.POST("/import_meetings", importMeetingsForm)
+	r.POST("/save_meetings", saveMeetingsForm)
+	r.POST("/save_meeting_rule", saveMeetingRuleForm)
+	r.GET("/delete_meeting_rule/:id", deleteMeetingRuleHandler)
+	r.GET("/feeds", showFeeds)
+	r.POST("/add_feed", addFeedForm)
+	r.GET("/delete_feed/:id", deleteFeedHandler)
+	r.GET("/ics/:file", serveFeed)
+	r.GET("/exchange_rates", showExchangeRates)
+	r.POST("/save_exchange_rate", saveExchangeRateForm)
+	r.GET("/delete_exchange_rate/:id", deleteExchangeRateHandler)
+
+	// Team members and time sheet approval
+	r.GET("/members", showMembers)
+	r.GET("/edit_member/:id", editMember)
+	r.POST("/save_member", saveMemberForm)
+	r.GET("/work_as/:id", workAsMember)
+	r.GET("/timesheets", showTimesheets)
+	r.GET("/timesheet", showTimesheet)
+	r.POST("/submit_timesheet", submitTimesheetForm)
+	r.POST("/review_timesheet/:id", reviewTimesheetForm)
 
 	// Start server, on non-default port
 	fmt.Println("Running on port 8222")
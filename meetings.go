@@ -0,0 +1,343 @@
+// Meetings imported from iCalendar files, e.g. exported from a calendar
+// app, proposed as work entries to review, edit and accept in bulk. The
+// project of each meeting is proposed by rules on its title or attendees,
+// or else by an attendee who is a contact linked to one active project.
+// Meetings imported before, even if dismissed, are skipped when a file is
+// imported again.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Work entry for a meeting, tagged as one
+func (mt Meeting) Work() Work {
+	return Work{
+		ProjectId:   mt.ProjectId,
+		WorkDate:    mt.WorkDate,
+		StartTime:   mt.StartTime,
+		EndTime:     mt.EndTime,
+		Hours:       mt.Hours,
+		Billable:    mt.Billable,
+		Description: mt.Summary,
+		MemberId:    mt.MemberId,
+		Tags:        []string{"meeting"},
+	}
+}
+
+// Key of a calendar event, to detect it when imported again: its UID and
+// start, as the events of a recurring meeting can share a UID
+func meetingUID(e ICalEvent) string {
+	uid := e.UID
+	if uid == "" {
+		uid = e.Summary
+	}
+	return uid + "/" + e.Start.Format("20060102T150405")
+}
+
+// Meeting for a calendar event, false if the event can't be logged as one
+// work entry: all-day events, and those ending on another day
+func eventMeeting(e ICalEvent) (Meeting, bool) {
+	if e.AllDay || !e.End.After(e.Start) || e.End.Format("2006-01-02") != e.Start.Format("2006-01-02") {
+		return Meeting{}, false
+	}
+	summary := strings.TrimSpace(e.Summary)
+	if summary == "" {
+		summary = "Meeting"
+	}
+	return Meeting{
+		ExtUID:    meetingUID(e),
+		WorkDate:  e.Start.Format("2006-01-02"),
+		StartTime: e.Start.Format("15:04"),
+		EndTime:   e.End.Format("15:04"),
+		Hours:     math.Round(e.End.Sub(e.Start).Hours()*100) / 100,
+		Summary:   summary,
+		Attendees: strings.Join(e.Attendees, ", "),
+	}, true
+}
+
+// Proposes projects for meetings, by the meeting rules in order, then by
+// attendees who are contacts linked to one active project
+type meetingMatcher struct {
+	rules    []MeetingRule
+	contacts map[string]int // contact ID by email address, lower case
+	projects map[int]int    // project of each contact looked up, 0 if not just one
+}
+
+// Make a matcher with the current rules and contacts
+func newMeetingMatcher() *meetingMatcher {
+	mm := &meetingMatcher{rules: getMeetingRules(), contacts: map[string]int{}, projects: map[int]int{}}
+	for _, c := range getContacts() {
+		for _, email := range splitEmails(c.Emails) {
+			mm.contacts[strings.ToLower(email)] = c.Id
+		}
+	}
+	return mm
+}
+
+// Project proposed for a meeting, 0 if none
+func (mm *meetingMatcher) project(mt Meeting) int {
+
+	// Rules match text anywhere in the title or an attendee's address,
+	// ignoring case, e.g. "standup" or "@example.com"
+	title := strings.ToLower(mt.Summary)
+	attendees := splitEmails(mt.Attendees)
+	for _, r := range mm.rules {
+		pattern := strings.ToLower(r.Pattern)
+		switch r.Field {
+		case "title":
+			if strings.Contains(title, pattern) {
+				return r.ProjectId
+			}
+		case "attendee":
+			for _, a := range attendees {
+				if strings.Contains(a, pattern) {
+					return r.ProjectId
+				}
+			}
+		}
+	}
+
+	// Otherwise the project of the first attendee who is a contact linked
+	// to one active project
+	for _, a := range attendees {
+		id, found := mm.contacts[a]
+		if !found {
+			continue
+		}
+		if _, done := mm.projects[id]; !done {
+			active := []int{}
+			for _, p := range getProjectsForContact(id) {
+				if p.Active {
+					active = append(active, p.Id)
+				}
+			}
+			if len(active) == 1 {
+				mm.projects[id] = active[0]
+			} else {
+				mm.projects[id] = 0
+			}
+		}
+		if mm.projects[id] != 0 {
+			return mm.projects[id]
+		}
+	}
+	return 0
+}
+
+// Propose a project for a meeting, billable if the project is
+func (mm *meetingMatcher) propose(mt *Meeting) {
+	mt.ProjectId = mm.project(*mt)
+	mt.Billable = true
+	if p, found := findProject(mt.ProjectId); found {
+		mt.Billable = p.IsBillable()
+	}
+}
+
+// Page showing the meetings waiting to be accepted, with forms to import
+// more and to add rules
+func showMeetings(c *gin.Context) {
+	showMeetingsPage(c, getMeetings("pending"), MeetingRule{Field: "title"}, ValidationErrors{})
+}
+
+// Show the meetings page, with the forms filled in and any errors, keyed by
+// form field, or by meeting ID for the meetings
+func showMeetingsPage(c *gin.Context, pending []Meeting, r MeetingRule, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "meetings.html", gin.H{
+		"meetings":   pending,
+		"counts":     getMeetingCounts(),
+		"rule":       r,
+		"rules":      getMeetingRules(),
+		"projects":   getActiveProjects(),
+		"imported":   c.Query("imported"),
+		"duplicates": c.Query("duplicates"),
+		"skipped":    c.Query("skipped"),
+		"accepted":   c.Query("accepted"),
+		"errors":     errs,
+		"current":    "log",
+	})
+}
+
+// Handle upload of an iCalendar file, adding its meetings for the current
+// team member, if any, skipping those already imported
+func importMeetingsForm(c *gin.Context) {
+
+	showErrors := func(errs ValidationErrors) {
+		showMeetingsPage(c, getMeetings("pending"), MeetingRule{Field: "title"}, errs)
+	}
+
+	// Read the events from the file
+	file, err := c.FormFile("ics")
+	if err != nil {
+		showErrors(ValidationErrors{"ics": "Please choose an iCalendar (.ics) file"})
+		return
+	}
+	if file.Size > maxICalSize {
+		showErrors(ValidationErrors{"ics": fmt.Sprintf("File cannot be larger than %d MB", maxICalSize>>20)})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		panic("importMeetingsForm open: " + err.Error())
+	}
+	defer f.Close()
+	events, err := parseICal(f)
+	if err != nil {
+		showErrors(ValidationErrors{"ics": "Could not read " + file.Filename + ": " + err.Error()})
+		return
+	}
+
+	// Meetings for the events not imported before, with proposed projects
+	memberId := 0
+	if me, found := currentMember(c); found {
+		memberId = me.Id
+	}
+	uids := getMeetingUIDs(memberId)
+	mm := newMeetingMatcher()
+	list := []Meeting{}
+	duplicates, skipped := 0, 0
+	for _, e := range events {
+		mt, ok := eventMeeting(e)
+		if !ok {
+			skipped++
+			continue
+		}
+		if uids[mt.ExtUID] {
+			duplicates++
+			continue
+		}
+		uids[mt.ExtUID] = true
+		mt.MemberId = memberId
+		mm.propose(&mt)
+		list = append(list, mt)
+	}
+
+	addMeetings(list)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/meetings?imported=%d&duplicates=%d&skipped=%d",
+		len(list), duplicates, skipped))
+}
+
+// Handle the form of meetings waiting to be accepted: save the changes to
+// them, and accept or dismiss the ones selected, all or none
+func saveMeetingsForm(c *gin.Context) {
+
+	// Changes to each meeting on the form, and the ones selected
+	errs := ValidationErrors{}
+	selected := map[string]bool{}
+	for _, id := range c.PostFormArray("selected") {
+		selected[id] = true
+	}
+	pending := getMeetings("pending")
+	changed, chosen := []Meeting{}, []Meeting{}
+	for i, mt := range pending {
+		key := strconv.Itoa(mt.Id)
+		if _, found := c.GetPostForm("hours_" + key); !found {
+			continue
+		}
+		hours, err := strconv.ParseFloat(c.PostForm("hours_"+key), 64)
+		if err != nil {
+			errs[key] = "Please enter hours as a number, e.g. 1.5"
+		}
+		mt.ProjectId, _ = strconv.Atoi(c.PostForm("project_" + key))
+		mt.Hours = hours
+		mt.Summary = strings.TrimSpace(c.PostForm("summary_" + key))
+		mt.Billable = c.PostForm("billable_"+key) == "on"
+		pending[i] = mt
+		changed = append(changed, mt)
+		if selected[key] {
+			chosen = append(chosen, mt)
+		}
+	}
+
+	switch c.PostForm("action") {
+	case "accept":
+		if len(chosen) == 0 {
+			errs["form"] = "Please select the meetings to accept"
+		}
+		for key, msg := range validateMeetings(chosen) {
+			if errs[key] == "" {
+				errs[key] = msg
+			}
+		}
+		if len(errs) > 0 {
+			showMeetingsPage(c, pending, MeetingRule{Field: "title"}, errs)
+			return
+		}
+		updateMeetings(changed)
+		acceptMeetings(chosen)
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/meetings?accepted=%d", len(chosen)))
+	case "dismiss":
+		ids := []int{}
+		for _, mt := range chosen {
+			ids = append(ids, mt.Id)
+		}
+		dismissMeetings(ids)
+		c.Redirect(http.StatusSeeOther, "/meetings")
+	default:
+		if len(errs) > 0 {
+			showMeetingsPage(c, pending, MeetingRule{Field: "title"}, errs)
+			return
+		}
+		updateMeetings(changed)
+		c.Redirect(http.StatusSeeOther, "/meetings")
+	}
+}
+
+// Handle form submission to add a meeting rule, proposing its project for
+// the meetings waiting to be accepted that don't have one yet
+func saveMeetingRuleForm(c *gin.Context) {
+
+	projectId, _ := strconv.Atoi(c.PostForm("project_id"))
+	r := MeetingRule{
+		Field:     c.PostForm("field"),
+		Pattern:   strings.TrimSpace(c.PostForm("pattern")),
+		ProjectId: projectId,
+	}
+
+	// Validate, and show the form again if there are any errors
+	errs := validateMeetingRule(r)
+	if len(errs) > 0 {
+		showMeetingsPage(c, getMeetings("pending"), r, errs)
+		return
+	}
+	saveMeetingRule(r)
+
+	// Propose projects again for the meetings without one
+	mm := newMeetingMatcher()
+	changed := []Meeting{}
+	for _, mt := range getMeetings("pending") {
+		if mt.ProjectId == 0 {
+			mm.propose(&mt)
+			if mt.ProjectId != 0 {
+				changed = append(changed, mt)
+			}
+		}
+	}
+	updateMeetings(changed)
+	c.Redirect(http.StatusSeeOther, "/meetings")
+}
+
+// Handle deletion of a meeting rule
+func deleteMeetingRuleHandler(c *gin.Context) {
+
+	// Get rule ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid meeting rule ID")
+		return
+	}
+
+	deleteMeetingRule(id)
+	c.Redirect(http.StatusSeeOther, "/meetings")
+}
@@ -0,0 +1,349 @@
+// PDF output of invoices, weekly time sheets and project activity summaries,
+// generated on the server with a letterhead from settings (company name,
+// address, tax ID and bank details), so that they print properly.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+)
+
+// Letterhead settings, in the order shown on the settings page
+var letterheadSettings = []string{"company_name", "company_address", "tax_id", "bank_info"}
+
+// A PDF document with letterhead, and a function to translate UTF-8 text
+// to the encoding used by the built-in fonts
+type pdfDoc struct {
+	*fpdf.Fpdf
+	tr func(string) string
+}
+
+// Start a new A4 PDF document, with the letterhead at the top of each page
+// and page numbers (and bank details, if wanted) at the bottom
+func newPDF(title string, showBank bool) *pdfDoc {
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	doc := &pdfDoc{pdf, pdf.UnicodeTranslatorFromDescriptor("")}
+	pdf.SetTitle(title, true)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 25)
+	pdf.AliasNbPages("")
+
+	// Letterhead: company name and address on the left, tax ID on the right
+	company := getSetting("company_name", "")
+	address := getSetting("company_address", "")
+	taxId := getSetting("tax_id", "")
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.CellFormat(120, 7, doc.tr(company), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		if taxId != "" {
+			pdf.CellFormat(0, 7, doc.tr("Tax ID: "+taxId), "", 0, "R", false, 0, "")
+		}
+		pdf.Ln(7)
+		for _, line := range strings.Split(address, "\n") {
+			pdf.CellFormat(0, 4, doc.tr(strings.TrimSpace(line)), "", 1, "L", false, 0, "")
+		}
+		y := pdf.GetY() + 2
+		pdf.Line(15, y, 195, y)
+		pdf.SetY(y + 6)
+	})
+
+	// Footer: bank details and page number
+	bank := getSetting("bank_info", "")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-20)
+		pdf.SetFont("Helvetica", "", 8)
+		if showBank && bank != "" {
+			pdf.MultiCell(150, 3.5, doc.tr(bank), "", "L", false)
+		}
+		pdf.SetY(-12)
+		pdf.CellFormat(0, 4, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+
+	pdf.AddPage()
+	return doc
+}
+
+// Write a title line
+func (doc *pdfDoc) title(s string) {
+	doc.SetFont("Helvetica", "B", 16)
+	doc.CellFormat(0, 10, doc.tr(s), "", 1, "L", false, 0, "")
+	doc.SetFont("Helvetica", "", 10)
+}
+
+// Write a label and value on one line
+func (doc *pdfDoc) field(label, value string) {
+	doc.SetFont("Helvetica", "B", 10)
+	doc.CellFormat(40, 6, doc.tr(label), "", 0, "L", false, 0, "")
+	doc.SetFont("Helvetica", "", 10)
+	doc.MultiCell(0, 6, doc.tr(value), "", "L", false)
+}
+
+// Write one table row, wrapping text within each cell, with a line under
+// it. Aligns are "L", "C" or "R" for each column. Bold for header rows.
+func (doc *pdfDoc) row(widths []float64, aligns []string, cells []string, bold bool) {
+
+	const lineHeight = 5.0
+	style := ""
+	if bold {
+		style = "B"
+	}
+	doc.SetFont("Helvetica", style, 9)
+
+	// Height of the row is the height of the cell with the most lines
+	lines := 1
+	for i, cell := range cells {
+		lines = max(lines, len(doc.SplitText(doc.tr(cell), widths[i]-2)))
+	}
+	h := float64(lines) * lineHeight
+
+	// New page if the row won't fit
+	_, pageHeight := doc.GetPageSize()
+	_, _, _, bottom := doc.GetMargins()
+	if doc.GetY()+h > pageHeight-bottom {
+		doc.AddPage()
+	}
+
+	// Draw each cell, then line under
+	left, y := doc.GetX(), doc.GetY()
+	x := left
+	for i, cell := range cells {
+		doc.SetXY(x, y)
+		doc.MultiCell(widths[i], lineHeight, doc.tr(cell), "", aligns[i], false)
+		x += widths[i]
+	}
+	doc.Line(left, y+h, x, y+h)
+	doc.SetXY(left, y+h)
+}
+
+// Send the PDF document as the response
+func (doc *pdfDoc) send(c *gin.Context, filename string) {
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", "inline; filename=\""+filename+"\"")
+	err := doc.Output(c.Writer)
+	if err != nil {
+		panic("PDF output: " + err.Error())
+	}
+}
+
+// Format an amount for PDF output
+func money(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// PDF of one invoice
+func invoicePDF(c *gin.Context) {
+
+	// Get invoice ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+	inv := getInvoice(id)
+	items := getInvoiceItems(id)
+
+	// Invoice details
+	doc := newPDF(fmt.Sprintf("Invoice %d", inv.Number), true)
+	doc.title(fmt.Sprintf("Invoice %d", inv.Number))
+	doc.field("Client", inv.Client)
+	if cl, found := findClient(inv.ClientId); found && cl.Address != "" {
+		doc.field("Address", cl.Address)
+	}
+	doc.field("Invoice date", inv.InvoiceDate)
+	doc.field("Period", inv.StartDate+" to "+inv.EndDate)
+	if inv.Currency != "" {
+		doc.field("Currency", inv.Currency)
+	}
+	if inv.Notes != "" {
+		doc.field("Notes", inv.Notes)
+	}
+	doc.Ln(5)
+
+	// Items
+	widths := []float64{22, 35, 73, 15, 17, 18}
+	aligns := []string{"L", "L", "L", "R", "R", "R"}
+	doc.row(widths, aligns, []string{"Date", "Project", "Description", "Hours", "Rate", "Amount"}, true)
+	var hours float64
+	for _, it := range items {
+		if it.ExpenseId > 0 {
+			doc.row(widths, aligns, []string{it.ItemDate, it.ProjectName, it.Description, "", "", money(it.Amount)}, false)
+			continue
+		}
+		doc.row(widths, aligns, []string{it.ItemDate, it.ProjectName, it.Description,
+			money(it.Hours), money(it.Rate), money(it.Amount)}, false)
+		hours += it.Hours
+	}
+	doc.row(widths, aligns, []string{"Total", "", "", money(hours), "", money(inv.Total)}, true)
+
+	doc.send(c, fmt.Sprintf("invoice-%d.pdf", inv.Number))
+}
+
+// PDF of a weekly time sheet: hours by project and day, then the entries.
+// The week is the one containing the "date" query parameter (default today).
+func timesheetPDF(c *gin.Context) {
+
+	// Start and end of week, from the first day of the week in the settings
+	date, err := time.Parse("2006-01-02", c.DefaultQuery("date", time.Now().Format("2006-01-02")))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid date")
+		return
+	}
+	start := weekStart(date)
+	days := []string{}
+	for i := 0; i < 7; i++ {
+		days = append(days, start.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+
+	// In team mode, only the work of one member, from the query or the
+	// current member
+	title := "Time sheet, week of " + days[0]
+	var entries []Work
+	if teamMode() {
+		me, _ := currentMember(c)
+		memberId, err := strconv.Atoi(c.DefaultQuery("member", strconv.Itoa(me.Id)))
+		if err != nil {
+			c.String(http.StatusBadRequest, "Invalid member ID")
+			return
+		}
+		member, found := findMember(memberId)
+		if !found {
+			c.Redirect(http.StatusSeeOther, "/members")
+			return
+		}
+		entries = getMemberWork(member.Id, days[0], days[6])
+		title = "Time sheet of " + member.Name + ", week of " + days[0]
+	} else {
+		entries = getWorkEntriesBetween(days[0], days[6])
+	}
+
+	// Hours by project and day, projects in order first worked on
+	type projectWeek struct {
+		Name  string
+		Hours [7]float64
+		Total float64
+	}
+	projects := []*projectWeek{}
+	byId := map[int]*projectWeek{}
+	var dayTotals [7]float64
+	var total float64
+	for _, w := range entries {
+		pw := byId[w.ProjectId]
+		if pw == nil {
+			pw = &projectWeek{Name: w.Client + " - " + w.ProjectName}
+			byId[w.ProjectId] = pw
+			projects = append(projects, pw)
+		}
+		for i, d := range days {
+			if d == w.WorkDate {
+				pw.Hours[i] += w.Hours
+				dayTotals[i] += w.Hours
+			}
+		}
+		pw.Total += w.Hours
+		total += w.Hours
+	}
+
+	// Grid of hours
+	doc := newPDF(title, false)
+	doc.title(title)
+	widths := []float64{61, 15, 15, 15, 15, 15, 15, 15, 14}
+	aligns := []string{"L", "R", "R", "R", "R", "R", "R", "R", "R"}
+	header := []string{"Project"}
+	locale := currentLocale()
+	for i := range days {
+		header = append(header, locale.DayLabel(start.AddDate(0, 0, i)))
+	}
+	doc.row(widths, aligns, append(header, "Total"), true)
+	hoursCell := func(h float64) string {
+		if h == 0 {
+			return ""
+		}
+		return money(h)
+	}
+	for _, pw := range projects {
+		cells := []string{pw.Name}
+		for _, h := range pw.Hours {
+			cells = append(cells, hoursCell(h))
+		}
+		doc.row(widths, aligns, append(cells, money(pw.Total)), false)
+	}
+	cells := []string{"Total"}
+	for _, h := range dayTotals {
+		cells = append(cells, hoursCell(h))
+	}
+	doc.row(widths, aligns, append(cells, money(total)), true)
+	doc.Ln(8)
+
+	// Entries
+	widths = []float64{22, 50, 15, 93}
+	aligns = []string{"L", "L", "R", "L"}
+	doc.row(widths, aligns, []string{"Date", "Project", "Hours", "Description"}, true)
+	for _, w := range entries {
+		doc.row(widths, aligns, []string{w.WorkDate, w.Client + " - " + w.ProjectName, money(w.Hours), w.Description}, false)
+	}
+
+	doc.send(c, "timesheet-"+days[0]+".pdf")
+}
+
+// PDF summary of activity on one project
+func projectPDF(c *gin.Context) {
+
+	// Get project ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	p := getProject(id)
+	entries := getWorkEntriesForProject(id)
+	rate := getProjectRate(p)
+	revenue := setWorkRevenue(entries, p)
+	var hours, billableHours float64
+	for _, w := range entries {
+		hours += w.Hours
+		if w.Billable {
+			billableHours += w.Hours
+		}
+	}
+
+	// Project details and totals
+	doc := newPDF(p.Client+" - "+p.Name, false)
+	doc.title(p.Name)
+	doc.field("Client", p.Client)
+	if p.Description != "" {
+		doc.field("Description", p.Description)
+	}
+	doc.field("Category", p.Category)
+	if len(entries) > 0 {
+		doc.field("Period", entries[0].WorkDate+" to "+entries[len(entries)-1].WorkDate)
+	}
+	doc.field("Hours", fmt.Sprintf("%s (%s billable)", money(hours), money(billableHours)))
+	doc.field("Revenue", fmt.Sprintf("%s %s at %s per hour", money(revenue), getProjectCurrency(p), money(rate)))
+	if p.BudgetHours > 0 {
+		doc.field("Hours budget", fmt.Sprintf("%s, %s remaining", money(p.BudgetHours), money(p.BudgetHours-hours)))
+	}
+	if p.Fees > 0 {
+		doc.field("Fee budget", fmt.Sprintf("%s, %s remaining", money(p.Fees), money(p.Fees-revenue)))
+	}
+	doc.Ln(5)
+
+	// Entries
+	widths := []float64{22, 15, 18, 125}
+	aligns := []string{"L", "R", "R", "L"}
+	doc.row(widths, aligns, []string{"Date", "Hours", "Revenue", "Description"}, true)
+	for _, w := range entries {
+		doc.row(widths, aligns, []string{w.WorkDate, money(w.Hours), money(w.Revenue), w.Description}, false)
+	}
+	doc.row(widths, aligns, []string{"Total", money(hours), money(revenue), ""}, true)
+
+	doc.send(c, fmt.Sprintf("project-%d.pdf", p.Id))
+}
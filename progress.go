@@ -0,0 +1,88 @@
+// Project progress: estimated hours, percent complete (updated manually),
+// and the forecast estimate at completion derived from hours logged so far.
+// Also the portfolio report comparing these across active projects.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Estimate at completion, in hours: hours logged so far scaled up by percent
+// complete. Until progress has been reported, falls back to the estimate (or
+// hours so far if more, or if there is no estimate).
+func estimateAtCompletion(p Project) float64 {
+	if p.Complete > 0 {
+		return p.Hours / p.Complete * 100
+	}
+	return max(p.Estimate, p.Hours)
+}
+
+// Fill in the forecast for a list of projects (after hours are set)
+func setProjectForecasts(pp []Project) {
+	for i := range pp {
+		pp[i].Forecast = estimateAtCompletion(pp[i])
+	}
+}
+
+// Handle the quick update of percent complete from the project page
+func updateProjectComplete(c *gin.Context) {
+
+	// Get project ID from URL, percent complete from form
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	if _, found := findProject(id); !found {
+		c.String(http.StatusNotFound, "Project not found")
+		return
+	}
+	complete, err := strconv.ParseFloat(c.PostForm("complete"), 64)
+	if err != nil || complete < 0 || complete > 100 {
+		c.String(http.StatusBadRequest, "Percent complete must be a number from 0 to 100")
+		return
+	}
+
+	// Save and go back to the project page
+	saveProjectComplete(id, complete)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/project/%d", id))
+}
+
+// Portfolio report: estimate, actual and forecast for all active projects
+func showPortfolio(c *gin.Context) {
+
+	// Active projects, with forecasts
+	projects := getActiveProjects()
+	setProjectForecasts(projects)
+
+	// Totals, and variance of forecast against estimate
+	type row struct {
+		Project
+		Variance float64 // forecast minus estimate, if there is an estimate
+	}
+	rows := []row{}
+	var estimate, actual, forecast float64
+	for _, p := range projects {
+		r := row{Project: p}
+		if p.Estimate > 0 {
+			r.Variance = p.Forecast - p.Estimate
+		}
+		rows = append(rows, r)
+		estimate += p.Estimate
+		actual += p.Hours
+		forecast += p.Forecast
+	}
+
+	c.HTML(http.StatusOK, "portfolio.html", gin.H{
+		"rows":     rows,
+		"estimate": estimate,
+		"actual":   actual,
+		"forecast": forecast,
+		"current":  "reports",
+	})
+}
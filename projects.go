@@ -3,10 +3,12 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	//"sort"
-	//"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,8 +31,10 @@ func showProjects(c *gin.Context) {
 		filter = "active"
 	}
 
-	// Get all projects
+	// Get all projects, with revenue and budget alerts
 	allProjects := getProjects()
+	setProjectRates(allProjects)
+	setProjectBudgets(allProjects)
 
 	// Filter projects based on filter parameter
 	var filteredProjects []Project
@@ -57,10 +61,22 @@ func showProjects(c *gin.Context) {
 		gin.H{
 			"projects": filteredProjects,
 			"filter":   filter,
+			"legacy":   len(getLegacyClients()),
 			"current":  "projects",
 		})
 }
 
+// Get a list of active projects, e.g., for dropdowns
+func getActiveProjects() []Project {
+	active := []Project{}
+	for _, p := range getProjects() {
+		if p.Active {
+			active = append(active, p)
+		}
+	}
+	return active
+}
+
 // Page showing one project
 func showProject(c *gin.Context) {
 
@@ -76,20 +92,83 @@ func showProject(c *gin.Context) {
 	project := getProject(id)
 	entries := getWorkEntriesForProject(id)
 
-	totalHours := 0.0
+	// Total hours, and revenue at the project's effective rate
+	totalHours, billableHours := 0.0, 0.0
 	for _, e := range entries {
 		totalHours += e.Hours
+		if e.Billable {
+			billableHours += e.Hours
+		}
 	}
+	rate := getProjectRate(project)
+	totalRevenue := setWorkRevenue(entries, project)
+
+	// Expenses, and total of billable ones in the project's currency,
+	// noting any currencies that couldn't be converted
+	currency := getProjectCurrency(project)
+	cv := newConverter()
+	expenses := getExpensesForProject(id)
+	var totalExpenses, billableExpenses float64
+	missingRates := []string{}
+	for _, e := range expenses {
+		amount, ok := cv.Convert(e.Amount, e.Currency, currency, e.ExpenseDate)
+		if !ok {
+			missingRates = append(missingRates, e.Currency)
+			continue
+		}
+		totalExpenses += amount
+		if e.Billable {
+			billableExpenses += amount
+		}
+	}
+
+	// Tasks with hours rolled up from subtasks, and work not on any task
+	tasks := getTasks(id)
+	noTaskLogs, noTaskHours, noTaskBillable := 0, 0.0, 0.0
+	for _, e := range entries {
+		if e.TaskId == 0 {
+			noTaskLogs++
+			noTaskHours += e.Hours
+			if e.Billable {
+				noTaskBillable += e.Hours
+			}
+		}
+	}
+
+	// Budget used, forecast, and burn-down chart if there is a budget
+	project.Hours = totalHours
+	project.BillableHours = billableHours
+	project.EffectiveRate = rate
+	project.Revenue = totalRevenue
+	pp := []Project{project}
+	setProjectBudgets(pp)
+	setProjectForecasts(pp)
+	project = pp[0]
 
 	// Show the page
 	c.HTML(http.StatusOK,
 		"project.html",
 		gin.H{
-			"p":          project,
-			"entries":    entries,
-			"totalCount": len(entries),
-			"totalHours": totalHours,
-			"current":    "projects",
+			"p":                project,
+			"entries":          entries,
+			"totalCount":       len(entries),
+			"totalHours":       totalHours,
+			"billableHours":    billableHours,
+			"rate":             rate,
+			"currency":         currency,
+			"missingRates":     strings.Join(missingRates, ", "),
+			"totalRevenue":     totalRevenue,
+			"tasks":            tasks,
+			"noTaskLogs":       noTaskLogs,
+			"noTaskHours":      noTaskHours,
+			"noTaskBillable":   noTaskBillable,
+			"expenses":         expenses,
+			"totalExpenses":    totalExpenses,
+			"billableExpenses": billableExpenses,
+			"chart":            burnDownChart(project, entries),
+			"hoursRemaining":   project.BudgetHours - totalHours,
+			"feesRemaining":    project.Fees - totalRevenue,
+			"current":          "projects",
 		})
 }
 
@@ -109,8 +188,9 @@ func editProject(c *gin.Context) {
 
 	var p Project
 	if id == 0 {
-		// New project - create empty project
-		p = Project{Id: 0, Client: "", Name: "", Description: "", Category: "", Active: true}
+		// New project - create empty project, for the client given if any
+		clientId, _ := strconv.Atoi(c.Query("client"))
+		p = Project{Id: 0, ClientId: clientId, Name: "", Description: "", Category: "", Active: true}
 	} else {
 		// Existing project - get from database
 		p = getProject(id)
@@ -119,7 +199,7 @@ func editProject(c *gin.Context) {
 	// Show the edit page
 	c.HTML(http.StatusOK,
 		"edit_project.html",
-		gin.H{"project": p, "current": "projects"})
+		gin.H{"project": p, "clients": getClients(), "errors": ValidationErrors{}, "current": "projects"})
 }
 
 // Handle form submission to save a project
@@ -133,14 +213,55 @@ func saveProjectForm(c *gin.Context) {
 		return
 	}
 
-	// Get form values
+	// Get form values, rate, fees, budget and progress are optional
+	errs := ValidationErrors{}
+	rate, err := parseAmount(c.PostForm("rate"))
+	if err != nil {
+		errs["rate"] = "Please enter the rate as a number, or leave blank"
+	}
+	fees, err := parseAmount(c.PostForm("fees"))
+	if err != nil {
+		errs["fees"] = "Please enter the fees as a number, or leave blank"
+	}
+	budgetHours, err := parseAmount(c.PostForm("budget_hours"))
+	if err != nil {
+		errs["budget_hours"] = "Please enter the hours budget as a number, or leave blank"
+	}
+	estimate, err := parseAmount(c.PostForm("estimate"))
+	if err != nil {
+		errs["estimate"] = "Please enter the estimate as a number, or leave blank"
+	}
+	complete, err := parseAmount(c.PostForm("complete"))
+	if err != nil {
+		errs["complete"] = "Please enter percent complete as a number, or leave blank"
+	}
+	clientId, _ := strconv.Atoi(c.PostForm("client_id"))
 	p := Project{
 		Id:          id,
-		Client:      c.PostForm("client"),
+		ClientId:    clientId,
 		Name:        c.PostForm("name"),
 		Description: c.PostForm("description"),
 		Category:    c.PostForm("category"),
 		Active:      c.PostForm("active") == "on" || c.PostForm("active") == "true",
+		Rate:        rate,
+		Fees:        fees,
+		BudgetHours: budgetHours,
+		Estimate:    estimate,
+		Complete:    complete,
+		Currency:    strings.ToUpper(strings.TrimSpace(c.PostForm("currency"))),
+	}
+
+	// Check the project, show form again if there are errors
+	for field, msg := range validateProject(p) {
+		if errs[field] == "" {
+			errs[field] = msg
+		}
+	}
+	if len(errs) > 0 {
+		c.HTML(http.StatusUnprocessableEntity,
+			"edit_project.html",
+			gin.H{"project": p, "clients": getClients(), "errors": errs, "current": "projects"})
+		return
 	}
 
 	// Save the project
@@ -161,8 +282,35 @@ func deleteProjectHandler(c *gin.Context) {
 		return
 	}
 
-	// Delete the project (and all child records)
+	// Can't delete work entries in a locked period
+	if projectHasLockedWork(id) {
+		c.String(http.StatusBadRequest, "Project has work entries in a locked period, reopen the period first to delete it")
+		return
+	}
+
+	// Can't delete work on submitted or approved time sheets
+	if projectHasApprovedWork(id) {
+		c.String(http.StatusBadRequest, "Project has work entries on submitted or approved time sheets, it cannot be deleted")
+		return
+	}
+
+	// Can't delete work or expenses that have been invoiced
+	if projectHasInvoicedWork(id) {
+		c.String(http.StatusBadRequest, "Project has invoiced work or expenses, delete its invoices first to delete it")
+		return
+	}
+
+	// Delete the project (and all child records), and expense receipts
+	receipts := []string{}
+	for _, e := range getExpensesForProject(id) {
+		if e.Receipt != "" {
+			receipts = append(receipts, e.Receipt)
+		}
+	}
 	deleteProject(id)
+	for _, r := range receipts {
+		os.Remove(filepath.Join(receiptsDir, r))
+	}
 
 	// Redirect to projects list
 	c.Redirect(http.StatusSeeOther, "/projects")
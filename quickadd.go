@@ -0,0 +1,248 @@
+// Page handlers for work entry templates, and the quick-add box in the menu
+// bar, which parses a compact one-line syntax into a work entry, e.g.
+//
+//	2.5h acme/website fixed login bug
+//	yesterday 90m acme/web call with Bob
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page showing list of all work entry templates
+func showWorkTemplates(c *gin.Context) {
+	c.HTML(http.StatusOK, "entry_templates.html",
+		gin.H{"templates": getWorkTemplates(), "current": "templates"})
+}
+
+// Page to edit a work entry template (or create new one if id is 0)
+func editWorkTemplate(c *gin.Context) {
+
+	// Get template ID
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	t := WorkTemplate{Hours: 1.0, Billable: true} // defaults for new template
+	if id > 0 {
+		t = getWorkTemplate(id)
+	}
+
+	// Show the edit page, with active projects for dropdown
+	c.HTML(http.StatusOK, "edit_template.html", gin.H{
+		"t":        t,
+		"projects": getActiveProjects(),
+		"current":  "templates",
+	})
+}
+
+// Handle form submission to save a work entry template
+func saveWorkTemplateForm(c *gin.Context) {
+
+	// Parse fields
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+	projectId, err := strconv.Atoi(c.PostForm("project_id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid project")
+		return
+	}
+	hours, err := strconv.ParseFloat(c.PostForm("hours"), 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid hours")
+		return
+	}
+
+	t := WorkTemplate{
+		Id:          id,
+		Name:        strings.TrimSpace(c.PostForm("name")),
+		ProjectId:   projectId,
+		Hours:       hours,
+		Billable:    c.PostForm("billable") == "on" || c.PostForm("billable") == "true",
+		Description: c.PostForm("description"),
+	}
+	saveWorkTemplate(t)
+
+	// Back to list of templates
+	c.Redirect(http.StatusSeeOther, "/entry_templates")
+}
+
+// Handle deletion of a work entry template
+func deleteWorkTemplateHandler(c *gin.Context) {
+
+	// Get template ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	// Delete and redirect to list
+	deleteWorkTemplate(id)
+	c.Redirect(http.StatusSeeOther, "/entry_templates")
+}
+
+// Handle the quick-add box: parse the text into a work entry and save it.
+// If the text cannot be parsed, show the normal edit form with whatever
+// could be parsed filled in, and the error message at the top.
+func quickAdd(c *gin.Context) {
+
+	text := strings.TrimSpace(c.PostForm("text"))
+	w, err := parseQuickAdd(text, getActiveProjects(), time.Now())
+	if err != nil {
+		showWorkForm(c, w, ValidationErrors{}, err.Error())
+		return
+	}
+
+	// Check and save the new entry, for the current team member if any, and
+	// show it
+	if me, found := currentMember(c); found {
+		w.MemberId = me.Id
+	}
+	if errs := validateWork(w); len(errs) > 0 {
+		showWorkForm(c, w, errs, "Quick add: please correct the entry below")
+		return
+	}
+	savedId := saveWork(w)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/work_entry/%d", savedId))
+}
+
+// Parse quick-add text, in the form "[date] hours project description".
+// The optional date is "today", "yesterday" or YYYY-MM-DD, hours can be
+// given as "2.5h", "2.5", "90m" or "1:30", and the project is matched
+// by "client/name" prefix (or just name prefix) against the projects
+// given. On error, returns the partially filled work entry, so that the
+// caller can show it in the edit form.
+func parseQuickAdd(text string, projects []Project, now time.Time) (Work, error) {
+
+	// Start with defaults for a new entry
+	w := Work{WorkDate: now.Format("2006-01-02"), Hours: 1.0, Billable: true, Description: text}
+	tokens := strings.Fields(text)
+	if len(tokens) == 0 {
+		return w, errors.New("Quick add: nothing entered, expected e.g. \"2.5h acme/website fixed login bug\"")
+	}
+
+	// Optional date at the start
+	switch strings.ToLower(tokens[0]) {
+	case "today":
+		tokens = tokens[1:]
+	case "yesterday":
+		w.WorkDate = now.AddDate(0, 0, -1).Format("2006-01-02")
+		tokens = tokens[1:]
+	default:
+		if _, err := time.Parse("2006-01-02", tokens[0]); err == nil {
+			w.WorkDate = tokens[0]
+			tokens = tokens[1:]
+		}
+	}
+
+	// Hours, then project
+	if len(tokens) < 2 {
+		return w, errors.New("Quick add: expected hours followed by a project, e.g. \"2.5h acme/website\"")
+	}
+	hours, err := parseHours(tokens[0])
+	if err != nil {
+		return w, err
+	}
+	w.Hours = hours
+	w.Description = strings.Join(tokens[1:], " ")
+	p, err := resolveProject(tokens[1], projects)
+	if err != nil {
+		return w, err
+	}
+
+	// Fill in the rest from the project
+	w.ProjectId = p.Id
+	w.Billable = p.IsBillable()
+	w.ProjectName = p.Name
+	w.Client = p.Client
+	w.Description = strings.Join(tokens[2:], " ")
+	return w, nil
+}
+
+// Parse a duration in hours, e.g., "2.5h", "2.5", "90m", "1:30"
+func parseHours(s string) (float64, error) {
+
+	invalid := fmt.Errorf("Quick add: invalid hours \"%s\", expected e.g. 2.5h, 90m or 1:30", s)
+	ls := strings.ToLower(s)
+
+	// Hours and minutes
+	if h, m, ok := strings.Cut(ls, ":"); ok {
+		hh, err1 := strconv.Atoi(h)
+		mm, err2 := strconv.Atoi(m)
+		if err1 != nil || err2 != nil || mm < 0 || mm >= 60 {
+			return 0, invalid
+		}
+		return float64(hh) + float64(mm)/60, nil
+	}
+
+	// Minutes
+	if m, ok := strings.CutSuffix(ls, "m"); ok {
+		mm, err := strconv.ParseFloat(m, 64)
+		if err != nil {
+			return 0, invalid
+		}
+		return mm / 60, nil
+	}
+
+	// Hours, with or without "h"
+	h, err := strconv.ParseFloat(strings.TrimSuffix(ls, "h"), 64)
+	if err != nil {
+		return 0, invalid
+	}
+	return h, nil
+}
+
+// Find the project matching a "client/name" spec, where each part is a
+// case-insensitive prefix (if there is no slash, only the name is matched).
+// An exact match wins over other prefix matches.
+func resolveProject(spec string, projects []Project) (Project, error) {
+
+	clientPre, namePre, hasClient := strings.Cut(strings.ToLower(spec), "/")
+	if !hasClient {
+		namePre, clientPre = clientPre, ""
+	}
+
+	// Collect prefix matches, and exact matches separately
+	var matches, exact []Project
+	for _, p := range projects {
+		client := strings.ToLower(strings.TrimSpace(p.Client))
+		name := strings.ToLower(strings.TrimSpace(p.Name))
+		if !strings.HasPrefix(client, clientPre) || !strings.HasPrefix(name, namePre) {
+			continue
+		}
+		matches = append(matches, p)
+		if name == namePre && (!hasClient || client == clientPre) {
+			exact = append(exact, p)
+		}
+	}
+
+	// Need exactly one
+	if len(exact) == 1 {
+		return exact[0], nil
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) == 0 {
+		return Project{}, fmt.Errorf("Quick add: no active project matches \"%s\" (use client/name, e.g. acme/website)", spec)
+	}
+	names := []string{}
+	for _, p := range matches {
+		names = append(names, strings.TrimSpace(p.Client)+"/"+strings.TrimSpace(p.Name))
+	}
+	return Project{}, fmt.Errorf("Quick add: \"%s\" is ambiguous, it matches %s", spec, strings.Join(names, ", "))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHours(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"2.5h", 2.5, true},
+		{"2.5H", 2.5, true},
+		{"2.5", 2.5, true},
+		{"90m", 1.5, true},
+		{"1:30", 1.5, true},
+		{"0:45", 0.75, true},
+		{"1:60", 0, false},
+		{"1:x", 0, false},
+		{"xm", 0, false},
+		{"h", 0, false},
+		{"fixed", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseHours(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseHours(%q) error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseHours(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResolveProject(t *testing.T) {
+	projects := []Project{
+		{Id: 1, Client: "ACME", Name: "website"},
+		{Id: 2, Client: "ACME", Name: "webshop"},
+		{Id: 3, Client: "Globex", Name: "website"},
+		{Id: 4, Client: "Globex", Name: "support"},
+		{Id: 5, Client: "Initech", Name: "web"},
+		{Id: 6, Client: "Initech", Name: "website"},
+	}
+	tests := []struct {
+		spec string
+		want int // project ID, 0 for an error
+	}{
+		{"acme/website", 1},
+		{"ACME/WEBSITE", 1},
+		{"ac/websh", 2},
+		{"glo/web", 3},
+		{"support", 4},
+		{"sup", 4},
+		{"initech/web", 5}, // exact match wins over prefix match
+		{"init/web", 0},    // only exact if the client is too
+		{"acme/web", 0},    // website and webshop
+		{"website", 0},     // three clients have one
+		{"g/website", 3},   // client prefix narrows it down
+		{"nobody/website", 0},
+		{"acme/", 0}, // every ACME project
+	}
+	for _, tt := range tests {
+		p, err := resolveProject(tt.spec, projects)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("resolveProject(%q) = project %d, want error", tt.spec, p.Id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveProject(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if p.Id != tt.want {
+			t.Errorf("resolveProject(%q) = project %d, want %d", tt.spec, p.Id, tt.want)
+		}
+	}
+}
+
+func TestParseQuickAdd(t *testing.T) {
+	projects := []Project{
+		{Id: 1, Client: "ACME", Name: "website", Category: "Billable"},
+		{Id: 2, Client: "ACME", Name: "training", Category: "Training"},
+	}
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.Local)
+	tests := []struct {
+		text        string
+		date        string
+		hours       float64
+		project     int
+		billable    bool
+		description string
+		ok          bool
+	}{
+		{"2.5h acme/website fixed login bug", "2025-03-10", 2.5, 1, true, "fixed login bug", true},
+		{"today 1:30 website", "2025-03-10", 1.5, 1, true, "", true},
+		{"yesterday 90m train course", "2025-03-09", 1.5, 2, false, "course", true},
+		{"2025-02-28 3 acme/web deploy", "2025-02-28", 3, 1, true, "deploy", true},
+		{"Yesterday 1h website", "2025-03-09", 1, 1, true, "", true},
+		{"", "2025-03-10", 1, 0, true, "", false},
+		{"2h", "2025-03-10", 1, 0, true, "2h", false},
+		{"lots acme/website", "2025-03-10", 1, 0, true, "lots acme/website", false},
+		{"2h nothing here", "2025-03-10", 2, 0, true, "nothing here", false},
+	}
+	for _, tt := range tests {
+		w, err := parseQuickAdd(tt.text, projects, now)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseQuickAdd(%q) error = %v, want ok %v", tt.text, err, tt.ok)
+			continue
+		}
+		if w.WorkDate != tt.date || w.Hours != tt.hours || w.ProjectId != tt.project ||
+			w.Billable != tt.billable || w.Description != tt.description {
+			t.Errorf("parseQuickAdd(%q) = %s %v project %d billable %v %q, want %s %v project %d billable %v %q",
+				tt.text, w.WorkDate, w.Hours, w.ProjectId, w.Billable, w.Description,
+				tt.date, tt.hours, tt.project, tt.billable, tt.description)
+		}
+	}
+}
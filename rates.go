@@ -0,0 +1,86 @@
+// Hourly rates and revenue. The rate for work on a project is the project's
+// own rate if set, otherwise the rate set for its client, otherwise the rate
+// of the team member who did the work, otherwise the default rate from
+// settings. Revenue is only earned on billable work. Rates and revenue are
+// in the project's currency (see currency.go).
+
+package main
+
+// Rates to look up the effective rate of work: client rates by client name,
+// member rates by member ID, and the default rate
+type Rates struct {
+	Clients map[string]float64
+	Members map[int]float64
+	Default float64
+}
+
+// Get the client, member and default rates
+func getRates() Rates {
+	return Rates{
+		Clients: getClientRates(),
+		Members: getMemberRates(),
+		Default: settingFloat("default_rate", 0),
+	}
+}
+
+// Effective hourly rate for work on a project by a team member, 0 for work
+// by nobody in particular
+func (r Rates) For(p Project, memberId int) float64 {
+	if p.Rate > 0 {
+		return p.Rate
+	}
+	if rate, ok := r.Clients[p.Client]; ok && rate > 0 {
+		return rate
+	}
+	if rate := r.Members[memberId]; rate > 0 {
+		return rate
+	}
+	return r.Default
+}
+
+// Effective hourly rate for one project, for work without a member rate,
+// looking up client and default rates
+func getProjectRate(p Project) float64 {
+	return getRates().For(p, 0)
+}
+
+// Fill in the effective rate, currency and revenue for a list of projects
+func setProjectRates(pp []Project) {
+	setProjectRatesBetween(pp, "0000-00-00", "9999-99-99")
+}
+
+// Fill in the effective rate, currency and revenue for a list of projects,
+// with revenue for the billable hours between two dates, as the projects'
+// hours are. Hours of members with their own rate earn that rate on projects
+// without a project or client rate.
+func setProjectRatesBetween(pp []Project, startDate, endDate string) {
+	rates := getRates()
+	memberHours := map[int]map[int]float64{}
+	if len(rates.Members) > 0 {
+		memberHours = getBillableHoursByMember(startDate, endDate)
+	}
+	clientCurrencies := getClientCurrencies()
+	base := baseCurrency()
+	for i := range pp {
+		pp[i].EffectiveRate = rates.For(pp[i], 0)
+		pp[i].EffectiveCurrency = projectCurrency(pp[i], clientCurrencies, base)
+		pp[i].Revenue = pp[i].BillableHours * pp[i].EffectiveRate
+		for memberId, hours := range memberHours[pp[i].Id] {
+			pp[i].Revenue += hours * (rates.For(pp[i], memberId) - pp[i].EffectiveRate)
+		}
+	}
+}
+
+// Fill in revenue for a list of work entries on one project, at the rate
+// for the member of each entry, returns total
+func setWorkRevenue(entries []Work, p Project) float64 {
+	rates := getRates()
+	total := 0.0
+	for i := range entries {
+		if entries[i].Billable {
+			entries[i].Revenue = entries[i].Hours * rates.For(p, entries[i].MemberId)
+			total += entries[i].Revenue
+		}
+	}
+	return total
+}
@@ -1,10 +1,15 @@
-// Page handlers for log of activity on projects
+// Page handlers for reports
 
 package main
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Page showing reports menu
@@ -12,3 +17,142 @@ func showReports(c *gin.Context) {
 	c.HTML(http.StatusOK, "reports.html",
 		gin.H{"current": "reports"})
 }
+
+// Report of work entries whose billable flag contradicts their project's
+// category, with checkboxes to reconcile those that can still be changed
+func showBillableMismatches(c *gin.Context) {
+
+	// Why each entry can't be changed, if it can't, and total hours
+	// affected in each direction
+	type mismatch struct {
+		Work
+		Skip string
+	}
+	entries := []mismatch{}
+	var billableHours, nonBillableHours float64
+	for _, w := range getBillableMismatches() {
+		m := mismatch{Work: w}
+		if w.InvoiceId > 0 {
+			m.Skip = "Invoiced"
+		} else if workLockedMessage(w) != "" {
+			m.Skip = "Locked period"
+		} else if workStatusMessage(w) != "" {
+			m.Skip = "Time sheet " + w.Status
+		}
+		entries = append(entries, m)
+		if w.Billable {
+			billableHours += w.Hours
+		} else {
+			nonBillableHours += w.Hours
+		}
+	}
+
+	c.HTML(http.StatusOK, "billable_check.html", gin.H{
+		"entries":          entries,
+		"billableHours":    billableHours,
+		"nonBillableHours": nonBillableHours,
+		"changed":          c.Query("changed"),
+		"skipped":          c.Query("skipped"),
+		"current":          "reports",
+	})
+}
+
+// Handle bulk action to set billable flag of selected entries from project
+func reconcileBillableForm(c *gin.Context) {
+
+	// Get IDs of entries that were checked
+	ids := []int{}
+	for _, s := range c.PostFormArray("id") {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			c.String(http.StatusBadRequest, "Invalid work entry ID")
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	// Update, and go back to the report, with how many couldn't be changed
+	changed := reconcileBillable(ids)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/reports/billable?changed=%d&skipped=%d", changed, len(ids)-changed))
+}
+
+// Report of hours and revenue by project and client for one year
+func showRevenueReport(c *gin.Context) {
+
+	// Year from query string, default to current
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(time.Now().Year())))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid year")
+		return
+	}
+
+	// Projects with work in that year, with revenue
+	start, end := fmt.Sprintf("%04d-01-01", year), fmt.Sprintf("%04d-12-31", year)
+	all := getProjectsBetween(start, end)
+	setProjectRatesBetween(all, start, end)
+	projects := []Project{}
+	for _, p := range all {
+		if p.Logs > 0 {
+			projects = append(projects, p)
+		}
+	}
+
+	// Revenue in the base currency, converting each billable entry at the
+	// exchange rate on its date, and noting currencies with no rates
+	cv := newConverter()
+	rates := getRates()
+	index := map[int]int{}
+	for i, p := range projects {
+		index[p.Id] = i
+	}
+	missing := map[string]bool{}
+	for _, w := range getWorkEntriesBetween(start, end) {
+		i, found := index[w.ProjectId]
+		if !found || !w.Billable {
+			continue
+		}
+		p := &projects[i]
+		amount, ok := cv.ToBase(w.Hours*rates.For(*p, w.MemberId), p.EffectiveCurrency, w.WorkDate)
+		if !ok {
+			missing[p.EffectiveCurrency] = true
+			continue
+		}
+		p.BaseRevenue += amount
+	}
+	missingRates := []string{}
+	for cur := range missing {
+		missingRates = append(missingRates, cur)
+	}
+	sort.Strings(missingRates)
+
+	// Totals by client, in the same order as projects, and overall, with
+	// revenue in the base currency
+	type clientTotal struct {
+		Client                        string
+		Hours, BillableHours, Revenue float64
+	}
+	clients := []clientTotal{}
+	var total clientTotal
+	for _, p := range projects {
+		if len(clients) == 0 || clients[len(clients)-1].Client != p.Client {
+			clients = append(clients, clientTotal{Client: p.Client})
+		}
+		ct := &clients[len(clients)-1]
+		ct.Hours += p.Hours
+		ct.BillableHours += p.BillableHours
+		ct.Revenue += p.BaseRevenue
+		total.Hours += p.Hours
+		total.BillableHours += p.BillableHours
+		total.Revenue += p.BaseRevenue
+	}
+
+	c.HTML(http.StatusOK, "revenue.html", gin.H{
+		"year":     year,
+		"projects": projects,
+		"clients":  clients,
+		"total":    total,
+		"base":     cv.Base,
+		"missing":  strings.Join(missingRates, ", "),
+		"current":  "reports",
+	})
+}
@@ -0,0 +1,186 @@
+// Global search across work entries, projects and contacts, from the search
+// box in the menu bar.
+//
+// Searching uses an SQLite FTS5 full-text index (the search_index table),
+// which is kept up to date when records are saved, and rebuilt at startup.
+// FTS5 needs the app to be built with "go build -tags sqlite_fts5"; without
+// it, search still works but reads through the tables instead.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Most results shown for each kind of record
+const maxSearchHits = 50
+
+// Kinds of records searched, in the order shown, with headings
+var searchKinds = []struct{ Kind, Heading string }{
+	{"work", "Log entries"},
+	{"project", "Projects"},
+	{"contact", "Contacts"},
+}
+
+// Set up the search index at startup, noting whether FTS5 is available
+// (only when built with -tags sqlite_fts5)
+func initSearch() {
+	ftsAvailable = createSearchIndex()
+	if ftsAvailable {
+		rebuildSearchIndex()
+	}
+}
+
+// Split a search into words, dropping punctuation that has a meaning in
+// FTS5 queries
+func searchWords(q string) []string {
+	return strings.FieldsFunc(q, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("@.-_'", r))
+	})
+}
+
+// Make an FTS5 query matching records that have all the words, each word
+// matching the start of a word in the text, e.g. "acme" matches "acmecorp"
+func ftsMatch(words []string) string {
+	terms := []string{}
+	for _, w := range words {
+		terms = append(terms, `"`+strings.ReplaceAll(w, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// Make a snippet of text to show in search results, with matches in <mark>.
+// Snippets from the index already have matches between \x01 and \x02,
+// otherwise the snippet is cut from the text around the first word found.
+func searchSnippet(text string, words []string) template.HTML {
+
+	// From the index, just escape and mark
+	if ftsAvailable {
+		s := html.EscapeString(text)
+		s = strings.ReplaceAll(s, "\x01", "<mark>")
+		s = strings.ReplaceAll(s, "\x02", "</mark>")
+		return template.HTML(s)
+	}
+
+	// Find words ignoring case, if lower case doesn't change positions
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		return template.HTML(html.EscapeString(text))
+	}
+	first := -1
+	for _, w := range words {
+		if i := strings.Index(lower, strings.ToLower(w)); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+
+	// Cut out about 150 characters around the first match, at rune boundaries
+	start, end := 0, len(text)
+	if first > 50 {
+		start = first - 50
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+	}
+	if end > start+150 {
+		end = start + 150
+		for end > start && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	}
+
+	// Mark each match within that, escaping the rest
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		matched := 0
+		for _, w := range words {
+			if n := len(w); n > matched && i+n <= end && lower[i:i+n] == strings.ToLower(w) {
+				matched = n
+			}
+		}
+		if matched > 0 {
+			b.WriteString("<mark>" + html.EscapeString(text[i:i+matched]) + "</mark>")
+			i += matched
+		} else {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			b.WriteString(html.EscapeString(text[i : i+size]))
+			i += size
+		}
+	}
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return template.HTML(b.String())
+}
+
+// Page showing search results, grouped by kind of record
+func showSearch(c *gin.Context) {
+
+	// One result, as shown
+	type result struct {
+		Link, Title, Detail string
+		Snippet             template.HTML
+	}
+	type group struct {
+		Heading string
+		Results []result
+		More    bool // true if there are more than shown
+	}
+
+	// Search each kind of record, with the index if there is one
+	q := strings.TrimSpace(c.Query("q"))
+	words := searchWords(q)
+	groups := []group{}
+	count := 0
+	for _, k := range searchKinds {
+		if len(words) == 0 {
+			break
+		}
+		var hits []SearchHit
+		if ftsAvailable {
+			hits = searchIndex(k.Kind, ftsMatch(words), maxSearchHits+1)
+		} else {
+			hits = searchLike(k.Kind, words, maxSearchHits+1)
+		}
+		if len(hits) == 0 {
+			continue
+		}
+		g := group{Heading: k.Heading, More: len(hits) > maxSearchHits}
+		for i, h := range hits {
+			if i == maxSearchHits {
+				break
+			}
+			r := result{Title: h.Title, Detail: h.Detail, Snippet: searchSnippet(h.Text, words)}
+			switch h.Kind {
+			case "work":
+				r.Link = fmt.Sprintf("/work_entry/%d", h.Id)
+			case "project":
+				r.Link = fmt.Sprintf("/project/%d", h.Id)
+			case "contact":
+				r.Link = fmt.Sprintf("/contact/%d", h.Id)
+			}
+			g.Results = append(g.Results, r)
+		}
+		count += len(g.Results)
+		groups = append(groups, g)
+	}
+
+	c.HTML(http.StatusOK, "search.html", gin.H{
+		"q":       q,
+		"groups":  groups,
+		"count":   count,
+		"max":     maxSearchHits,
+		"current": "search",
+	})
+}
@@ -0,0 +1,137 @@
+// Page handlers for settings, which are stored as name/value pairs
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Get a numeric setting, or the default value if not set or invalid
+func settingFloat(name string, defaultValue float64) float64 {
+	f, err := strconv.ParseFloat(getSetting(name, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return f
+}
+
+// Page showing all settings
+func showSettings(c *gin.Context) {
+
+	// Letterhead details for PDF output
+	letterhead := map[string]string{}
+	for _, name := range letterheadSettings {
+		letterhead[name] = getSetting(name, "")
+	}
+
+	c.HTML(http.StatusOK, "settings.html", gin.H{
+		"defaultRate":      settingFloat("default_rate", 0),
+		"baseCurrency":     baseCurrency(),
+		"budgetThresholds": getSetting("budget_thresholds", defaultBudgetThresholds),
+		"weeklyTarget":     weeklyTarget(),
+		"firstDayOfWeek":   int(firstDayOfWeek()),
+		"weekDays":         locales["en"].Days,
+		"locale":           getSetting("locale", "en"),
+		"locales":          locales,
+		"localeCodes":      localeCodes,
+		"letterhead":       letterhead,
+		"teamMode":         teamMode(),
+		"saved":            c.Query("saved") != "",
+		"current":          "settings",
+	})
+}
+
+// Handle form submission to save settings, checking every field before
+// saving any of them
+func saveSettingsForm(c *gin.Context) {
+
+	// Base currency
+	base := strings.ToUpper(strings.TrimSpace(c.PostForm("base_currency")))
+	if !validCurrency(base) {
+		c.String(http.StatusBadRequest, "Invalid base currency \""+base+"\"")
+		return
+	}
+
+	// Default rate
+	rate, err := parseAmount(c.PostForm("default_rate"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid default rate")
+		return
+	}
+
+	// Budget alert thresholds, comma-separated percentages, blank for none
+	thresholds := []string{}
+	for _, s := range strings.Split(c.PostForm("budget_thresholds"), ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		t, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || t <= 0 {
+			c.String(http.StatusBadRequest, "Invalid budget threshold \""+s+"\"")
+			return
+		}
+		thresholds = append(thresholds, strconv.FormatFloat(t, 'f', -1, 64))
+	}
+
+	// Weekly target hours, zero for none
+	target, err := parseAmount(c.PostForm("weekly_target"))
+	if err != nil || target < 0 || target > 168 {
+		c.String(http.StatusBadRequest, "Invalid weekly target")
+		return
+	}
+
+	// First day of the week, 0 for Sunday, which can't change while time
+	// sheets for the current weeks are waiting for approval
+	first, err := strconv.Atoi(c.PostForm("first_day_of_week"))
+	if err != nil || first < 0 || first > 6 {
+		c.String(http.StatusBadRequest, "Invalid first day of week")
+		return
+	}
+	if time.Weekday(first) != firstDayOfWeek() && len(getTimesheets(0, "submitted")) > 0 {
+		c.String(http.StatusBadRequest, "Time sheets are waiting for approval, approve or reject them before changing the first day of the week")
+		return
+	}
+
+	// Language of month and day names
+	locale := c.PostForm("locale")
+	if _, ok := locales[locale]; !ok {
+		c.String(http.StatusBadRequest, "Invalid language \""+locale+"\"")
+		return
+	}
+
+	// Team mode on or off
+	teamMode := ""
+	if c.PostForm("team_mode") == "on" {
+		teamMode = "1"
+	}
+
+	// All valid, so save them
+	saveSetting("base_currency", base)
+	saveSetting("default_rate", strconv.FormatFloat(rate, 'f', -1, 64))
+	saveSetting("budget_thresholds", strings.Join(thresholds, ","))
+	saveSetting("weekly_target", strconv.FormatFloat(target, 'f', -1, 64))
+	saveSetting("first_day_of_week", strconv.Itoa(first))
+	saveSetting("locale", locale)
+	saveSetting("team_mode", teamMode)
+
+	// Letterhead details
+	for _, name := range letterheadSettings {
+		saveSetting(name, strings.TrimSpace(c.PostForm(name)))
+	}
+
+	c.Redirect(http.StatusSeeOther, "/settings?saved=1")
+}
+
+// Parse an optional amount from a form, blank means zero
+func parseAmount(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -26,3 +26,158 @@ function confirmProjectLinkDeletion(contactId, projectId, projectName) {
         window.location.href = '/del_contact_project?cid=' + contactId + '&pid=' + projectId;
     }
 }
+
+// Handler to confirm deletion of work entry template
+function confirmTemplateDeletion(id) {
+    if ( confirm('Are you sure you want to delete this template?') ) {
+        window.location.href = '/delete_template/' + id;
+    }
+}
+
+// Check or uncheck all checkboxes with the given name, to match the one clicked
+function checkAll(source, name) {
+    document.querySelectorAll('input[name="' + name + '"]').forEach(function(cb) {
+        cb.checked = source.checked;
+    });
+}
+
+// On the work entry form, default the billable flag from the project selected,
+// or the flag with the given name, e.g. for one of several entries on a form
+function setBillableFromProject(select, name) {
+    var opt = select.options[select.selectedIndex];
+    if ( opt && opt.dataset.billable ) {
+        select.form.elements[name || 'billable'].checked = opt.dataset.billable == 'true';
+    }
+}
+
+// Handler to confirm deletion of draft invoice
+function confirmInvoiceDeletion(id) {
+    if ( confirm('Delete this draft invoice? Its work entries can then be billed again.') ) {
+        window.location.href = '/delete_invoice/' + id;
+    }
+}
+
+// Ask for the reason before reopening a locked period, and submit it with
+// the form
+function confirmPeriodUnlock(form) {
+    var note = prompt('Reopen this period? Entries in it can then be changed. Reason:');
+    if ( note === null ) {
+        return false;
+    }
+    form.note.value = note;
+    return true;
+}
+
+// Handler to confirm deletion of expense
+function confirmExpenseDeletion(id) {
+    if ( confirm('Are you sure you want to delete this expense?') ) {
+        window.location.href = '/delete_expense/' + id;
+    }
+}
+
+// Handler to confirm deletion of exchange rate
+function confirmExchangeRateDeletion(id) {
+    if ( confirm('Are you sure you want to delete this exchange rate?') ) {
+        window.location.href = '/delete_exchange_rate/' + id;
+    }
+}
+
+// Handler to confirm deletion of client
+function confirmClientDeletion(id) {
+    if ( confirm('Are you sure you want to delete this client?') ) {
+        window.location.href = '/delete_client/' + id;
+    }
+}
+
+// Handler to confirm removing a contact from a client
+function confirmClientContactDeletion(clientId, contactId, name) {
+    if ( confirm('Remove ' + name + ' from this client?') ) {
+        window.location.href = '/del_client_contact?client=' + clientId + '&contact=' + contactId;
+    }
+}
+
+// On the work entry form, offer only the tasks of the project selected
+function showTasksForProject(select) {
+    var tasks = select.form.elements['task_id'];
+    if ( !tasks ) {
+        return;
+    }
+    for ( var i = 0; i < tasks.options.length; i++ ) {
+        var opt = tasks.options[i];
+        if ( opt.dataset.project ) {
+            opt.hidden = opt.dataset.project != select.value;
+        }
+    }
+    if ( tasks.options[tasks.selectedIndex].hidden ) {
+        tasks.value = '';
+    }
+}
+
+// Handler to confirm deletion of task
+function confirmTaskDeletion(id) {
+    if ( confirm('Delete this task? Its subtasks and log entries move up to the task above it.') ) {
+        window.location.href = '/delete_task/' + id;
+    }
+}
+
+// Handler to confirm deletion of holiday calendar
+function confirmHolidayCalendarDeletion(id) {
+    if ( confirm('Delete this holiday calendar and all its holidays?') ) {
+        window.location.href = '/delete_holiday_calendar/' + id;
+    }
+}
+
+// Handler to confirm deletion of holiday
+function confirmHolidayDeletion(id, calendarId) {
+    if ( confirm('Are you sure you want to delete this holiday?') ) {
+        window.location.href = '/delete_holiday/' + id + '?calendar=' + calendarId;
+    }
+}
+
+// Handler to confirm deletion of calendar feed
+function confirmFeedDeletion(id) {
+    if ( confirm('Delete this feed? Calendar apps subscribed to it will stop getting updates.') ) {
+        window.location.href = '/delete_feed/' + id;
+    }
+}
+
+// Handler to confirm deletion of meeting rule
+function confirmMeetingRuleDeletion(id) {
+    if ( confirm('Delete this rule? Meetings already imported keep their projects.') ) {
+        window.location.href = '/delete_meeting_rule/' + id;
+    }
+}
+
+// Handler to confirm deletion of absence
+function confirmAbsenceDeletion(id) {
+    if ( confirm('Delete this absence, and the log entries made for it?') ) {
+        window.location.href = '/delete_absence/' + id;
+    }
+}
+
+// On the work entry form, suggest tags to complete the last one being typed,
+// keeping the ones before it
+function suggestTags(input) {
+    var words = input.value.split(/[\s,]+/);
+    var last = words.pop().replace(/^#/, '').toLowerCase();
+    var before = words.filter(function(w) { return w != ''; }).join(' ');
+    var options = input.list ? input.list.options : [];
+    for ( var i = 0; i < options.length; i++ ) {
+        var tag = options[i].dataset.tag;
+        options[i].value = (before ? before + ' ' : '') + '#' + tag;
+        options[i].disabled = tag.indexOf(last) != 0;
+    }
+}
+
+// On the work entry form, set the hours from the start and end times, when
+// both are filled in
+function setHoursFromTimes(form) {
+    var start = form.elements['start_time'].value, end = form.elements['end_time'].value;
+    if ( start && end ) {
+        var minutes = (parseInt(end.substr(0, 2)) * 60 + parseInt(end.substr(3, 2)))
+                    - (parseInt(start.substr(0, 2)) * 60 + parseInt(start.substr(3, 2)));
+        if ( minutes > 0 ) {
+            form.elements['hours'].value = (minutes / 60).toFixed(2);
+        }
+    }
+}
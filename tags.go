@@ -0,0 +1,105 @@
+// Free-form tags on work entries, e.g. #meeting, #travel or #analysis, to
+// say what kind of work it was, and the report of hours by tag.
+//
+// Tags are stored in lower case without the "#", so "#Meeting" and
+// "meeting" are the same tag.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Longest tag that can be saved
+const maxTagLength = 32
+
+// Split tags typed on the work entry form, separated by spaces or commas,
+// e.g. "#meeting, travel", into a sorted list without duplicates
+func parseTags(s string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		tag := strings.ToLower(strings.TrimLeft(word, "#"))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Check that a tag has only letters, digits, "-" and "_", and isn't too
+// long, returning an error message if not
+func tagMessage(tag string) string {
+	if len(tag) > maxTagLength {
+		return fmt.Sprintf("Tag #%s is longer than %d characters", tag, maxTagLength)
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return fmt.Sprintf("Tag #%s can only have letters, digits, - and _", tag)
+		}
+	}
+	return ""
+}
+
+// Tags of a work entry as typed on the form, e.g. "#meeting #travel"
+func (w Work) TagText() string {
+	text := []string{}
+	for _, tag := range w.Tags {
+		text = append(text, "#"+tag)
+	}
+	return strings.Join(text, " ")
+}
+
+// Check whether a work entry has the given tag
+func (w Work) HasTag(tag string) bool {
+	for _, t := range w.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Report of hours by tag across all projects for one year, in total and by
+// project
+func showTagReport(c *gin.Context) {
+
+	// Year from query string, default to current
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(time.Now().Year())))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid year")
+		return
+	}
+	start, end := fmt.Sprintf("%04d-01-01", year), fmt.Sprintf("%04d-12-31", year)
+
+	// Hours in the year in total, and without any tag, to compare with tags.
+	// An entry with several tags counts toward each of them.
+	tags := getTagHoursBetween(start, end, false)
+	var totalHours, untaggedHours float64
+	allTags := getAllWorkTags()
+	for _, w := range getWorkEntriesBetween(start, end) {
+		totalHours += w.Hours
+		if len(allTags[w.Id]) == 0 {
+			untaggedHours += w.Hours
+		}
+	}
+
+	c.HTML(http.StatusOK, "tags.html", gin.H{
+		"year":          year,
+		"tags":          tags,
+		"projects":      getTagHoursBetween(start, end, true),
+		"totalHours":    totalHours,
+		"untaggedHours": untaggedHours,
+		"current":       "reports",
+	})
+}
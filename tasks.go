@@ -0,0 +1,217 @@
+// Page handlers for tasks within projects. Tasks break a project down into
+// workstreams, and may have subtasks of their own. Work entries can be
+// assigned to a task, and hours roll up from subtasks to their parents, and
+// from tasks to the project.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Arrange tasks as a tree: each task followed by its subtasks, with depth,
+// path, and totals rolled up from subtasks. Tasks whose parent is missing or
+// in another project are treated as top-level tasks.
+func taskTree(tasks []Task) []Task {
+
+	// Index of each task, and subtasks of each (0 for top level)
+	index := map[int]int{}
+	for i, t := range tasks {
+		index[t.Id] = i
+	}
+	children := map[int][]int{}
+	for i, t := range tasks {
+		parent := t.ParentId
+		if j, found := index[parent]; !found || parent == t.Id || tasks[j].ProjectId != t.ProjectId {
+			parent = 0
+		}
+		children[parent] = append(children[parent], i)
+	}
+
+	// Add each task and its subtasks, depth first, adding up totals
+	tree := []Task{}
+	visited := map[int]bool{}
+	var add func(i, depth int, path string) Task
+	add = func(i, depth int, path string) Task {
+		visited[i] = true
+		t := tasks[i]
+		t.Depth = depth
+		t.Path = t.Name
+		if path != "" {
+			t.Path = path + " / " + t.Name
+		}
+		pos := len(tree)
+		tree = append(tree, t)
+		for _, c := range children[t.Id] {
+			if !visited[c] {
+				sub := add(c, depth+1, t.Path)
+				t.Logs += sub.Logs
+				t.Hours += sub.Hours
+				t.BillableHours += sub.BillableHours
+			}
+		}
+		tree[pos] = t
+		return t
+	}
+	for _, i := range children[0] {
+		add(i, 0, "")
+	}
+
+	// Anything left is in a loop of parents, show it at the top level
+	for i := range tasks {
+		if !visited[i] {
+			add(i, 0, "")
+		}
+	}
+	return tree
+}
+
+// Check whether a task is the given task or one of its subtasks, at any
+// depth
+func isSubtask(tasks []Task, id, ancestorId int) bool {
+	parent := map[int]int{}
+	for _, t := range tasks {
+		parent[t.Id] = t.ParentId
+	}
+	for n := 0; id != 0 && n <= len(tasks); n++ {
+		if id == ancestorId {
+			return true
+		}
+		id = parent[id]
+	}
+	return false
+}
+
+// Get the tasks that can be chosen for work entries: active tasks of all
+// projects, plus the one given even if inactive (e.g., the task of an entry
+// being edited)
+func getActiveTasks(currentId int) []Task {
+	active := []Task{}
+	for _, t := range getTasks(0) {
+		if t.Active || t.Id == currentId {
+			active = append(active, t)
+		}
+	}
+	return active
+}
+
+// Page to create/edit a task, new tasks are for the project given in the
+// query string, under the parent task given if any
+func editTask(c *gin.Context) {
+
+	// Get task ID from URL, 0 means new task
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+	var t Task
+	if id == 0 {
+		projectId, _ := strconv.Atoi(c.Query("project"))
+		parentId, _ := strconv.Atoi(c.Query("parent"))
+		t = Task{ProjectId: projectId, ParentId: parentId, Active: true}
+	} else {
+		var found bool
+		t, found = findTask(id)
+		if !found {
+			c.String(http.StatusNotFound, "Task not found")
+			return
+		}
+	}
+	if _, found := findProject(t.ProjectId); !found {
+		c.String(http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	showTaskForm(c, t, ValidationErrors{})
+}
+
+// Show the task form, with error messages if any
+func showTaskForm(c *gin.Context, t Task, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	// Possible parents are the project's other tasks, except subtasks of
+	// this one
+	tasks := getTasks(t.ProjectId)
+	parents := []Task{}
+	for _, p := range tasks {
+		if t.Id == 0 || !isSubtask(tasks, p.Id, t.Id) {
+			parents = append(parents, p)
+		}
+	}
+
+	c.HTML(status, "edit_task.html", gin.H{
+		"task":    t,
+		"project": getProject(t.ProjectId),
+		"parents": parents,
+		"errors":  errs,
+		"current": "projects",
+	})
+}
+
+// Handle save of a task, from the task form or the project page
+func saveTaskForm(c *gin.Context) {
+
+	// Parse fields
+	id, _ := strconv.Atoi(c.PostForm("id"))
+	projectId, _ := strconv.Atoi(c.PostForm("project_id"))
+	parentId, _ := strconv.Atoi(c.PostForm("parent_id"))
+	t := Task{
+		Id:        id,
+		ProjectId: projectId,
+		ParentId:  parentId,
+		Name:      strings.TrimSpace(c.PostForm("name")),
+		Active:    c.PostForm("active") == "on" || c.PostForm("active") == "true",
+	}
+
+	// An existing task stays in its project
+	if id > 0 {
+		old, found := findTask(id)
+		if !found {
+			c.String(http.StatusNotFound, "Task not found")
+			return
+		}
+		t.ProjectId = old.ProjectId
+	}
+	if _, found := findProject(t.ProjectId); !found {
+		c.String(http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	// Validate, and show the form again if there are any errors
+	errs := validateTask(t)
+	if len(errs) > 0 {
+		showTaskForm(c, t, errs)
+		return
+	}
+
+	saveTask(t)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/project/%d", t.ProjectId))
+}
+
+// Handle deletion of a task, its subtasks and work entries move up to its
+// parent
+func deleteTaskHandler(c *gin.Context) {
+
+	// Get task ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+	t, found := findTask(id)
+	if !found {
+		c.String(http.StatusNotFound, "Task not found")
+		return
+	}
+
+	deleteTask(id)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/project/%d", t.ProjectId))
+}
@@ -0,0 +1,354 @@
+// Team mode: team members log their own work, submit each week's entries as
+// a time sheet for approval, and a manager approves or rejects it with a
+// comment. Submitted and approved entries can't be changed, and in team
+// mode only approved entries are invoiced.
+//
+// There are no logins yet, so the current member is chosen on the members
+// page and remembered in a cookie.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Name of the cookie holding the current member's ID
+const memberCookie = "member"
+
+// How many months back the time sheets page shows weeks with work
+const timesheetMonths = 12
+
+// Check whether team mode is turned on in settings
+func teamMode() bool {
+	return getSetting("team_mode", "") == "1"
+}
+
+// Get the current team member from the cookie, false if none chosen
+func currentMember(c *gin.Context) (Member, bool) {
+	s, err := c.Cookie(memberCookie)
+	if err != nil {
+		return Member{}, false
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return Member{}, false
+	}
+	return findMember(id)
+}
+
+// Check that the current team member is a manager, in team mode, showing
+// an error if not. Returns the member (none outside team mode) and whether
+// the action is allowed.
+func requireManager(c *gin.Context, action string) (Member, bool) {
+	if !teamMode() {
+		return Member{}, true
+	}
+	me, found := currentMember(c)
+	if !found || !me.Manager {
+		c.String(http.StatusForbidden, "Only managers can "+action)
+		return me, false
+	}
+	return me, true
+}
+
+// Check whether an existing work entry can still be changed given its
+// approval status, returning an error message if not, or a blank string
+func workStatusMessage(w Work) string {
+	if w.Status == "submitted" || w.Status == "approved" {
+		return "This entry has been " + w.Status + " and can no longer be changed"
+	}
+	return ""
+}
+
+// Page showing list of team members
+func showMembers(c *gin.Context) {
+	cur, _ := currentMember(c)
+	c.HTML(http.StatusOK, "members.html", gin.H{
+		"members":  getMembers(),
+		"me":       cur,
+		"teamMode": teamMode(),
+		"current":  "timesheets",
+	})
+}
+
+// Page to create/edit a team member
+func editMember(c *gin.Context) {
+
+	// Get member ID from URL, 0 means new member
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid member ID")
+		return
+	}
+	m := Member{Active: true}
+	if id > 0 {
+		var found bool
+		m, found = findMember(id)
+		if !found {
+			c.String(http.StatusNotFound, "Member not found")
+			return
+		}
+	}
+	showMemberForm(c, m, ValidationErrors{})
+}
+
+// Show the team member form, with error messages if any
+func showMemberForm(c *gin.Context, m Member, errs ValidationErrors) {
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.HTML(status, "edit_member.html", gin.H{
+		"m":       m,
+		"errors":  errs,
+		"current": "timesheets",
+	})
+}
+
+// Handle save of a team member
+func saveMemberForm(c *gin.Context) {
+
+	// Parse fields, collecting errors for any that can't be parsed
+	errs := ValidationErrors{}
+	id, _ := strconv.Atoi(c.PostForm("id"))
+	rate, err := parseAmount(c.PostForm("rate"))
+	if err != nil {
+		errs["rate"] = "Please enter the rate as a number, or leave blank"
+	}
+	m := Member{
+		Id:      id,
+		Name:    strings.TrimSpace(c.PostForm("name")),
+		Email:   strings.TrimSpace(c.PostForm("email")),
+		Manager: c.PostForm("manager") == "on",
+		Rate:    rate,
+		Active:  c.PostForm("active") == "on",
+	}
+
+	// Validate the rest, and show the form again if there are any errors
+	for field, msg := range validateMember(m) {
+		if errs[field] == "" {
+			errs[field] = msg
+		}
+	}
+	if len(errs) > 0 {
+		showMemberForm(c, m, errs)
+		return
+	}
+
+	saveMember(m)
+	c.Redirect(http.StatusSeeOther, "/members")
+}
+
+// Choose the current team member (0 for none), and go to their time sheets
+func workAsMember(c *gin.Context) {
+
+	// Get member ID from URL
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid member ID")
+		return
+	}
+
+	// Remember in cookie for a year, or forget
+	if id == 0 {
+		c.SetCookie(memberCookie, "", -1, "/", "", false, true)
+		c.Redirect(http.StatusSeeOther, "/members")
+		return
+	}
+	if _, found := findMember(id); !found {
+		c.String(http.StatusNotFound, "Member not found")
+		return
+	}
+	c.SetCookie(memberCookie, strconv.Itoa(id), 365*24*60*60, "/", "", false, true)
+	c.Redirect(http.StatusSeeOther, "/timesheets")
+}
+
+// Page showing the current member's weekly time sheets and their status,
+// and for managers, the time sheets waiting for approval
+func showTimesheets(c *gin.Context) {
+
+	// Need to know who the current member is
+	me, found := currentMember(c)
+	if !found {
+		c.Redirect(http.StatusSeeOther, "/members")
+		return
+	}
+
+	// Weeks with work, and weeks submitted, most recent first
+	type week struct {
+		WeekStart string
+		Hours     float64
+		Status    string
+		Comment   string
+	}
+	weeks := map[string]*week{}
+	since := time.Now().AddDate(0, -timesheetMonths, 0).Format("2006-01-02")
+	for ws, hours := range getMemberWeeklyHours(me.Id, since, firstDayOfWeek()) {
+		weeks[ws] = &week{WeekStart: ws, Hours: hours, Status: "draft"}
+	}
+	for _, t := range getTimesheets(me.Id, "") {
+		if weeks[t.WeekStart] == nil {
+			weeks[t.WeekStart] = &week{WeekStart: t.WeekStart}
+		}
+		weeks[t.WeekStart].Status = t.Status
+		weeks[t.WeekStart].Comment = t.Comment
+	}
+	list := []week{}
+	for _, w := range weeks {
+		list = append(list, *w)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].WeekStart > list[j].WeekStart })
+
+	// Time sheets to approve, other than the manager's own
+	toApprove := []Timesheet{}
+	if me.Manager {
+		for _, t := range getTimesheets(0, "submitted") {
+			if t.MemberId != me.Id {
+				toApprove = append(toApprove, t)
+			}
+		}
+	}
+
+	c.HTML(http.StatusOK, "timesheets.html", gin.H{
+		"me":        me,
+		"weeks":     list,
+		"toApprove": toApprove,
+		"thisWeek":  weekStart(time.Now()).Format("2006-01-02"),
+		"teamMode":  teamMode(),
+		"current":   "timesheets",
+	})
+}
+
+// Page showing one member's time sheet for one week, with buttons to
+// submit it (for the member) or approve/reject it (for a manager)
+func showTimesheet(c *gin.Context) {
+
+	// Week and member from query, default to current member this week
+	me, _ := currentMember(c)
+	date, err := time.Parse("2006-01-02", c.DefaultQuery("week", time.Now().Format("2006-01-02")))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid week")
+		return
+	}
+	start := weekStart(date)
+	end := start.AddDate(0, 0, 6)
+	memberId, err := strconv.Atoi(c.DefaultQuery("member", strconv.Itoa(me.Id)))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid member ID")
+		return
+	}
+	member, found := findMember(memberId)
+	if !found {
+		c.Redirect(http.StatusSeeOther, "/members")
+		return
+	}
+
+	// Entries for the week, and whether any can be submitted
+	entries := getMemberWork(member.Id, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	var hours float64
+	canSubmit := false
+	for _, w := range entries {
+		hours += w.Hours
+		if w.Status == "draft" || w.Status == "rejected" {
+			canSubmit = me.Id == member.Id
+		}
+	}
+
+	// Time sheet, if submitted, and whether the current member can review it
+	t, submitted := findTimesheet(member.Id, start.Format("2006-01-02"))
+	canReview := submitted && t.Status == "submitted" && me.Manager && me.Id != member.Id
+
+	c.HTML(http.StatusOK, "timesheet.html", gin.H{
+		"member":    member,
+		"start":     start.Format("2006-01-02"),
+		"end":       end.Format("2006-01-02"),
+		"prev":      start.AddDate(0, 0, -7).Format("2006-01-02"),
+		"next":      start.AddDate(0, 0, 7).Format("2006-01-02"),
+		"entries":   entries,
+		"hours":     hours,
+		"t":         t,
+		"submitted": submitted,
+		"canSubmit": canSubmit,
+		"canReview": canReview,
+		"current":   "timesheets",
+	})
+}
+
+// Handle submission of the current member's time sheet for a week
+func submitTimesheetForm(c *gin.Context) {
+
+	// Current member and week
+	me, found := currentMember(c)
+	if !found {
+		c.String(http.StatusBadRequest, "Choose who you are on the members page first")
+		return
+	}
+	date, err := time.Parse("2006-01-02", c.PostForm("week"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid week")
+		return
+	}
+	start := weekStart(date)
+
+	// Submit the draft and rejected entries
+	n := submitTimesheet(me.Id, start.Format("2006-01-02"), start.AddDate(0, 0, 6).Format("2006-01-02"))
+	if n == 0 {
+		c.String(http.StatusBadRequest, "No draft or rejected entries to submit for week of "+start.Format("2006-01-02"))
+		return
+	}
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/timesheet?member=%d&week=%s", me.Id, start.Format("2006-01-02")))
+}
+
+// Handle approval or rejection of a submitted time sheet by a manager
+func reviewTimesheetForm(c *gin.Context) {
+
+	// Get time sheet ID from URL, must be waiting for approval
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid time sheet ID")
+		return
+	}
+	var t Timesheet
+	for _, ts := range getTimesheets(0, "submitted") {
+		if ts.Id == id {
+			t = ts
+		}
+	}
+	if t.Id == 0 {
+		c.String(http.StatusBadRequest, "Time sheet is not waiting for approval")
+		return
+	}
+
+	// Only managers can review, and not their own time sheets
+	me, found := currentMember(c)
+	if !found || !me.Manager {
+		c.String(http.StatusForbidden, "Only managers can approve or reject time sheets")
+		return
+	}
+	if me.Id == t.MemberId {
+		c.String(http.StatusForbidden, "You cannot approve or reject your own time sheet")
+		return
+	}
+
+	// Approve, or reject with a reason
+	comment := strings.TrimSpace(c.PostForm("comment"))
+	status := c.PostForm("action")
+	if status != "approved" && status != "rejected" {
+		c.String(http.StatusBadRequest, "Invalid action")
+		return
+	}
+	if status == "rejected" && comment == "" {
+		c.String(http.StatusBadRequest, "Please give a reason for rejecting the time sheet")
+		return
+	}
+
+	reviewTimesheet(t, status, me.Id, comment)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/timesheet?member=%d&week=%s", t.MemberId, t.WeekStart))
+}
@@ -0,0 +1,565 @@
+// Server-side validation of work entries, projects, contacts and other
+// records, before they are saved. Each function returns a map of error
+// messages keyed by form field name, which is empty if the record is valid,
+// so that the edit form can be shown again with a message under each field.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error messages, keyed by form field name
+type ValidationErrors map[string]string
+
+// Limits on hours that can be logged
+const maxEntryHours = 24.0 // for one work entry
+const maxDailyHours = 24.0 // for all work entries on one day
+
+// Valid project categories ("" means not yet categorized)
+var projectCategories = []string{"", "Billable", "CD", "IP", "Training", "Absent", "Other"}
+
+// Check a work entry before saving
+func validateWork(w Work) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// Can't change an entry that has already been billed, submitted or
+	// approved, or is in a locked period
+	var old Work
+	if w.Id > 0 {
+		var found bool
+		old, found = findWork(w.Id)
+		if !found {
+			errs["form"] = "This entry no longer exists"
+		} else if old.InvoiceId > 0 {
+			errs["form"] = fmt.Sprintf("This entry has been invoiced (invoice %d), delete the draft invoice first to change it",
+				getInvoice(old.InvoiceId).Number)
+		} else if msg := workStatusMessage(old); msg != "" {
+			errs["form"] = msg
+		} else if msg := workLockedMessage(old); msg != "" {
+			errs["form"] = msg
+		}
+	}
+
+	// Date must be a real date
+	_, err := time.Parse("2006-01-02", w.WorkDate)
+	if err != nil {
+		errs["work_date"] = "Please enter a valid date (YYYY-MM-DD)"
+	}
+
+	// Hours within bounds for one entry, and for the whole day
+	if w.Hours <= 0 {
+		errs["hours"] = "Hours must be more than zero"
+	} else if w.Hours > maxEntryHours {
+		errs["hours"] = fmt.Sprintf("Hours cannot be more than %.0f for one entry", maxEntryHours)
+	} else if err == nil {
+		dayHours := dailyHours(w.WorkDate, w.MemberId, w.Id) + w.Hours
+		if dayHours > maxDailyHours {
+			errs["hours"] = fmt.Sprintf("This would make %.2f hours on %s, more than the daily maximum of %.0f",
+				dayHours, w.WorkDate, maxDailyHours)
+		}
+	}
+
+	// Start and end times are optional, but both must be given, with the end
+	// after the start
+	if w.StartTime != "" || w.EndTime != "" {
+		start, startOk := clockMinutes(w.StartTime)
+		end, endOk := clockMinutes(w.EndTime)
+		if !startOk {
+			errs["start_time"] = "Please enter the start time as HH:MM, or leave both times blank"
+		} else if !endOk {
+			errs["end_time"] = "Please enter the end time as HH:MM, or leave both times blank"
+		} else if end <= start {
+			errs["end_time"] = "End time must be after the start time"
+		}
+	}
+
+	// Project must exist, and be active unless the entry was already on it
+	p, found := findProject(w.ProjectId)
+	if !found {
+		errs["project_id"] = "Please select a project"
+	} else if !p.Active {
+		if old.ProjectId != w.ProjectId {
+			errs["project_id"] = fmt.Sprintf("Project %s is not active", p.Name)
+		}
+	}
+
+	// Task if any must be in the project, and be active unless the entry
+	// was already on it
+	if w.TaskId != 0 && found {
+		t, taskFound := findTask(w.TaskId)
+		if !taskFound || t.ProjectId != w.ProjectId {
+			errs["task_id"] = "Please select a task of project " + p.Name
+		} else if !t.Active {
+			if old.TaskId != w.TaskId {
+				errs["task_id"] = fmt.Sprintf("Task %s is not active", t.Name)
+			}
+		}
+	}
+
+	// Tags must be plain words
+	for _, tag := range w.Tags {
+		if msg := tagMessage(tag); msg != "" {
+			errs["tags"] = msg
+			break
+		}
+	}
+
+	// Can't add or move an entry into a locked period
+	if found && err == nil && errs["form"] == "" {
+		if l, locked := findPeriodLock(w.WorkDate, p.Client); locked {
+			errs["work_date"] = "This date is in a locked period (" + lockDescription(l) + ")"
+		}
+	}
+
+	return errs
+}
+
+// Check a project before saving
+func validateProject(p Project) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// Name is required and must fit in database column, client if any must
+	// be a known one
+	if strings.TrimSpace(p.Name) == "" {
+		errs["name"] = "Name is required"
+	} else if len(p.Name) > 32 {
+		errs["name"] = "Name cannot be longer than 32 characters"
+	}
+	if p.ClientId != 0 {
+		if _, found := findClient(p.ClientId); !found {
+			errs["client_id"] = "Unknown client"
+		}
+	}
+
+	// Rate, fees and budget can't be negative
+	if p.Rate < 0 {
+		errs["rate"] = "Rate cannot be negative"
+	}
+	if p.Fees < 0 {
+		errs["fees"] = "Fees cannot be negative"
+	}
+	if p.BudgetHours < 0 {
+		errs["budget_hours"] = "Hours budget cannot be negative"
+	}
+	if p.Currency != "" && !validCurrency(p.Currency) {
+		errs["currency"] = "Please enter a three-letter currency code, e.g. EUR, or leave blank"
+	}
+
+	// Progress
+	if p.Estimate < 0 {
+		errs["estimate"] = "Estimate cannot be negative"
+	}
+	if p.Complete < 0 || p.Complete > 100 {
+		errs["complete"] = "Percent complete must be from 0 to 100"
+	}
+
+	// Category must be one of the known ones
+	validCategory := false
+	for _, cat := range projectCategories {
+		if p.Category == cat {
+			validCategory = true
+		}
+	}
+	if !validCategory {
+		errs["category"] = "Unknown category " + p.Category
+	}
+
+	return errs
+}
+
+// Check a task before saving
+func validateTask(t Task) ValidationErrors {
+
+	errs := ValidationErrors{}
+	tasks := getTasks(t.ProjectId)
+
+	// Name is required, must fit in database column, and can't be the same
+	// as another task under the same parent
+	if t.Name == "" {
+		errs["name"] = "Name is required"
+	} else if len(t.Name) > 32 {
+		errs["name"] = "Name cannot be longer than 32 characters"
+	} else {
+		for _, other := range tasks {
+			if other.Id != t.Id && other.ParentId == t.ParentId && strings.EqualFold(other.Name, t.Name) {
+				errs["name"] = "There is already a task called " + other.Name + " here"
+			}
+		}
+	}
+
+	// Parent if any must be a task of the same project, and not this task or
+	// one of its subtasks
+	if t.ParentId != 0 {
+		parent, found := findTask(t.ParentId)
+		if !found || parent.ProjectId != t.ProjectId {
+			errs["parent_id"] = "Please select a task of this project"
+		} else if t.Id != 0 && isSubtask(tasks, t.ParentId, t.Id) {
+			errs["parent_id"] = "A task cannot be under itself or one of its subtasks"
+		}
+	}
+
+	return errs
+}
+
+// Check a contact before saving
+func validateContact(c Contact) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// First and last names are required
+	if strings.TrimSpace(c.FirstName) == "" {
+		errs["first_name"] = "First name is required"
+	} else if len(c.FirstName) > 32 {
+		errs["first_name"] = "First name cannot be longer than 32 characters"
+	}
+	if strings.TrimSpace(c.LastName) == "" {
+		errs["last_name"] = "Last name is required"
+	} else if len(c.LastName) > 32 {
+		errs["last_name"] = "Last name cannot be longer than 32 characters"
+	}
+
+	// Other fields that must fit in database columns
+	if len(c.Company) > 32 {
+		errs["company"] = "Company cannot be longer than 32 characters"
+	}
+	if len(c.Title) > 32 {
+		errs["title"] = "Title cannot be longer than 32 characters"
+	}
+
+	// Each email address must at least look like one
+	for _, e := range splitEmails(c.Emails) {
+		at := strings.Index(e, "@")
+		if at < 1 || at == len(e)-1 {
+			errs["emails"] = fmt.Sprintf("\"%s\" is not a valid email address", e)
+			break
+		}
+	}
+
+	return errs
+}
+
+// Check an expense before saving
+func validateExpense(e Expense) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// Date must be a real date
+	_, err := time.Parse("2006-01-02", e.ExpenseDate)
+	if err != nil {
+		errs["expense_date"] = "Please enter a valid date (YYYY-MM-DD)"
+	}
+
+	// Amount must be positive, in a three-letter currency
+	if e.Amount <= 0 {
+		errs["amount"] = "Amount must be more than zero"
+	}
+	if !validCurrency(e.Currency) {
+		errs["currency"] = "Please enter a three-letter currency code, e.g. USD"
+	}
+
+	// Category must be one of the known ones
+	validCategory := false
+	for _, cat := range expenseCategories {
+		if e.Category == cat {
+			validCategory = true
+		}
+	}
+	if !validCategory {
+		errs["category"] = "Unknown category " + e.Category
+	}
+	if len(e.Description) > 200 {
+		errs["description"] = "Description cannot be longer than 200 characters"
+	}
+
+	// Project must exist, and date must not be in a locked period
+	p, found := findProject(e.ProjectId)
+	if !found {
+		errs["project_id"] = "Please select a project"
+	} else if err == nil {
+		if l, locked := findPeriodLock(e.ExpenseDate, p.Client); locked {
+			errs["expense_date"] = "This date is in a locked period (" + lockDescription(l) + ")"
+		}
+	}
+
+	return errs
+}
+
+// Check a team member before saving
+func validateMember(m Member) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// Name is required
+	if m.Name == "" {
+		errs["name"] = "Name is required"
+	} else if len(m.Name) > 32 {
+		errs["name"] = "Name cannot be longer than 32 characters"
+	}
+
+	// Email is optional, but must look like one
+	if m.Email != "" {
+		at := strings.Index(m.Email, "@")
+		if at < 1 || at == len(m.Email)-1 || len(m.Email) > 64 {
+			errs["email"] = fmt.Sprintf("\"%s\" is not a valid email address", m.Email)
+		}
+	}
+
+	// Rate can't be negative
+	if m.Rate < 0 {
+		errs["rate"] = "Rate cannot be negative"
+	}
+
+	return errs
+}
+
+// Check a client before saving
+func validateClient(cl Client) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// Name is required, and must not match another client's ignoring case
+	if cl.Name == "" {
+		errs["name"] = "Name is required"
+	} else if len(cl.Name) > 32 {
+		errs["name"] = "Name cannot be longer than 32 characters"
+	} else if other, found := findClientByName(cl.Name); found && other.Id != cl.Id {
+		errs["name"] = fmt.Sprintf("There is already a client named \"%s\"", other.Name)
+	}
+
+	// Rate can't be negative, currency is optional
+	if cl.Rate < 0 {
+		errs["rate"] = "Rate cannot be negative"
+	}
+	if cl.Currency != "" && !validCurrency(cl.Currency) {
+		errs["currency"] = "Please enter a three-letter currency code, e.g. EUR, or leave blank"
+	}
+
+	return errs
+}
+
+// Split a list of email addresses, separated by commas, semicolons or spaces
+func splitEmails(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\t'
+	})
+}
+
+// Check a holiday calendar before saving
+func validateHolidayCalendar(hc HolidayCalendar) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// Name is required, must fit in database column, and must be unique
+	if hc.Name == "" {
+		errs["name"] = "Name is required"
+	} else if len(hc.Name) > 64 {
+		errs["name"] = "Name cannot be longer than 64 characters"
+	} else {
+		for _, other := range getHolidayCalendars() {
+			if other.Id != hc.Id && strings.EqualFold(other.Name, hc.Name) {
+				errs["name"] = "There is already a holiday calendar called " + other.Name
+			}
+		}
+	}
+
+	return errs
+}
+
+// Check a holiday before saving
+func validateHoliday(h Holiday) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	if _, err := time.Parse("2006-01-02", h.HolidayDate); err != nil {
+		errs["holiday_date"] = "Please enter a valid date (YYYY-MM-DD)"
+	}
+	if h.Name == "" {
+		errs["holiday_name"] = "Name is required"
+	} else if len(h.Name) > 128 {
+		errs["holiday_name"] = "Name cannot be longer than 128 characters"
+	}
+
+	return errs
+}
+
+// Check an absence before saving, with the work entries to generate for it
+func validateAbsence(a Absence, entries []Work) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// Kind must be one of the list
+	found := false
+	for _, k := range absenceKinds {
+		found = found || k == a.Kind
+	}
+	if !found {
+		errs["kind"] = "Please select the kind of absence"
+	}
+
+	// Dates must be valid, in order, and not more than a year apart
+	start, err1 := time.Parse("2006-01-02", a.StartDate)
+	end, err2 := time.Parse("2006-01-02", a.EndDate)
+	if err1 != nil {
+		errs["start_date"] = "Please enter a valid date (YYYY-MM-DD)"
+	}
+	if err2 != nil {
+		errs["end_date"] = "Please enter a valid date (YYYY-MM-DD)"
+	} else if err1 == nil && end.Before(start) {
+		errs["end_date"] = "End date cannot be before start date"
+	} else if err1 == nil && end.After(start.AddDate(1, 0, 0)) {
+		errs["end_date"] = "An absence cannot be longer than a year"
+	}
+	if len(a.Note) > 256 {
+		errs["note"] = "Note cannot be longer than 256 characters"
+	}
+
+	// Project to log work on, if any, must be an active project in the
+	// Absent category, and there must be a target to know how many hours
+	var p Project
+	if a.ProjectId != 0 {
+		var found bool
+		p, found = findProject(a.ProjectId)
+		if !found || !p.Active || p.Category != "Absent" {
+			errs["project_id"] = "Please select an active project in the Absent category"
+		} else if weeklyTarget() <= 0 {
+			errs["project_id"] = "Set a weekly target in the settings first, for the hours to log each day"
+		}
+	}
+
+	// Work entries generated before must be ones that can be replaced
+	if msg := absenceWorkMessage(a.Id); msg != "" {
+		errs["form"] = msg
+	}
+
+	// New work entries can't be in a locked period
+	if errs["project_id"] == "" {
+		for _, w := range entries {
+			if l, locked := findPeriodLock(w.WorkDate, p.Client); locked {
+				errs["start_date"] = "Work entries would be in a locked period (" + lockDescription(l) + ")"
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// Check a meeting rule before saving
+func validateMeetingRule(r MeetingRule) ValidationErrors {
+
+	errs := ValidationErrors{}
+
+	// Field must be one of the list
+	if r.Field != "title" && r.Field != "attendee" {
+		errs["field"] = "Please select what the rule matches"
+	}
+
+	// Pattern is required, and must fit in database column
+	if r.Pattern == "" {
+		errs["pattern"] = "Please enter text to match"
+	} else if len(r.Pattern) > 128 {
+		errs["pattern"] = "Text to match cannot be longer than 128 characters"
+	}
+
+	// Project must be an active one
+	if p, found := findProject(r.ProjectId); !found || !p.Active {
+		errs["project_id"] = "Please select an active project"
+	}
+
+	return errs
+}
+
+// Check meetings before accepting them as work entries, with the error for
+// each meeting by its ID. The hours for each day include those of the other
+// meetings accepted at the same time.
+func validateMeetings(list []Meeting) ValidationErrors {
+
+	errs := ValidationErrors{}
+	dayHours := map[string]float64{}
+	for _, mt := range list {
+		key := strconv.Itoa(mt.Id)
+		if msg := firstWorkError(validateWork(mt.Work())); msg != "" {
+			errs[key] = msg
+			continue
+		}
+		if _, found := dayHours[mt.WorkDate]; !found {
+			dayHours[mt.WorkDate] = dailyHours(mt.WorkDate, mt.MemberId, 0)
+		}
+		dayHours[mt.WorkDate] += mt.Hours
+		if dayHours[mt.WorkDate] > maxDailyHours {
+			errs[key] = fmt.Sprintf("This would make %.2f hours on %s, more than the daily maximum of %.0f",
+				dayHours[mt.WorkDate], mt.WorkDate, maxDailyHours)
+		}
+	}
+
+	return errs
+}
+
+// Check the rows of a CSV file before importing them as work entries,
+// setting the error of each row that doesn't have one yet, and returning
+// the number of rows with errors. Rows on new projects are checked for the
+// rest, and against locks for their client, and the hours for each day
+// include those of the other rows.
+func validateCSVRows(rows []CSVRow) int {
+
+	dayHours := map[string]float64{}
+	n := 0
+	for i, row := range rows {
+		if row.Error == "" {
+			errs := validateWork(row.Work)
+			if row.NewProject {
+				delete(errs, "project_id")
+				client := row.Work.Client // as typed in the file, the client may differ in case
+				if cl, found := findClientByName(client); found {
+					client = cl.Name
+				}
+				if l, locked := findPeriodLock(row.Work.WorkDate, client); locked && errs["work_date"] == "" {
+					errs["work_date"] = "This date is in a locked period (" + lockDescription(l) + ")"
+				}
+			}
+			rows[i].Error = firstWorkError(errs)
+		}
+		if rows[i].Error == "" {
+			date := row.Work.WorkDate
+			if _, found := dayHours[date]; !found {
+				dayHours[date] = dailyHours(date, row.Work.MemberId, 0)
+			}
+			dayHours[date] += row.Work.Hours
+			if dayHours[date] > maxDailyHours {
+				rows[i].Error = fmt.Sprintf("This would make %.2f hours on %s, more than the daily maximum of %.0f",
+					dayHours[date], date, maxDailyHours)
+			}
+		}
+		if rows[i].Error != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Hours already logged on a date that count towards the daily maximum for
+// a work entry, excluding the entry itself: in team mode only those of the
+// entry's member, otherwise everything
+func dailyHours(date string, memberId, excludeId int) float64 {
+	if !teamMode() {
+		memberId = -1
+	}
+	return getHoursForDate(date, memberId, excludeId)
+}
+
+// First error message of a work entry, for lists with room for only one
+func firstWorkError(errs ValidationErrors) string {
+	for _, field := range []string{"form", "project_id", "work_date", "hours", "start_time", "end_time", "tags"} {
+		if msg := errs[field]; msg != "" {
+			return msg
+		}
+	}
+	return ""
+}